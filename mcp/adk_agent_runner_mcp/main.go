@@ -9,26 +9,47 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
+	"github.com/poy/adk-rnd/mcp/internal/metatool"
 )
 
 func main() {
 	toolName := flag.String("toolName", "adk_graph", "Tool name")
 	toolDescription := flag.String("toolDescription", "Extracts agent and sub-agent relationships from an ADK Python script", "Tool description")
+	python := flag.String("python", "python3", "Python interpreter used to parse agent source, as a name on PATH or a path")
+	showVersion := flag.Bool("version", false, "print the version and exit")
 	flag.Parse()
+	if *showVersion {
+		fmt.Println(version)
+		return
+	}
 
-	srv := server.NewMCPServer("adk-graph-tool", "v0.0.1")
+	pythonPath, err := resolvePython(*python)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	srv := server.NewMCPServer("adk-graph-tool", version)
 
 	srv.AddTool(
 		mcp.NewTool(*toolName,
 			mcp.WithDescription(*toolDescription),
-			mcp.WithString("source", mcp.Required(), mcp.Description("The ADK agent Python code (string, not path)")),
+			mcp.WithString("source", mcp.Required(), mcp.MinLength(1), mcp.MaxLength(maxSourceLength),
+				mcp.Description("The ADK agent code itself, not a path to it. Must be valid Python; it is parsed, never run."),
+			),
+			mcp.WithObject("files",
+				mcp.Description("Optional local modules the source imports, mapping a path relative to the source, such as helpers.py or tools/search.py, to its code. Agents defined in modules the source imports are included in the graph."),
+				mcp.AdditionalProperties(map[string]any{"type": "string"}),
+			),
 		),
-		runHandler,
+		runHandler(pythonPath),
 	)
+	metatool.AddServerInfo(srv, version, nil, nil)
 
 	log.Printf("Serving tool %q...", *toolName)
 	// Start the stdio server
@@ -37,11 +58,83 @@ func main() {
 	}
 }
 
-func runHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+// resolvePython finds the interpreter so a missing one is reported at startup
+// rather than on the first call.
+func resolvePython(python string) (string, error) {
+	p, err := exec.LookPath(python)
+	if err != nil {
+		return "", fmt.Errorf("python interpreter %q not found (install it or pass -python): %w", python, err)
+	}
+	return p, nil
+}
+
+// runHandler extracts the agent graph by running the source through a small
+// Python script with the interpreter at pythonPath.
+func runHandler(pythonPath string) server.ToolHandlerFunc {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return extractGraph(pythonPath, req)
+	}
+}
+
+// maxSourceLength is the longest source, in characters, the tool accepts.
+const maxSourceLength = 1 << 20
+
+// checkSource rejects source that can't hold an agent before starting Python.
+func checkSource(source string) error {
+	if strings.TrimSpace(source) == "" {
+		return fmt.Errorf("source is empty; pass the Python code defining the agents")
+	}
+	if n := utf8.RuneCountInString(source); n > maxSourceLength {
+		return fmt.Errorf("source is %d characters, over the limit of %d", n, maxSourceLength)
+	}
+	return nil
+}
+
+// sourceName is what the source is saved as next to its extra files.
+const sourceName = "agent.py"
+
+// checkFiles rejects extra files that wouldn't land beside the source as
+// importable modules, and returns their contents by path.
+func checkFiles(raw any) (map[string]string, error) {
+	if raw == nil {
+		return map[string]string{}, nil
+	}
+	m, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("files must be an object mapping paths to Python code")
+	}
+	files := make(map[string]string, len(m))
+	for name, v := range m {
+		code, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("file %q must be a string of Python code", name)
+		}
+		if !filepath.IsLocal(name) || filepath.Ext(name) != ".py" {
+			return nil, fmt.Errorf("file %q must be a relative path to a .py file inside the source's directory", name)
+		}
+		if filepath.Clean(name) == sourceName {
+			return nil, fmt.Errorf("file %q would replace the source", name)
+		}
+		if n := utf8.RuneCountInString(code); n > maxSourceLength {
+			return nil, fmt.Errorf("file %q is %d characters, over the limit of %d", name, n, maxSourceLength)
+		}
+		files[name] = code
+	}
+	return files, nil
+}
+
+func extractGraph(pythonPath string, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	pyCode, err := req.RequireString("source")
 	if err != nil {
 		return mcp.NewToolResultError(err.Error()), nil
 	}
+	if err := checkSource(pyCode); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	files, err := checkFiles(req.GetArguments()["files"])
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
 
 	tmpDir, err := os.MkdirTemp("", "adk_graph")
 	if err != nil {
@@ -49,28 +142,96 @@ func runHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResu
 	}
 	defer os.RemoveAll(tmpDir)
 
+	// The source and its modules get a directory of their own, laid out as
+	// they would be in the project, so imports between them resolve.
+	srcDir := filepath.Join(tmpDir, "src")
+	files[sourceName] = pyCode
+	for name, code := range files {
+		p := filepath.Join(srcDir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(p, []byte(code), 0644); err != nil {
+			return nil, err
+		}
+	}
+
 	scriptPath := tmpDir + "/extract.py"
 
 	extractor := `
 import ast
+import os
 import sys
 import json
 
+def constructor_name(func):
+    # LlmAgent(...) is a Name; agents.LlmAgent(...) is an Attribute.
+    if isinstance(func, ast.Name):
+        return func.id
+    if isinstance(func, ast.Attribute):
+        return func.attr
+    return None
+
+def module_path(root, base_dir, name, level):
+    # Absolute imports resolve from the source's directory, relative ones
+    # from the importing module's. Anything else, such as the ADK itself,
+    # isn't there and is skipped.
+    d = root if level == 0 else base_dir
+    for _ in range(level - 1):
+        d = os.path.dirname(d)
+    p = os.path.join(d, *name.split(".")) if name else d
+    for candidate in (p + ".py", os.path.join(p, "__init__.py")):
+        if os.path.isfile(candidate):
+            return candidate
+    return None
+
 class AgentGraphVisitor(ast.NodeVisitor):
-    def __init__(self):
+    def __init__(self, root):
         self.root_agent = None
         self.subagents = {}
+        self.root = root
+        self.dirs = []
+        self.parsed = set()
+
+    def visit_file(self, path):
+        path = os.path.realpath(path)
+        if path in self.parsed:
+            return
+        self.parsed.add(path)
+        with open(path) as f:
+            tree = ast.parse(f.read(), filename=os.path.relpath(path, self.root))
+        self.dirs.append(os.path.dirname(path))
+        self.visit(tree)
+        self.dirs.pop()
+
+    def import_module(self, name, level=0):
+        path = module_path(self.root, self.dirs[-1], name, level)
+        if path:
+            self.visit_file(path)
+        return path
+
+    def visit_Import(self, node):
+        for alias in node.names:
+            self.import_module(alias.name)
+
+    def visit_ImportFrom(self, node):
+        self.import_module(node.module, node.level)
+        # "from pkg import mod" may name a submodule.
+        for alias in node.names:
+            sub = alias.name if not node.module else node.module + "." + alias.name
+            self.import_module(sub, node.level)
 
     def visit_Assign(self, node):
-        if isinstance(node.value, ast.Call) and hasattr(node.value.func, "id"):
-            class_name = node.value.func.id
-            if class_name.endswith("Agent"):
-                agent_name = node.targets[0].id
-                self.subagents[agent_name] = class_name
-
-        if isinstance(node.value, ast.Call) and hasattr(node.value.func, "id") and node.value.func.id == "StoryFlowAgent":
-            if isinstance(node.targets[0], ast.Name):
-                self.root_agent = node.targets[0].id
+        class_name = None
+        if isinstance(node.value, ast.Call):
+            class_name = constructor_name(node.value.func)
+
+        if class_name and class_name.endswith("Agent") and isinstance(node.targets[0], ast.Name):
+            agent_name = node.targets[0].id
+            self.subagents[agent_name] = class_name
+
+            if class_name == "StoryFlowAgent":
+                self.root_agent = agent_name
         self.generic_visit(node)
 
     def result(self):
@@ -79,10 +240,8 @@ class AgentGraphVisitor(ast.NodeVisitor):
             "subagents": self.subagents
         }
 
-code = sys.stdin.read()
-tree = ast.parse(code)
-visitor = AgentGraphVisitor()
-visitor.visit(tree)
+visitor = AgentGraphVisitor(os.path.dirname(os.path.realpath(sys.argv[1])))
+visitor.visit_file(sys.argv[1])
 print(json.dumps(visitor.result(), indent=2))
 `
 
@@ -90,8 +249,7 @@ print(json.dumps(visitor.result(), indent=2))
 		return nil, err
 	}
 
-	cmd := exec.Command("python3", scriptPath)
-	cmd.Stdin = strings.NewReader(pyCode)
+	cmd := exec.Command(pythonPath, scriptPath, filepath.Join(srcDir, sourceName))
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestResolvePythonMissingInterpreter(t *testing.T) {
+	_, err := resolvePython("no-such-python-interpreter")
+	if err == nil {
+		t.Fatal("expected an error for a missing interpreter")
+	}
+	if !strings.Contains(err.Error(), `"no-such-python-interpreter"`) || !strings.Contains(err.Error(), "-python") {
+		t.Fatalf("expected the error to name the interpreter and the -python flag, got %v", err)
+	}
+}
+
+func TestExtractGraphRejectsEmptySource(t *testing.T) {
+	// The interpreter doesn't exist, so the source must be rejected before
+	// Python is started.
+	req := mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: map[string]any{"source": "  \n"}}}
+	res, err := runHandler("/nonexistent/python3")(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.IsError || !strings.Contains(res.Content[0].(mcp.TextContent).Text, "source is empty") {
+		t.Fatalf("expected empty source to be rejected up front, got %+v", res)
+	}
+}
+
+func TestExtractGraphFindsAttributeConstructors(t *testing.T) {
+	pythonPath, err := resolvePython("python3")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	source := `from google.adk import agents
+
+x = agents.LlmAgent(name="x")
+y = LlmAgent(name="y")
+`
+	req := mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: map[string]any{"source": source}}}
+	res, err := runHandler(pythonPath)(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var graph struct {
+		Subagents map[string]string `json:"subagents"`
+	}
+	if err := json.Unmarshal([]byte(res.Content[0].(mcp.TextContent).Text), &graph); err != nil {
+		t.Fatalf("failed to parse graph %q: %v", res.Content[0].(mcp.TextContent).Text, err)
+	}
+	if graph.Subagents["x"] != "LlmAgent" || graph.Subagents["y"] != "LlmAgent" {
+		t.Fatalf("expected x and y to be found as LlmAgent, got %v", graph.Subagents)
+	}
+}
+
+func TestExtractGraphFollowsLocalImports(t *testing.T) {
+	pythonPath, err := resolvePython("python3")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	source := `from google.adk.agents import LlmAgent
+from helpers import researcher
+from tools import search
+
+story = StoryFlowAgent(name="story", sub_agents=[researcher, search.searcher])
+`
+	req := mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: map[string]any{
+		"source": source,
+		"files": map[string]any{
+			"helpers.py":        "from google.adk.agents import LlmAgent\n\nresearcher = LlmAgent(name=\"researcher\")\n",
+			"tools/__init__.py": "",
+			"tools/search.py":   "from .. import helpers\n\nsearcher = agents.LlmAgent(name=\"searcher\")\n",
+		},
+	}}}
+	res, err := runHandler(pythonPath)(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var graph struct {
+		RootAgent string            `json:"root_agent"`
+		Subagents map[string]string `json:"subagents"`
+	}
+	if err := json.Unmarshal([]byte(res.Content[0].(mcp.TextContent).Text), &graph); err != nil {
+		t.Fatalf("failed to parse graph %q: %v", res.Content[0].(mcp.TextContent).Text, err)
+	}
+	if graph.RootAgent != "story" || graph.Subagents["researcher"] != "LlmAgent" || graph.Subagents["searcher"] != "LlmAgent" {
+		t.Fatalf("expected agents from the imported modules, got %+v", graph)
+	}
+}
+
+func TestExtractGraphRejectsFilesOutsideSourceDir(t *testing.T) {
+	for _, name := range []string{"../escape.py", "/tmp/abs.py", "notes.txt", "agent.py"} {
+		req := mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: map[string]any{
+			"source": "x = 1\n",
+			"files":  map[string]any{name: ""},
+		}}}
+		res, err := runHandler("/nonexistent/python3")(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.IsError || !strings.Contains(res.Content[0].(mcp.TextContent).Text, name) {
+			t.Fatalf("expected %q to be rejected, got %+v", name, res)
+		}
+	}
+}
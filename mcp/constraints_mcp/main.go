@@ -3,153 +3,235 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
-	"io"
 	"log"
+	"log/slog"
+	"maps"
 	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
 
-	"github.com/google/cel-go/cel"
 	"github.com/mark3labs/mcp-go/client"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
+	"github.com/poy/adk-rnd/mcp/internal/config"
+	"github.com/poy/adk-rnd/mcp/internal/constraint"
+	"github.com/poy/adk-rnd/mcp/internal/logging"
+	"github.com/poy/adk-rnd/mcp/internal/metatool"
+	"github.com/poy/adk-rnd/mcp/internal/proxy"
+	"github.com/poy/adk-rnd/mcp/internal/upstream"
+	"go.opentelemetry.io/otel"
 )
 
 func main() {
 	log.SetFlags(0)
 
-	if len(os.Args) < 3 {
-		log.Fatalf("usage: %s [CONSTRAINTS_PATH] [UPSTREAM_MCP_PATH] <UPSTREAM_MCP_ARGS...>", os.Args[0])
+	forwardLogs := flag.Bool("forward-logs", false, "forward upstream stderr to the client as MCP log notifications instead of mirroring it to our stderr")
+	breakerThreshold := flag.Int("breaker-threshold", 0, "consecutive upstream failures that open the circuit and fail calls fast (default disabled)")
+	breakerCooldown := flag.Duration("breaker-cooldown", 30*time.Second, "how long the circuit stays open before a call is let through to probe the upstream")
+	maxConcurrency := flag.Int64("max-concurrency", 0, "maximum number of upstream tool calls to run at once (default unlimited)")
+	failFast := flag.Bool("fail-fast", false, "reject calls over -max-concurrency instead of queueing them")
+	maxArgsBytes := flag.Int("max-args-bytes", 0, "reject calls whose arguments encode to more than this many bytes of JSON (default unlimited)")
+	maxResultBytes := flag.Int("max-result-bytes", 0, "reject upstream results that encode to more than this many bytes of JSON (default unlimited)")
+	constraintsEnv := flag.String("constraints-env", "", "read the constraints from this environment variable instead of CONSTRAINTS_PATH")
+	dryRun := flag.Bool("dry-run", false, "log calls that fail their constraint instead of blocking them")
+	defaultDeny := flag.Bool("default-deny", false, "block upstream tools that have no constraint instead of allowing them; the proxy's own server_info, ping_upstream and list_proxied_tools stay reachable")
+	pingUpstream := flag.Bool("ping-upstream", false, "add a ping_upstream tool reporting whether the upstream answers and how quickly")
+	listProxied := flag.Bool("list-proxied-tools", false, "add a list_proxied_tools tool reporting the upstream tools being forwarded")
+	mirrorUpstream := flag.Bool("mirror-upstream", false, "report the upstream's server name, version, instructions and tool capabilities to clients instead of this proxy's own")
+	upstreamAttempts := flag.Int("upstream-attempts", 3, "how many times to try initializing the upstream and listing its tools before giving up")
+	upstreamTimeout := flag.Duration("upstream-timeout", 10*time.Second, "how long each of those attempts may take before it is abandoned and retried, or 0 for no limit, in which case only attempts that fail outright are retried")
+	logLevel := flag.String("log-level", "info", "minimum level of log lines to print: debug, info, warn or error")
+	showVersion := flag.Bool("version", false, "print the version and exit")
+	flag.Parse()
+	if err := logging.Setup(os.Stderr, *logLevel); err != nil {
+		log.Fatal(err)
+	}
+	if *showVersion {
+		fmt.Println(version)
+		return
+	}
+
+	// The constraints path is omitted when they come from the environment.
+	nConfig := 1
+	if *constraintsEnv != "" {
+		nConfig = 0
+	}
+	if flag.NArg() < nConfig+1 {
+		log.Fatalf("usage: %s <-forward-logs> <-max-concurrency=0> <-fail-fast> <-dry-run> <-constraints-env=VAR> [CONSTRAINTS_PATH[,OVERRIDE_PATH...]] [UPSTREAM_MCP_PATH] <UPSTREAM_MCP_ARGS...>", os.Args[0])
+	}
+	upstreamPath := flag.Arg(nConfig)
+	args := flag.Args()[nConfig+1:]
+
+	var constraints map[string]string
+	var err error
+	if *constraintsEnv != "" {
+		constraints, err = loadConstraintsEnv(*constraintsEnv)
+	} else {
+		constraints, err = loadConstraints(flag.Arg(0))
 	}
-	constraintsPath := os.Args[1]
-	upstreamPath := os.Args[2]
-
-	var args []string
-	if len(os.Args) > 2 {
-		args = append(args, os.Args[3:]...)
-	}
-
-	constraints, err := loadConstraints(constraintsPath)
 	if err != nil {
 		log.Fatalf("failed to load constraints: %v", err)
 	}
 
 	// Start upstream MCP over stdio.
-	mcpClient, err := client.NewStdioMCPClient(upstreamPath, nil, args...)
+	mcpClient, err := upstream.Start(upstreamPath, args)
 	if err != nil {
 		log.Fatalf("failed to start upstream: %v", err)
 	}
 	defer func() {
 		_ = mcpClient.Close()
 	}()
-	// Mirror upstream stderr verbatim to our stderr.
+
+	// Mirror upstream stderr to our stderr from the start, so output from an
+	// upstream that fails to initialize is seen and a chatty one can't fill
+	// the pipe. With -forward-logs, lines go to the client as log
+	// notifications once the proxy server exists.
+	var forwardTo atomic.Pointer[server.MCPServer]
 	if r, ok := client.GetStderr(mcpClient); ok && r != nil {
-		go mirrorStderr("upstream", r)
+		if *forwardLogs {
+			go upstream.ForwardStderr(&forwardTo, os.Stderr, "upstream", r)
+		} else {
+			go upstream.MirrorStderr(os.Stderr, "upstream", r)
+		}
 	}
-
 	ctx := context.Background()
-	if _, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+	shutdownTracing, err := proxy.SetupTracing(ctx, "constraints_mcp")
+	if err != nil {
+		log.Fatalf("failed to set up tracing: %v", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	ready := upstream.Readiness{Attempts: *upstreamAttempts, Timeout: *upstreamTimeout, Backoff: 500 * time.Millisecond}
+	initResp, err := upstream.Retry(ctx, ready, "initialize", func(ctx context.Context) (*mcp.InitializeResult, error) {
+		return mcpClient.Initialize(ctx, mcp.InitializeRequest{})
+	})
+	if err != nil {
 		log.Fatalf("upstream initialize failed: %v", err)
 	}
 
 	// Fetch upstream tools to expose identical interface.
-	listTools, err := mcpClient.ListTools(ctx, mcp.ListToolsRequest{})
+	tools, err := upstream.Retry(ctx, ready, "tools/list", func(ctx context.Context) ([]mcp.Tool, error) {
+		return proxy.ListUpstreamTools(ctx, mcpClient)
+	})
 	if err != nil {
 		log.Fatalf("upstream tools/list failed: %v", err)
 	}
 
 	// Build our proxy MCP server on stdio.
-	s := server.NewMCPServer("passthrough-proxy", "1.0.0")
+	var mirrored *mcp.InitializeResult
+	if *mirrorUpstream {
+		mirrored = initResp
+	}
+	s := upstream.NewProxyServer("passthrough-proxy", version, mirrored, server.WithLogging())
+
+	forwardTo.Store(s)
+
+	call := proxy.TraceCalls(otel.Tracer("constraints_mcp"), proxy.LimitSizes(proxy.LimitCalls(proxy.BreakCircuit(mcpClient.CallTool, *breakerThreshold, *breakerCooldown), *maxConcurrency, *failFast), *maxArgsBytes, *maxResultBytes))
+	registerTools(s, tools, call, constraints, *dryRun, *defaultDeny)
+	// The proxy's own tools only report on the proxy and its upstream and
+	// can't reach an upstream tool, so constraints and -default-deny don't
+	// apply to them.
+	metatool.AddServerInfo(s, version, &initResp.ServerInfo, tools)
+	if *listProxied {
+		proxy.AddListProxiedToolsTool(s, tools)
+	}
+	if *pingUpstream {
+		proxy.AddPingUpstreamTool(s, mcpClient.Ping, tools)
+	}
 
-	// For each upstream tool, register a proxy handler that forwards the call if
-	// it passes the given constraint.
-	for _, t := range listTools.Tools {
+	slog.Info("constraints: passthrough proxy MCP server running on stdio")
+	if err := server.ServeStdio(s); err != nil {
+		log.Fatalf("ServeStdio error: %v", err)
+	}
+}
+
+// registerTools adds a proxy handler to s for each upstream tool that forwards
+// the call if it passes the tool's constraint. Tools without a constraint are
+// allowed, or blocked if defaultDeny is set. In dry-run mode calls that would
+// have been blocked are logged and forwarded anyway.
+func registerTools(s *server.MCPServer, tools []mcp.Tool, call func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error), constraints map[string]string, dryRun, defaultDeny bool) {
+	for _, t := range tools {
 		tool := t // capture
 		s.AddTool(tool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			if ok, err := evalConstraint(constraints[t.Name], req.GetArguments()); err != nil {
-				return mcp.NewToolResultErrorf("constraint failed to evaluate: %v", err), nil
+			expr, listed := constraints[t.Name]
+			var reason string
+			if !listed && defaultDeny {
+				reason = "tool has no constraint and unlisted tools are denied"
+			} else if ok, err := constraint.Eval(expr, t.Name, constraint.CallerFromMeta(req.Params.Meta), req.GetArguments()); err != nil {
+				reason = fmt.Sprintf("constraint failed to evaluate: %v", err)
 			} else if !ok {
-				return mcp.NewToolResultError("constraint returned false"), nil
+				reason = "constraint returned false"
+			}
+			if reason != "" {
+				if !dryRun {
+					return mcp.NewToolResultError(reason), nil
+				}
+				args, _ := json.Marshal(req.GetArguments())
+				slog.Warn("dry-run: would block call", "tool", t.Name, "args", string(args), "constraint", expr, "reason", reason)
 			}
 
-			res, err := mcpClient.CallTool(ctx, req)
+			res, err := call(ctx, req)
 
 			if err != nil {
 				// Return an MCP-formatted error result so the client gets something structured.
-				return mcp.NewToolResultError(fmt.Sprintf("forward error: %v", err)), nil
+				return proxy.ForwardError(err), nil
 			}
 
 			return res, nil
 		})
-		log.Printf("registered passthrough tool: %s", tool.Name)
+		slog.Debug("registered passthrough tool", "tool", tool.Name)
 	}
 }
 
+// loadConstraints loads the constraints from p, which may list several files
+// separated by commas. A tool's constraint in a later file replaces the one
+// from earlier files.
 func loadConstraints(p string) (map[string]string, error) {
-	data, err := os.ReadFile(p)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read file: %w", err)
+	c := map[string]string{}
+	for _, path := range strings.Split(p, ",") {
+		var fc map[string]string
+		if err := config.ReadFile(path, &fc); err != nil {
+			return nil, err
+		}
+		maps.Copy(c, fc)
 	}
-	var c map[string]string
-	if err := json.Unmarshal(data, &c); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal constraints: %w", err)
+	if err := validateConstraints(c); err != nil {
+		return nil, err
 	}
 	return c, nil
 }
 
-func evalConstraint(constraintExpr string, args map[string]any) (bool, error) {
-	if constraintExpr == "" {
-		return true, nil
-	}
-
-	env, err := cel.NewEnv(
-		cel.Variable("args", cel.DynType),
-	)
-	if err != nil {
-		return false, fmt.Errorf("failed to create CEL env: %w", err)
-	}
-
-	ast, issues := env.Compile(constraintExpr)
-	if issues != nil && issues.Err() != nil {
-		return false, fmt.Errorf("failed to compile CEL: %w", issues.Err())
-	}
-
-	prg, err := env.Program(ast)
-	if err != nil {
-		return false, fmt.Errorf("failed to create CEL program: %w", err)
+// loadConstraintsEnv loads the constraints from the environment variable
+// name, in JSON or YAML.
+func loadConstraintsEnv(name string) (map[string]string, error) {
+	var c map[string]string
+	if err := config.ReadEnv(name, &c); err != nil {
+		return nil, err
 	}
-
-	out, _, err := prg.Eval(map[string]any{
-		"args": args,
-	})
-	if err != nil {
-		return false, fmt.Errorf("failed to evaluate CEL expression: %w", err)
+	if err := validateConstraints(c); err != nil {
+		return nil, err
 	}
+	return c, nil
+}
 
-	// Expecting the output to be a boolean (true/false)
-	boolVal, ok := out.Value().(bool)
-	if !ok {
-		return false, fmt.Errorf("CEL constraint did not return a boolean: got %T", out.Value())
+// validateConstraints compiles every constraint so a malformed or non-boolean
+// expression is reported when the proxy starts instead of on the first call
+// to its tool.
+func validateConstraints(constraints map[string]string) error {
+	names := make([]string, 0, len(constraints))
+	for name := range constraints {
+		names = append(names, name)
 	}
+	sort.Strings(names)
 
-	return boolVal, nil
-}
-
-// mirrorStderr copies upstream stderr to our stderr, line-buffered, with a prefix.
-func mirrorStderr(prefix string, r io.Reader) {
-	buf := make([]byte, 32*1024)
-	for {
-		n, err := r.Read(buf)
-		if n > 0 {
-			chunk := buf[:n]
-			// We do not attempt to parse; just forward with a tag.
-			os.Stderr.Write([]byte(fmt.Sprintf("[%s-stderr] ", prefix)))
-			os.Stderr.Write(chunk)
-		}
-		if err != nil {
-			if err != io.EOF {
-				log.Printf("stderr mirror error: %v", err)
-			}
-			return
+	for _, name := range names {
+		if _, err := constraint.Compile(constraints[name]); err != nil {
+			return fmt.Errorf("invalid constraint for tool %q: %w", name, err)
 		}
 	}
+	return nil
 }
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/poy/adk-rnd/mcp/internal/logging"
+	"github.com/poy/adk-rnd/mcp/internal/mcptest"
+)
+
+func TestLoadConstraintsRejectsMalformedExpression(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "constraints.json")
+	data := []byte(`{"read": "args.path != ''", "write": "args.path.startsWith("}`)
+	if err := os.WriteFile(p, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := loadConstraints(p)
+	if err == nil {
+		t.Fatal("expected a malformed constraint to fail loading")
+	}
+	if !strings.Contains(err.Error(), `"write"`) {
+		t.Fatalf("expected the error to name the tool, got %v", err)
+	}
+}
+
+func TestProxyEnforcesConstraints(t *testing.T) {
+	upstream := mcptest.NewClient(t, mcptest.NewFakeUpstream(mcptest.EchoTool()))
+	list, err := upstream.ListTools(context.Background(), mcp.ListToolsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxy := server.NewMCPServer("proxy", "test")
+	registerTools(proxy, list.Tools, upstream.CallTool, map[string]string{
+		"echo": "args.message != 'forbidden'",
+	}, false, false)
+	c := mcptest.NewClient(t, proxy)
+
+	if res := mcptest.CallTool(t, c, "echo", map[string]any{"message": "hi"}); res.IsError || mcptest.ResultText(res) != "hi" {
+		t.Fatalf("expected the call to be forwarded, got %+v", res)
+	}
+	if res := mcptest.CallTool(t, c, "echo", map[string]any{"message": "forbidden"}); !res.IsError {
+		t.Fatalf("expected the constraint to block the call, got %+v", res)
+	}
+}
+
+func TestProxyDryRunLogsInsteadOfBlocking(t *testing.T) {
+	var buf bytes.Buffer
+	defer func(l *slog.Logger, w io.Writer) {
+		slog.SetDefault(l)
+		log.SetOutput(w)
+	}(slog.Default(), log.Writer())
+	slog.SetDefault(logging.New(&buf, slog.LevelInfo))
+
+	upstream := mcptest.NewClient(t, mcptest.NewFakeUpstream(mcptest.EchoTool()))
+	list, err := upstream.ListTools(context.Background(), mcp.ListToolsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxy := server.NewMCPServer("proxy", "test")
+	registerTools(proxy, list.Tools, upstream.CallTool, map[string]string{
+		"echo": "args.message != 'forbidden'",
+	}, true, false)
+	c := mcptest.NewClient(t, proxy)
+
+	res := mcptest.CallTool(t, c, "echo", map[string]any{"message": "forbidden"})
+	if res.IsError || mcptest.ResultText(res) != "forbidden" {
+		t.Fatalf("expected the call to be forwarded in dry-run, got %+v", res)
+	}
+	if got := buf.String(); !strings.Contains(got, "dry-run: would block call") || !strings.Contains(got, "tool=echo") || !strings.Contains(got, "forbidden") {
+		t.Fatalf("expected a would-block log line, got %q", got)
+	}
+}
+
+func TestLoadConstraintsYAMLMatchesJSON(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"constraints.json": `{"write": "args.path.startsWith('/tmp/')"}`,
+		"constraints.yml":  "# Only allow writes under /tmp.\nwrite: args.path.startsWith('/tmp/')\n",
+	}
+	parsed := map[string]map[string]string{}
+	for name, data := range files {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		c, err := loadConstraints(p)
+		if err != nil {
+			t.Fatalf("failed to load %s: %v", name, err)
+		}
+		parsed[name] = c
+	}
+
+	if !reflect.DeepEqual(parsed["constraints.json"], parsed["constraints.yml"]) {
+		t.Fatalf("expected identical constraints, got %+v and %+v", parsed["constraints.json"], parsed["constraints.yml"])
+	}
+}
+
+func TestLoadConstraintsMergesOverrideFiles(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.yaml")
+	override := filepath.Join(dir, "override.json")
+	if err := os.WriteFile(base, []byte("write: args.path.startsWith('/tmp/')\ndelete: 'false'\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(override, []byte(`{"delete": "caller == 'admin'"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := loadConstraints(base + "," + override)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"write":  "args.path.startsWith('/tmp/')",
+		"delete": "caller == 'admin'",
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Fatalf("expected the override to replace only delete's constraint, got %+v", c)
+	}
+}
+
+func TestProxyDefaultDenyBlocksUnlistedTools(t *testing.T) {
+	upstream := mcptest.NewClient(t, mcptest.NewFakeUpstream(mcptest.EchoTool(), server.ServerTool{
+		Tool: mcp.NewTool("delete_everything"),
+		Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultText("deleted"), nil
+		},
+	}))
+	list, err := upstream.ListTools(context.Background(), mcp.ListToolsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxy := server.NewMCPServer("proxy", "test")
+	registerTools(proxy, list.Tools, upstream.CallTool, map[string]string{
+		"echo": "true",
+	}, false, true)
+	c := mcptest.NewClient(t, proxy)
+
+	if res := mcptest.CallTool(t, c, "echo", map[string]any{"message": "hi"}); res.IsError {
+		t.Fatalf("expected the listed tool to be allowed, got %+v", res)
+	}
+	if res := mcptest.CallTool(t, c, "delete_everything", nil); !res.IsError || !strings.Contains(mcptest.ResultText(res), "no constraint") {
+		t.Fatalf("expected the unlisted tool to be blocked, got %+v", res)
+	}
+}
+
+func TestLoadConstraintsFromEnv(t *testing.T) {
+	t.Setenv("TEST_CONSTRAINTS", "write: args.path.startsWith('/tmp/')\n")
+	c, err := loadConstraintsEnv("TEST_CONSTRAINTS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"write": "args.path.startsWith('/tmp/')"}; !reflect.DeepEqual(c, want) {
+		t.Fatalf("expected %+v, got %+v", want, c)
+	}
+
+	t.Setenv("TEST_CONSTRAINTS", `{"write": "args.path.startsWith("}`)
+	if _, err := loadConstraintsEnv("TEST_CONSTRAINTS"); err == nil {
+		t.Fatal("expected a malformed constraint to fail loading")
+	}
+	if _, err := loadConstraintsEnv("TEST_CONSTRAINTS_UNSET"); err == nil {
+		t.Fatal("expected an unset variable to fail loading")
+	}
+	if _, err := loadConstraints("-"); err == nil {
+		t.Fatal("expected reading constraints from stdin to be refused")
+	}
+}
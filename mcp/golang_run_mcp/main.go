@@ -6,30 +6,60 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"go/format"
 	"log"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
+	"github.com/poy/adk-rnd/mcp/internal/metatool"
 )
 
 func main() {
 	toolName := flag.String("toolName", "run_go", "The name of the tool")
 	toolDescription := flag.String("toolDescription", "Run Go code from a main.go-style string", "The description of the tool")
+	cacheDir := flag.String("cache-dir", "", "Directory for the Go build and module caches, shared across runs (default the go command's own caches)")
+	allowEnv := flag.String("allow-env", "", "Comma-separated globs of environment variable names callers may set with the env argument (default none)")
+	vetStrict := flag.Bool("vet-strict", false, "mark runs with vet findings as failed when the caller asks for vet")
+	structured := flag.Bool("structured", false, "also return results as structured content for clients that support it")
+	showVersion := flag.Bool("version", false, "print the version and exit")
 	flag.Parse()
+	if *showVersion {
+		fmt.Println(version)
+		return
+	}
+
+	// The go command rejects relative cache paths, and runs happen in a
+	// temporary directory anyway.
+	if *cacheDir != "" {
+		abs, err := filepath.Abs(*cacheDir)
+		if err != nil {
+			log.Fatalf("invalid -cache-dir: %v", err)
+		}
+		*cacheDir = abs
+	}
 
-	srv := server.NewMCPServer("run-go", "v0.0.1")
+	srv := server.NewMCPServer("run-go", version)
 
 	srv.AddTool(
 		mcp.NewTool(*toolName,
 			mcp.WithDescription(*toolDescription),
-			mcp.WithString("source", mcp.Required(), mcp.Description("The Go source code (must contain a main function)")),
+			mcp.WithString("source", mcp.Required(), mcp.MinLength(1), mcp.MaxLength(maxSourceLength),
+				mcp.Description("A complete single-file Go program, as the contents of main.go: package main with a func main. Only the standard library is available."),
+			),
+			mcp.WithObject("env", mcp.Description("Environment variables to set for the program, as a map of name to value. Only names allowed by the server can be set.")),
+			mcp.WithBoolean("gofmt", mcp.Description("Format the source with gofmt before running it and return the formatted source. Source that doesn't parse is reported without running it. Defaults to false.")),
+			mcp.WithBoolean("vet", mcp.Description("Run go vet after a successful run and include its findings, such as Printf mistakes or unreachable code. Defaults to false.")),
 		),
-		runGoHandler,
+		runGoHandler(splitList(*allowEnv), *cacheDir, runOptions{vetStrict: *vetStrict, structured: *structured}),
 	)
+	metatool.AddServerInfo(srv, version, nil, nil)
 
 	// Start the stdio server
 	if err := server.ServeStdio(srv); err != nil {
@@ -37,12 +67,110 @@ func main() {
 	}
 }
 
-func runGoHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	source, err := req.RequireString("source")
-	if err != nil {
-		return mcp.NewToolResultError(err.Error()), nil
+// runGoHandler runs the source with go run. Callers may only set environment
+// variables whose names match one of the allowEnv globs. If cacheDir is set,
+// the build and module caches live under it so they persist across runs; the
+// go command locks both caches, so concurrent runs can share them. Options
+// the caller can set are taken from the request; the rest come from defaults.
+func runGoHandler(allowEnv []string, cacheDir string, defaults runOptions) server.ToolHandlerFunc {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		source, err := req.RequireString("source")
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if err := checkSource(source); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		var env []string
+		if cacheDir != "" {
+			env = append(env,
+				"GOCACHE="+filepath.Join(cacheDir, "build"),
+				"GOMODCACHE="+filepath.Join(cacheDir, "mod"),
+			)
+		}
+
+		vars, err := callerEnv(req, allowEnv)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		opts := defaults
+		opts.formatted = req.GetBool("gofmt", false)
+		opts.vet = req.GetBool("vet", false)
+		if opts.formatted {
+			formatted, err := format.Source([]byte(source))
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("source doesn't parse: %v", err)), nil
+			}
+			source = string(formatted)
+		}
+
+		return runGo(source, append(env, vars...), opts)
+	}
+}
+
+// maxSourceLength is the longest source, in characters, run_go accepts.
+const maxSourceLength = 1 << 20
+
+// checkSource rejects source that can't be a program before anything is
+// built.
+func checkSource(source string) error {
+	if strings.TrimSpace(source) == "" {
+		return fmt.Errorf("source is empty; pass a complete Go program with package main and a func main")
+	}
+	if n := utf8.RuneCountInString(source); n > maxSourceLength {
+		return fmt.Errorf("source is %d characters, over the limit of %d", n, maxSourceLength)
+	}
+	return nil
+}
+
+// callerEnv returns the env argument as NAME=value pairs, rejecting any name
+// not matched by the allowEnv globs.
+func callerEnv(req mcp.CallToolRequest, allowEnv []string) ([]string, error) {
+	raw, ok := req.GetArguments()["env"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	vars, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("env must be an object mapping names to values")
+	}
+
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
 	}
+	sort.Strings(names)
 
+	var env []string
+	for _, name := range names {
+		value, ok := vars[name].(string)
+		if !ok {
+			return nil, fmt.Errorf("env value for %s must be a string", name)
+		}
+		if !matchAny(allowEnv, name) {
+			return nil, fmt.Errorf("setting environment variable %s is not allowed", name)
+		}
+		env = append(env, name+"="+value)
+	}
+	return env, nil
+}
+
+// runOptions controls what runGo does beyond running the program.
+type runOptions struct {
+	// formatted includes the source in the result.
+	formatted bool
+	// vet runs go vet once the program has run successfully.
+	vet bool
+	// vetStrict fails the run if vet reports anything.
+	vetStrict bool
+	// structured returns the result as structured content as well as text.
+	structured bool
+}
+
+// runGo runs source as main.go.
+func runGo(source string, env []string, opts runOptions) (*mcp.CallToolResult, error) {
 	tmpDir, err := os.MkdirTemp("", "go_run_*")
 	if err != nil {
 		return nil, fmt.Errorf("failed to create temp dir: %w", err)
@@ -56,6 +184,9 @@ func runGoHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolRe
 
 	cmd := exec.Command("go", "run", "main.go")
 	cmd.Dir = tmpDir
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
@@ -67,16 +198,30 @@ func runGoHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolRe
 		Success bool   `json:"success"`
 		Output  string `json:"output"`
 		Error   string `json:"error,omitempty"`
+		Vet     string `json:"vet,omitempty"`
+		Source  string `json:"formatted_source,omitempty"`
 	}{
 		Success: err == nil,
 		Output:  strings.TrimSpace(stdout.String()),
 	}
+	if opts.formatted {
+		result.Source = source
+	}
 
 	if err != nil {
 		result.Error = strings.TrimSpace(stderr.String())
+	} else if opts.vet {
+		result.Vet = goVet(tmpDir, cmd.Env)
+		if result.Vet != "" && opts.vetStrict {
+			result.Success = false
+			result.Error = "go vet reported problems"
+		}
 	}
 
 	jsonOutput, _ := json.MarshalIndent(result, "", "  ")
+	if opts.structured {
+		return mcp.NewToolResultStructured(result, string(jsonOutput)), nil
+	}
 	return &mcp.CallToolResult{
 		Content: []mcp.Content{
 			mcp.TextContent{
@@ -86,3 +231,37 @@ func runGoHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolRe
 		},
 	}, nil
 }
+
+// goVet vets main.go in dir and returns its findings, or "" if there are
+// none.
+func goVet(dir string, env []string) string {
+	cmd := exec.Command("go", "vet", "main.go")
+	cmd.Dir = dir
+	cmd.Env = env
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		return ""
+	}
+	// Drop the package header go vet prints above its findings.
+	return strings.TrimSpace(strings.TrimPrefix(string(out), "# command-line-arguments\n"))
+}
+
+func matchAny(globs []string, name string) bool {
+	for _, g := range globs {
+		if ok, _ := path.Match(g, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// splitList parses a comma-separated list, dropping empty entries.
+func splitList(s string) []string {
+	var globs []string
+	for _, g := range strings.Split(s, ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			globs = append(globs, g)
+		}
+	}
+	return globs
+}
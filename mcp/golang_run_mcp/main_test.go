@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const printEnvSource = `package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	fmt.Print(os.Getenv("GREETING"))
+}
+`
+
+func TestRunGoSetsAllowedEnv(t *testing.T) {
+	h := runGoHandler([]string{"GREET*"}, "", runOptions{})
+	req := mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: map[string]any{
+		"source": printEnvSource,
+		"env":    map[string]any{"GREETING": "hello"},
+	}}}
+	res, err := h(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result struct {
+		Success bool   `json:"success"`
+		Output  string `json:"output"`
+		Error   string `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(res.Content[0].(mcp.TextContent).Text), &result); err != nil {
+		t.Fatal(err)
+	}
+	if !result.Success || result.Output != "hello" {
+		t.Fatalf("expected program to print hello, got %+v", result)
+	}
+}
+
+func TestRunGoRejectsDisallowedEnv(t *testing.T) {
+	h := runGoHandler(nil, "", runOptions{})
+	req := mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: map[string]any{
+		"source": printEnvSource,
+		"env":    map[string]any{"GREETING": "hello"},
+	}}}
+	res, err := h(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.IsError || !strings.Contains(res.Content[0].(mcp.TextContent).Text, "GREETING") {
+		t.Fatalf("expected GREETING to be rejected, got %+v", res)
+	}
+}
+
+func TestRunGoRejectsEmptySource(t *testing.T) {
+	// A cache dir that can't be created makes any attempt to build fail
+	// differently.
+	h := runGoHandler(nil, "/dev/null/cache", runOptions{})
+	for _, source := range []string{"", " \n\t"} {
+		req := mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: map[string]any{
+			"source": source,
+		}}}
+		res, err := h(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.IsError || !strings.Contains(res.Content[0].(mcp.TextContent).Text, "source is empty") {
+			t.Fatalf("expected %q to be rejected up front, got %+v", source, res)
+		}
+	}
+}
+
+func TestRunGoReusesCacheDir(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the standard library into an empty cache")
+	}
+
+	cacheDir := t.TempDir()
+	h := runGoHandler(nil, cacheDir, runOptions{})
+	req := mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: map[string]any{
+		"source": printEnvSource,
+	}}}
+
+	res, err := h(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(res.Content[0].(mcp.TextContent).Text, `"success": true`) {
+		t.Fatalf("run failed: %s", res.Content[0].(mcp.TextContent).Text)
+	}
+
+	// The build cache holds the compiled packages in subdirectories named
+	// after their hashes.
+	var entries int
+	err = filepath.WalkDir(filepath.Join(cacheDir, "build"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(path, "-d") {
+			entries++
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected the build cache in %s: %v", cacheDir, err)
+	}
+	if entries == 0 {
+		t.Fatalf("expected build outputs cached under %s", cacheDir)
+	}
+}
+
+func TestRunGoFormatsSource(t *testing.T) {
+	h := runGoHandler(nil, "", runOptions{})
+	req := mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: map[string]any{
+		"source": "package main\nimport \"fmt\"\nfunc main(){fmt.Print( \"hi\" )}",
+		"gofmt":  true,
+	}}}
+	res, err := h(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result struct {
+		Success bool   `json:"success"`
+		Output  string `json:"output"`
+		Source  string `json:"formatted_source"`
+	}
+	if err := json.Unmarshal([]byte(res.Content[0].(mcp.TextContent).Text), &result); err != nil {
+		t.Fatal(err)
+	}
+	want := "package main\n\nimport \"fmt\"\n\nfunc main() { fmt.Print(\"hi\") }\n"
+	if !result.Success || result.Output != "hi" || result.Source != want {
+		t.Fatalf("expected the formatted source to run, got %+v", result)
+	}
+
+	req.Params.Arguments = map[string]any{"source": "package main\nfunc main() {", "gofmt": true}
+	res, err = h(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.IsError || !strings.Contains(res.Content[0].(mcp.TextContent).Text, "doesn't parse") {
+		t.Fatalf("expected a parse error, got %+v", res)
+	}
+}
+
+func TestRunGoReportsVetFindings(t *testing.T) {
+	source := `package main
+
+import "fmt"
+
+func main() {
+	fmt.Printf("%d\n", "not a number")
+}
+`
+	for _, strict := range []bool{false, true} {
+		h := runGoHandler(nil, "", runOptions{vetStrict: strict})
+		req := mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: map[string]any{
+			"source": source,
+			"vet":    true,
+		}}}
+		res, err := h(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var result struct {
+			Success bool   `json:"success"`
+			Output  string `json:"output"`
+			Vet     string `json:"vet"`
+		}
+		if err := json.Unmarshal([]byte(res.Content[0].(mcp.TextContent).Text), &result); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(result.Vet, "wrong type") || result.Success == strict {
+			t.Fatalf("strict=%v: expected a Printf vet finding, got %+v", strict, result)
+		}
+	}
+}
+
+func TestRunGoStructuredResult(t *testing.T) {
+	h := runGoHandler([]string{"GREETING"}, "", runOptions{structured: true})
+	req := mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: map[string]any{
+		"source": printEnvSource,
+		"env":    map[string]any{"GREETING": "hello"},
+	}}}
+	res, err := h(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := json.Marshal(res.StructuredContent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result struct {
+		Success bool   `json:"success"`
+		Output  string `json:"output"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		t.Fatal(err)
+	}
+	if !result.Success || result.Output != "hello" {
+		t.Fatalf("expected the structured result to carry the output, got %s", raw)
+	}
+	if !strings.Contains(res.Content[0].(mcp.TextContent).Text, `"output": "hello"`) {
+		t.Fatalf("expected the text fallback to remain, got %+v", res.Content)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWithAccessLog(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusTeapot)
+	})
+
+	var buf bytes.Buffer
+	rec := httptest.NewRecorder()
+	withAccessLog(log.New(&buf, "", 0), "text", h).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/mcp", nil))
+	if got := buf.String(); !strings.HasPrefix(got, "POST /mcp 418 ") {
+		t.Fatalf("unexpected text log line: %q", got)
+	}
+
+	buf.Reset()
+	rec = httptest.NewRecorder()
+	withAccessLog(log.New(&buf, "", 0), "json", h).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/mcp", nil))
+	var entry struct {
+		Method string `json:"method"`
+		Path   string `json:"path"`
+		Status int    `json:"status"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("expected a JSON log line, got %q: %v", buf.String(), err)
+	}
+	if entry.Method != http.MethodGet || entry.Path != "/mcp" || entry.Status != http.StatusTeapot {
+		t.Fatalf("unexpected JSON log entry: %+v", entry)
+	}
+	if rec.Code != http.StatusTeapot {
+		t.Fatalf("expected the response to pass through, got %d", rec.Code)
+	}
+}
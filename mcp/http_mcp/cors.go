@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+)
+
+// withCORS lets browser-based clients from the given origins reach h. An
+// origin of "*" allows any origin. Preflight requests are answered directly.
+func withCORS(origins []string, h http.Handler) http.Handler {
+	allowAll := slices.Contains(origins, "*")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		allowed := origin != "" && originAllowed(origins, origin)
+
+		if allowed {
+			if allowAll {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Add("Vary", "Origin")
+			}
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Mcp-Session-Id, Mcp-Protocol-Version, Last-Event-ID")
+			w.Header().Set("Access-Control-Expose-Headers", "Mcp-Session-Id")
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			if !allowed {
+				http.Error(w, "origin not allowed", http.StatusForbidden)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// originAllowed reports whether origin is one of origins, or origins allows
+// any with "*".
+func originAllowed(origins []string, origin string) bool {
+	return slices.Contains(origins, "*") || slices.Contains(origins, origin)
+}
@@ -4,17 +4,23 @@ import (
 	"context"
 	"flag"
 	"fmt"
-	"io"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/mark3labs/mcp-go/client"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
+	"github.com/poy/adk-rnd/mcp/internal/logging"
+	"github.com/poy/adk-rnd/mcp/internal/metatool"
+	"github.com/poy/adk-rnd/mcp/internal/proxy"
+	"github.com/poy/adk-rnd/mcp/internal/upstream"
+	"go.opentelemetry.io/otel"
 )
 
 func main() {
@@ -22,73 +28,140 @@ func main() {
 	log.SetFlags(0)
 
 	addr := flag.String("addr", ":8888", "address to listen on (e.g. :8888 or 127.0.0.1:9000)")
+	transport := flag.String("transport", "http", "transport to serve: http (streamable HTTP), sse (legacy HTTP+SSE) or ws (WebSocket)")
+	allow := flag.String("allow", "", "comma-separated globs of upstream tools to expose (default all)")
+	deny := flag.String("deny", "", "comma-separated globs of upstream tools to hide, takes precedence over -allow")
+	forwardLogs := flag.Bool("forward-logs", false, "forward upstream stderr to the client as MCP log notifications instead of mirroring it to our stderr")
+	corsOrigins := flag.String("cors-origins", "", "comma-separated origins allowed to make browser requests, or * for any (default CORS disabled)")
+	breakerThreshold := flag.Int("breaker-threshold", 0, "consecutive upstream failures that open the circuit and fail calls fast (default disabled)")
+	breakerCooldown := flag.Duration("breaker-cooldown", 30*time.Second, "how long the circuit stays open before a call is let through to probe the upstream")
+	maxConcurrency := flag.Int64("max-concurrency", 0, "maximum number of upstream tool calls to run at once (default unlimited)")
+	failFast := flag.Bool("fail-fast", false, "reject calls over -max-concurrency instead of queueing them")
+	maxArgsBytes := flag.Int("max-args-bytes", 0, "reject calls whose arguments encode to more than this many bytes of JSON (default unlimited)")
+	maxResultBytes := flag.Int("max-result-bytes", 0, "reject upstream results that encode to more than this many bytes of JSON (default unlimited)")
+	renames := renameFlag{}
+	flag.Var(renames, "rename", "expose an upstream tool under a new name as old=new (repeatable)")
+	accessLog := flag.String("access-log", "", "log each HTTP request as text or json (default off)")
+	mirrorUpstream := flag.Bool("mirror-upstream", false, "report the upstream's server name, version, instructions and tool capabilities to clients instead of this proxy's own")
+	upstreamAttempts := flag.Int("upstream-attempts", 3, "how many times to try initializing the upstream and listing its tools before giving up")
+	upstreamTimeout := flag.Duration("upstream-timeout", 10*time.Second, "how long each of those attempts may take before it is abandoned and retried, or 0 for no limit, in which case only attempts that fail outright are retried")
+	logLevel := flag.String("log-level", "info", "minimum level of log lines to print: debug, info, warn or error")
+	showVersion := flag.Bool("version", false, "print the version and exit")
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s <-addr=:8888> [UPSTREAM_MCP_PATH] <UPSTREAM_MCP_ARGS...>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage: %s <-addr=:8888> <-transport=http> [UPSTREAM_MCP_PATH] <UPSTREAM_MCP_ARGS...>\n", os.Args[0])
 		flag.PrintDefaults()
 	}
 	flag.Parse()
+	if err := logging.Setup(os.Stderr, *logLevel); err != nil {
+		log.Fatal(err)
+	}
+	if *showVersion {
+		fmt.Println(version)
+		return
+	}
 	if flag.NArg() < 1 {
 		flag.Usage()
 		os.Exit(2)
 	}
+	if *transport != "http" && *transport != "sse" && *transport != "ws" {
+		log.Fatalf("unknown transport %q: must be http, sse or ws", *transport)
+	}
+	if *accessLog != "" && *accessLog != "text" && *accessLog != "json" {
+		log.Fatalf("unknown access log format %q: must be text or json", *accessLog)
+	}
 	upstreamPath := flag.Arg(0)
 
 	var args []string
-	if len(os.Args) > 1 {
-		args = append(args, os.Args[2:]...)
+	if flag.NArg() > 1 {
+		args = append(args, flag.Args()[1:]...)
 	}
 
 	// Start upstream MCP over stdio.
-	mcpClient, err := client.NewStdioMCPClient(upstreamPath, nil, args...)
+	mcpClient, err := upstream.Start(upstreamPath, args)
 	if err != nil {
 		log.Fatalf("failed to start upstream: %v", err)
 	}
 	defer func() { _ = mcpClient.Close() }()
 
-	// Mirror upstream stderr verbatim to our stderr.
-	if r, ok := client.GetStderr(mcpClient); ok && r != nil {
-		go mirrorStderr("upstream", r)
-	}
-
-	// Mirror upstream stderr to our stderr.
+	// Mirror upstream stderr to our stderr from the start, so output from an
+	// upstream that fails to initialize is seen and a chatty one can't fill
+	// the pipe. With -forward-logs, lines go to the client as log
+	// notifications once the proxy server exists.
+	var forwardTo atomic.Pointer[server.MCPServer]
 	if r, ok := client.GetStderr(mcpClient); ok && r != nil {
-		go mirrorStderr("upstream", r)
+		if *forwardLogs {
+			go upstream.ForwardStderr(&forwardTo, os.Stderr, "upstream", r)
+		} else {
+			go upstream.MirrorStderr(os.Stderr, "upstream", r)
+		}
 	}
 
 	// Initialize and list tools from upstream.
 	ctx := context.Background()
-	if _, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+	shutdownTracing, err := proxy.SetupTracing(ctx, "http_mcp")
+	if err != nil {
+		log.Fatalf("failed to set up tracing: %v", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	ready := upstream.Readiness{Attempts: *upstreamAttempts, Timeout: *upstreamTimeout, Backoff: 500 * time.Millisecond}
+	initResp, err := upstream.Retry(ctx, ready, "initialize", func(ctx context.Context) (*mcp.InitializeResult, error) {
+		return mcpClient.Initialize(ctx, mcp.InitializeRequest{})
+	})
+	if err != nil {
 		log.Fatalf("initialize failed: %v", err)
 	}
 
-	list, err := mcpClient.ListTools(ctx, mcp.ListToolsRequest{})
+	tools, err := upstream.Retry(ctx, ready, "tools/list", func(ctx context.Context) ([]mcp.Tool, error) {
+		return proxy.ListUpstreamTools(ctx, mcpClient)
+	})
 	if err != nil {
 		log.Fatalf("tools/list failed: %v", err)
 	}
 
 	// Create our local MCP server that proxies tools to the upstream.
-	srv := server.NewMCPServer("http-stdio-proxy", "1.0.0")
-
-	for _, t := range list.Tools {
-		tool := t // capture
-		srv.AddTool(tool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			res, err := mcpClient.CallTool(ctx, req)
-
-			if err != nil {
-				return mcp.NewToolResultError(fmt.Sprintf("forward error: %v", err)), nil
-			}
-
-			return res, nil
-		})
-		log.Printf("registered proxy tool: %s", tool.Name)
+	var mirrored *mcp.InitializeResult
+	if *mirrorUpstream {
+		mirrored = initResp
+	}
+	srv := upstream.NewProxyServer("http-stdio-proxy", version, mirrored, server.WithLogging())
+
+	forwardTo.Store(srv)
+
+	call := proxy.TraceCalls(otel.Tracer("http_mcp"), proxy.LimitSizes(proxy.LimitCalls(proxy.BreakCircuit(mcpClient.CallTool, *breakerThreshold, *breakerCooldown), *maxConcurrency, *failFast), *maxArgsBytes, *maxResultBytes))
+	exposed := registerTools(srv, tools, call, toolFilter{
+		allow:   splitList(*allow),
+		deny:    splitList(*deny),
+		renames: renames,
+	})
+	metatool.AddServerInfo(srv, version, &initResp.ServerInfo, exposed)
+
+	// Spin up HTTP server that speaks the MCP streaming protocol, or the
+	// legacy SSE transport or WebSocket when requested.
+	var handler http.Handler = server.NewStreamableHTTPServer(srv, server.WithHeartbeatInterval(time.Second))
+	var sseSrv *server.SSEServer
+	switch *transport {
+	case "sse":
+		sseSrv = newSSEHandler(srv)
+		handler = sseSrv
+	case "ws":
+		handler = newWebSocketHandler(srv, splitList(*corsOrigins))
+	}
+	if *corsOrigins != "" {
+		handler = withCORS(splitList(*corsOrigins), handler)
+	}
+	if *accessLog != "" {
+		handler = withAccessLog(log.Default(), *accessLog, handler)
 	}
-
-	// Spin up HTTP server that speaks the MCP streaming protocol.
-	handler := server.NewStreamableHTTPServer(srv, server.WithHeartbeatInterval(time.Second))
 	httpSrv := &http.Server{
 		Addr:    *addr,
 		Handler: handler,
 	}
+	if sseSrv != nil {
+		// SSE streams stay open until the client leaves, so end them or
+		// Shutdown would wait on them forever.
+		httpSrv.RegisterOnShutdown(func() { _ = sseSrv.Shutdown(context.Background()) })
+	}
 
 	// Graceful shutdown on SIGINT/SIGTERM.
 	idleConnsClosed := make(chan struct{})
@@ -96,32 +169,14 @@ func main() {
 		sigc := make(chan os.Signal, 1)
 		signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
 		<-sigc
-		log.Printf("shutdown requested, closing HTTP server...")
+		slog.Info("shutdown requested, closing HTTP server")
 		_ = httpSrv.Shutdown(context.Background())
 		close(idleConnsClosed)
 	}()
 
-	log.Printf("serving HTTP on address %s", *addr)
+	slog.Info("serving", "transport", *transport, "addr", *addr)
 	if err := httpSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Fatalf("failed to serve HTTP: %v", err)
 	}
 	<-idleConnsClosed
 }
-
-// mirrorStderr forwards upstream stderr to our stderr with a prefix.
-func mirrorStderr(prefix string, r io.Reader) {
-	buf := make([]byte, 32*1024)
-	for {
-		n, err := r.Read(buf)
-		if n > 0 {
-			os.Stderr.Write([]byte("[" + prefix + "-stderr] "))
-			_, _ = os.Stderr.Write(buf[:n])
-		}
-		if err != nil {
-			if err != io.EOF {
-				log.Printf("stderr mirror error: %v", err)
-			}
-			return
-		}
-	}
-}
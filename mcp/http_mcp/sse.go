@@ -0,0 +1,14 @@
+package main
+
+import (
+	"time"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// newSSEHandler serves srv over the HTTP+SSE transport that predates
+// streamable HTTP: clients hold a stream open at /sse and post messages to
+// the endpoint it announces under /message.
+func newSSEHandler(srv *server.MCPServer) *server.SSEServer {
+	return server.NewSSEServer(srv, server.WithKeepAliveInterval(time.Second))
+}
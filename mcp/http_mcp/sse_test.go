@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func TestSSEConnectAndCall(t *testing.T) {
+	srv := server.NewMCPServer("test", "1.0.0")
+	srv.AddTool(mcp.NewTool("echo", mcp.WithString("text")), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText(req.GetString("text", "")), nil
+	})
+
+	sseSrv := newSSEHandler(srv)
+	ts := httptest.NewServer(sseSrv)
+	defer ts.Close()
+	defer sseSrv.Shutdown(context.Background())
+
+	ctx := context.Background()
+	c, err := client.NewSSEMCPClient(ts.URL + "/sse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.Start(ctx); err != nil {
+		t.Fatalf("failed to open the SSE stream: %v", err)
+	}
+	if _, err := c.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := c.CallTool(ctx, mcp.CallToolRequest{
+		Params: mcp.CallToolParams{Name: "echo", Arguments: map[string]any{"text": "hello"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text, _ := res.Content[0].(mcp.TextContent); text.Text != "hello" {
+		t.Fatalf("unexpected call result: %+v", res)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/poy/adk-rnd/mcp/internal/proxy"
+)
+
+// toolFilter decides which upstream tools are exposed and under which name.
+// Globs use path.Match syntax and are matched against the upstream name.
+type toolFilter struct {
+	allow   []string
+	deny    []string
+	renames renameFlag
+}
+
+// exposedName returns the name the upstream tool is registered under, or
+// false if it is hidden. Deny globs win over allow globs, and an empty allow
+// list allows everything.
+func (f toolFilter) exposedName(name string) (string, bool) {
+	if len(f.allow) > 0 && !matchAny(f.allow, name) {
+		return "", false
+	}
+	if matchAny(f.deny, name) {
+		return "", false
+	}
+	if renamed, ok := f.renames[name]; ok {
+		return renamed, true
+	}
+	return name, true
+}
+
+func matchAny(globs []string, name string) bool {
+	for _, g := range globs {
+		if ok, _ := path.Match(g, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// registerTools adds a proxy handler to srv for each permitted upstream tool.
+// Calls to renamed tools are forwarded under their upstream name. It returns
+// the tools as exposed to clients.
+func registerTools(srv *server.MCPServer, tools []mcp.Tool, call func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error), f toolFilter) []mcp.Tool {
+	var exposed []mcp.Tool
+	for _, t := range tools {
+		upstreamName := t.Name
+		name, ok := f.exposedName(upstreamName)
+		if !ok {
+			slog.Debug("skipping filtered tool", "tool", upstreamName)
+			continue
+		}
+
+		tool := t // capture
+		tool.Name = name
+		exposed = append(exposed, tool)
+		srv.AddTool(tool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			req.Params.Name = upstreamName
+			res, err := call(ctx, req)
+
+			if err != nil {
+				return proxy.ForwardError(err), nil
+			}
+
+			return res, nil
+		})
+		if name != upstreamName {
+			slog.Debug("registered proxy tool", "tool", name, "upstream", upstreamName)
+			continue
+		}
+		slog.Debug("registered proxy tool", "tool", name)
+	}
+	return exposed
+}
+
+// splitList parses a comma-separated list, dropping empty entries.
+func splitList(s string) []string {
+	var globs []string
+	for _, g := range strings.Split(s, ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			globs = append(globs, g)
+		}
+	}
+	return globs
+}
+
+// renameFlag collects repeated -rename old=new flags.
+type renameFlag map[string]string
+
+func (r renameFlag) String() string {
+	var pairs []string
+	for old, name := range r {
+		pairs = append(pairs, old+"="+name)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (r renameFlag) Set(v string) error {
+	old, name, ok := strings.Cut(v, "=")
+	if !ok || old == "" || name == "" {
+		return fmt.Errorf("expected old=new, got %q", v)
+	}
+	r[old] = name
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func TestRegisterToolsFiltersAndRenames(t *testing.T) {
+	upstream := []mcp.Tool{
+		mcp.NewTool("read_file"),
+		mcp.NewTool("write_file"),
+		mcp.NewTool("delete_file"),
+	}
+	var calledAs string
+	call := func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		calledAs = req.Params.Name
+		return mcp.NewToolResultText("ok"), nil
+	}
+
+	srv := server.NewMCPServer("test", "1.0.0")
+	registerTools(srv, upstream, call, toolFilter{
+		allow:   []string{"*_file"},
+		deny:    []string{"delete_*"},
+		renames: renameFlag{"read_file": "cat"},
+	})
+
+	ts := httptest.NewServer(server.NewStreamableHTTPServer(srv))
+	defer ts.Close()
+
+	ctx := context.Background()
+	c, err := client.NewStreamableHttpClient(ts.URL + "/mcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := c.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := c.ListTools(ctx, mcp.ListToolsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]bool{}
+	for _, tool := range list.Tools {
+		names[tool.Name] = true
+	}
+	if names["delete_file"] {
+		t.Fatal("expected denied tool to be absent")
+	}
+	if !names["cat"] || names["read_file"] || !names["write_file"] {
+		t.Fatalf("unexpected tool list: %v", names)
+	}
+
+	req := mcp.CallToolRequest{Params: mcp.CallToolParams{Name: "cat"}}
+	if _, err := c.CallTool(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if calledAs != "read_file" {
+		t.Fatalf("expected renamed call to be forwarded as read_file, got %q", calledAs)
+	}
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/poy/adk-rnd/mcp/internal/mcptest"
+	"github.com/poy/adk-rnd/mcp/internal/proxy"
+)
+
+func TestProxyPreservesToolDefinitions(t *testing.T) {
+	mcptest.CheckPreservesToolDefinitions(t, proxy.ListUpstreamTools, func(s *server.MCPServer, tools []mcp.Tool, call func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error)) {
+		registerTools(s, tools, call, toolFilter{})
+	})
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// newWebSocketHandler serves MCP over WebSocket. Each text frame from the
+// client carries a single JSON-RPC message; responses and server
+// notifications are written back as text frames on the same connection.
+// Browsers may connect from the page's own origin or from one of origins, as
+// allowed by -cors-origins.
+func newWebSocketHandler(srv *server.MCPServer, origins []string) http.Handler {
+	upgrader := websocket.Upgrader{
+		Subprotocols: []string{"mcp"},
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			if origin == "" || originAllowed(origins, origin) {
+				return true
+			}
+			u, err := url.Parse(origin)
+			return err == nil && strings.EqualFold(u.Host, r.Host)
+		},
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// Upgrade has already written an error response.
+			slog.Warn("websocket upgrade failed", "err", err)
+			return
+		}
+		defer conn.Close()
+
+		// Cancel before waiting for in-flight calls, so a client that goes
+		// away doesn't leave them running against a closed connection.
+		ctx, cancel := context.WithCancel(r.Context())
+		var inFlight sync.WaitGroup
+		defer func() {
+			cancel()
+			inFlight.Wait()
+		}()
+
+		session := &wsSession{
+			id:            uuid.NewString(),
+			notifications: make(chan mcp.JSONRPCNotification, 100),
+		}
+		if err := srv.RegisterSession(ctx, session); err != nil {
+			slog.Error("failed to register websocket session", "err", err)
+			return
+		}
+		defer srv.UnregisterSession(ctx, session.id)
+		ctx = srv.WithContext(ctx, session)
+
+		// Writes are serialized as the connection supports a single writer.
+		var writeMu sync.Mutex
+		write := func(v any) {
+			writeMu.Lock()
+			defer writeMu.Unlock()
+			if err := conn.WriteJSON(v); err != nil {
+				slog.Warn("websocket write failed", "err", err)
+			}
+		}
+
+		go func() {
+			for {
+				select {
+				case n := <-session.notifications:
+					write(n)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+
+		for {
+			msgType, data, err := conn.ReadMessage()
+			if err != nil {
+				if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					slog.Warn("websocket read failed", "err", err)
+				}
+				return
+			}
+			if msgType != websocket.TextMessage {
+				continue
+			}
+
+			// Handle messages concurrently so a slow tool call doesn't block
+			// the rest of the session.
+			inFlight.Add(1)
+			go func() {
+				defer inFlight.Done()
+				if resp := srv.HandleMessage(ctx, data); resp != nil {
+					write(resp)
+				}
+			}()
+		}
+	})
+}
+
+// wsSession is the MCP client session for a single WebSocket connection.
+type wsSession struct {
+	id            string
+	notifications chan mcp.JSONRPCNotification
+	initialized   atomic.Bool
+}
+
+func (s *wsSession) SessionID() string { return s.id }
+
+func (s *wsSession) NotificationChannel() chan<- mcp.JSONRPCNotification {
+	return s.notifications
+}
+
+func (s *wsSession) Initialize()       { s.initialized.Store(true) }
+func (s *wsSession) Initialized() bool { return s.initialized.Load() }
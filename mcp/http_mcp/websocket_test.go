@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func TestWebSocketConnectAndCall(t *testing.T) {
+	srv := server.NewMCPServer("test", "1.0.0")
+	srv.AddTool(mcp.NewTool("echo", mcp.WithString("text")), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText(req.GetString("text", "")), nil
+	})
+
+	ts := httptest.NewServer(newWebSocketHandler(srv, nil))
+	defer ts.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	roundTrip := func(msg string) json.RawMessage {
+		t.Helper()
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+		var resp struct {
+			Result json.RawMessage `json:"result"`
+			Error  any             `json:"error"`
+		}
+		if err := conn.ReadJSON(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Error != nil {
+			t.Fatalf("unexpected error response: %v", resp.Error)
+		}
+		return resp.Result
+	}
+
+	roundTrip(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26","capabilities":{},"clientInfo":{"name":"test","version":"1.0.0"}}}`)
+	raw := roundTrip(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"echo","arguments":{"text":"hello"}}}`)
+
+	var result struct {
+		Content []struct {
+			Text string `json:"text"`
+		} `json:"content"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Content) != 1 || result.Content[0].Text != "hello" {
+		t.Fatalf("unexpected call result: %s", raw)
+	}
+}
+
+func TestWebSocketChecksOriginAgainstCORSOrigins(t *testing.T) {
+	srv := server.NewMCPServer("test", "1.0.0")
+	ts := httptest.NewServer(newWebSocketHandler(srv, []string{"https://app.example"}))
+	defer ts.Close()
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http")
+
+	for origin, wantOK := range map[string]bool{
+		"https://app.example":  true,
+		"https://evil.example": false,
+		ts.URL:                 true, // same origin
+		"":                     true, // not a browser
+	} {
+		header := http.Header{}
+		if origin != "" {
+			header.Set("Origin", origin)
+		}
+		conn, _, err := websocket.DefaultDialer.Dial(wsURL, header)
+		if gotOK := err == nil; gotOK != wantOK {
+			t.Errorf("origin %q: expected connect %v, got err %v", origin, wantOK, err)
+		}
+		if conn != nil {
+			conn.Close()
+		}
+	}
+}
+
+func TestWebSocketDisconnectCancelsInFlightCalls(t *testing.T) {
+	started, canceled := make(chan struct{}), make(chan struct{})
+	srv := server.NewMCPServer("test", "1.0.0")
+	srv.AddTool(mcp.NewTool("block"), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		close(started)
+		<-ctx.Done()
+		close(canceled)
+		return nil, ctx.Err()
+	})
+
+	ts := httptest.NewServer(newWebSocketHandler(srv, nil))
+	defer ts.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	for _, msg := range []string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26","capabilities":{},"clientInfo":{"name":"test","version":"1.0.0"}}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"block"}}`,
+	} {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-started
+	conn.Close()
+
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the in-flight call to be canceled when the client disconnected")
+	}
+}
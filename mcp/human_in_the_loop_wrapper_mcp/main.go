@@ -3,63 +3,127 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"hash/fnv"
 	"html/template"
-	"io"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"sort"
 	"strconv"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/mark3labs/mcp-go/client"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
+	"github.com/poy/adk-rnd/mcp/internal/config"
+	"github.com/poy/adk-rnd/mcp/internal/constraint"
+	"github.com/poy/adk-rnd/mcp/internal/logging"
+	"github.com/poy/adk-rnd/mcp/internal/metatool"
+	"github.com/poy/adk-rnd/mcp/internal/proxy"
+	"github.com/poy/adk-rnd/mcp/internal/upstream"
 )
 
 type pendingCall struct {
-	ID        int
-	Request   mcp.CallToolRequest
-	ResponseC chan *mcp.CallToolResult
+	ID         int
+	Request    mcp.CallToolRequest
+	ResponseC  chan *mcp.CallToolResult
+	EnqueuedAt time.Time
 }
 
 var (
 	callQueue     = make(map[int]*pendingCall)
 	callQueueLock sync.Mutex
 	nextCallID    = 1
+	shuttingDown  bool
+	waitingCalls  sync.WaitGroup
 	mcpClient     *client.Client
+
+	// history holds the most recent decisions, oldest first, at most
+	// historySize of them.
+	history     []decidedCall
+	historySize = 20
+	historyLock sync.Mutex
+
+	// configs is swapped out whenever the config file is reloaded.
+	configs     map[string]MethodConfig
+	configsLock sync.RWMutex
 )
 
+// decidedCall is a call a human approved or rejected.
+type decidedCall struct {
+	ID        int       `json:"id"`
+	Tool      string    `json:"tool"`
+	Arguments any       `json:"arguments"`
+	Decision  string    `json:"decision"`
+	DecidedAt time.Time `json:"decided_at"`
+}
+
 type MethodConfig struct {
-	MethodName string `json:"methodName"`
-	Enabled    bool   `json:"enabled"`
+	MethodName string `json:"methodName" yaml:"methodName"`
+	Enabled    bool   `json:"enabled" yaml:"enabled"`
+
+	// Condition is an optional CEL expression over args, tool and caller.
+	// When set, an enabled tool's calls only need approval if it is true.
+	// caller comes from the call's _meta.caller, which the client sets
+	// itself, so don't rely on it to skip approval: a condition such as
+	// caller != "bot" lets any client skip it by claiming to be "bot".
+	Condition string `json:"condition,omitempty" yaml:"condition,omitempty"`
 }
 
 func main() {
-	println("HITL 0")
 	log.SetFlags(0)
 
-	if len(os.Args) < 3 {
-		log.Fatalf("usage: %s [CONFIG_PATH] [UPSTREAM_MCP_PATH] <UPSTREAM_MCP_ARGS...>", os.Args[0])
+	forwardLogs := flag.Bool("forward-logs", false, "forward upstream stderr to the client as MCP log notifications instead of mirroring it to our stderr")
+	forwardTimeout := flag.Duration("forward-timeout", 30*time.Second, "how long an approved call may run upstream, or 0 for no limit")
+	configEnv := flag.String("config-env", "", "read the config from this environment variable instead of CONFIG_PATH")
+	flag.IntVar(&historySize, "history-size", historySize, "how many recent decisions the UI and /api/history show")
+	mirrorUpstream := flag.Bool("mirror-upstream", false, "report the upstream's server name, version, instructions and tool capabilities to clients instead of this proxy's own")
+	upstreamAttempts := flag.Int("upstream-attempts", 3, "how many times to try initializing the upstream and listing its tools before giving up")
+	upstreamTimeout := flag.Duration("upstream-timeout", 10*time.Second, "how long each of those attempts may take before it is abandoned and retried, or 0 for no limit, in which case only attempts that fail outright are retried")
+	logLevel := flag.String("log-level", "info", "minimum level of log lines to print: debug, info, warn or error")
+	showVersion := flag.Bool("version", false, "print the version and exit")
+	flag.Parse()
+	if err := logging.Setup(os.Stderr, *logLevel); err != nil {
+		log.Fatal(err)
+	}
+	if *showVersion {
+		fmt.Println(version)
+		return
+	}
+	if historySize < 0 {
+		log.Fatalf("-history-size must not be negative, got %d", historySize)
+	}
+	// The config path is omitted when it comes from the environment.
+	nConfig := 1
+	reload := func() error { return reloadConfig(flag.Arg(0)) }
+	if *configEnv != "" {
+		nConfig = 0
+		reload = func() error { return reloadConfigEnv(*configEnv) }
+	}
+	if flag.NArg() < nConfig+1 {
+		log.Fatalf("usage: %s <-forward-logs> <-config-env=VAR> [CONFIG_PATH] [UPSTREAM_MCP_PATH] <UPSTREAM_MCP_ARGS...>", os.Args[0])
 	}
 
-	configs, err := loadConfig(os.Args[1])
-	if err != nil {
+	if err := reload(); err != nil {
 		log.Fatalf("failed to load config: %v", err)
 	}
 
-	upstreamPath := os.Args[2]
+	upstreamPath := flag.Arg(nConfig)
 	ctx := context.Background()
 
-	var args []string
-	if len(os.Args) > 2 {
-		args = append(args, os.Args[3:]...)
-	}
+	args := flag.Args()[nConfig+1:]
 
-	println("HITL 1")
 	// Start upstream MCP over stdio.
-	mcpClient, err = client.NewStdioMCPClient(upstreamPath, nil, args...)
+	var err error
+	mcpClient, err = upstream.Start(upstreamPath, args)
 	if err != nil {
 		log.Fatalf("failed to start upstream: %v", err)
 	}
@@ -67,112 +131,328 @@ func main() {
 		_ = mcpClient.Close()
 	}()
 
-	// Mirror upstream stderr verbatim to our stderr.
+	// Mirror upstream stderr to our stderr from the start, so output from an
+	// upstream that fails to initialize is seen and a chatty one can't fill
+	// the pipe. With -forward-logs, lines go to the client as log
+	// notifications once the proxy server exists.
+	var forwardTo atomic.Pointer[server.MCPServer]
 	if r, ok := client.GetStderr(mcpClient); ok && r != nil {
-		go mirrorStderr("upstream", r)
-	}
-
-	errReader, ok := client.GetStderr(mcpClient)
-	if ok {
-		go func() {
-			var data []byte
-			if n, err := errReader.Read(data); err != nil {
-				log.Printf("Failed to read from error reader: %v", err)
-			} else if n > 0 {
-				log.Printf("From error reader: %s", data[:n])
-			}
-		}()
+		if *forwardLogs {
+			go upstream.ForwardStderr(&forwardTo, os.Stderr, "upstream", r)
+		} else {
+			go upstream.MirrorStderr(os.Stderr, "upstream", r)
+		}
 	}
 
-	initResp, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{})
+	ready := upstream.Readiness{Attempts: *upstreamAttempts, Timeout: *upstreamTimeout, Backoff: 500 * time.Millisecond}
+	initResp, err := upstream.Retry(ctx, ready, "initialize", func(ctx context.Context) (*mcp.InitializeResult, error) {
+		return mcpClient.Initialize(ctx, mcp.InitializeRequest{})
+	})
 	if err != nil {
 		log.Fatalf("failed to initialize: %v", err)
 	}
 	json.NewEncoder(os.Stderr).Encode(initResp)
 
-	listRes, err := mcpClient.ListTools(ctx, mcp.ListToolsRequest{})
+	listRes, err := upstream.Retry(ctx, ready, "tools/list", func(ctx context.Context) (*mcp.ListToolsResult, error) {
+		return mcpClient.ListTools(ctx, mcp.ListToolsRequest{})
+	})
 	if err != nil {
 		log.Fatalf("tools/list failed: %v", err)
 	}
 	json.NewEncoder(os.Stderr).Encode(listRes)
 
-	proxy := server.NewMCPServer("ConsentProxy", "1.0.0", server.WithToolCapabilities(false))
+	var mirrored *mcp.InitializeResult
+	if *mirrorUpstream {
+		mirrored = initResp
+	}
+	proxy := upstream.NewProxyServer("ConsentProxy", version, mirrored, server.WithToolCapabilities(false), server.WithLogging())
+
+	forwardTo.Store(proxy)
 
 	for _, t := range listRes.Tools {
 		proxy.AddTool(t, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			return consentProxyHandler(ctx, req, t.Name, configs)
+			return consentProxyHandler(ctx, req, t.Name)
 		})
-		log.Printf("Registered proxy tool: %s", t.Name)
+		slog.Debug("registered proxy tool", "tool", t.Name)
 	}
+	metatool.AddServerInfo(proxy, version, &initResp.ServerInfo, listRes.Tools)
+	addApprovalQueueTool(proxy, listRes.Tools)
 
-	go startHTTPServer()
+	httpSrv := newHTTPServer(*forwardTimeout)
+	go func() {
+		slog.Info("HTTP approval UI at http://localhost:8080")
+		if err := httpSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("failed to serve HTTP: %v", err)
+		}
+	}()
+
+	// Reload the config on SIGHUP so approval can be toggled without a
+	// restart.
+	go func() {
+		sigc := make(chan os.Signal, 1)
+		signal.Notify(sigc, syscall.SIGHUP)
+		for range sigc {
+			if err := reload(); err != nil {
+				slog.Error("failed to reload config", "err", err)
+			}
+		}
+	}()
 
-	log.Println("Consent proxy MCP server running on stdio...")
-	if err := server.ServeStdio(proxy); err != nil {
+	// Graceful shutdown on SIGINT/SIGTERM. The approval UI is closed first
+	// so no call is approved while the rest are failed, then calls waiting
+	// for approval are failed so the agent isn't left blocked on them.
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		sigc := make(chan os.Signal, 1)
+		signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
+		<-sigc
+		slog.Info("shutdown requested, closing approval UI and failing pending calls")
+		_ = httpSrv.Shutdown(context.Background())
+		drainPendingCalls()
+		cancel()
+	}()
+
+	slog.Info("consent proxy MCP server running on stdio")
+	if err := server.NewStdioServer(proxy).Listen(ctx, os.Stdin, os.Stdout); err != nil && !errors.Is(err, context.Canceled) {
 		log.Fatalf("ServeStdio error: %v", err)
 	}
 }
 
 func loadConfig(p string) (map[string]MethodConfig, error) {
-	data, err := os.ReadFile(p)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read file: %w", err)
+	var cs []MethodConfig
+	if err := config.ReadFile(p, &cs); err != nil {
+		return nil, err
 	}
+	return configsByName(cs)
+}
+
+// loadConfigEnv loads the config from the environment variable name, in JSON
+// or YAML.
+func loadConfigEnv(name string) (map[string]MethodConfig, error) {
 	var cs []MethodConfig
-	if err := json.Unmarshal(data, &cs); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+	if err := config.ReadEnv(name, &cs); err != nil {
+		return nil, err
 	}
+	return configsByName(cs)
+}
 
+// configsByName indexes cs by tool name, compiling each condition so a
+// malformed one is reported when the config is loaded.
+func configsByName(cs []MethodConfig) (map[string]MethodConfig, error) {
 	m := map[string]MethodConfig{}
 	for _, c := range cs {
+		if c.Condition != "" {
+			if _, err := constraint.Compile(c.Condition); err != nil {
+				return nil, fmt.Errorf("invalid condition for tool %q: %w", c.MethodName, err)
+			}
+		}
 		m[c.MethodName] = c
 	}
-
 	return m, nil
 }
 
-func consentProxyHandler(ctx context.Context, req mcp.CallToolRequest, toolName string, configs map[string]MethodConfig) (*mcp.CallToolResult, error) {
-	log.Printf("Proxying for %s", toolName)
-	if !configs[toolName].Enabled {
-		return mcpClient.CallTool(ctx, req)
+// reloadConfig loads the config at p and makes it the current config.
+func reloadConfig(p string) error {
+	cs, err := loadConfig(p)
+	if err != nil {
+		return err
+	}
+	setConfig(p, cs)
+	return nil
+}
+
+// reloadConfigEnv loads the config from the environment variable name and
+// makes it the current config.
+func reloadConfigEnv(name string) error {
+	cs, err := loadConfigEnv(name)
+	if err != nil {
+		return err
+	}
+	setConfig("$"+name, cs)
+	return nil
+}
+
+// setConfig makes cs, loaded from source, the current config.
+func setConfig(source string, cs map[string]MethodConfig) {
+	var enabled []string
+	for name, c := range cs {
+		if c.Enabled {
+			if c.Condition != "" {
+				name = fmt.Sprintf("%s (when %s)", name, c.Condition)
+			}
+			enabled = append(enabled, name)
+		}
+	}
+	sort.Strings(enabled)
+
+	configsLock.Lock()
+	configs = cs
+	configsLock.Unlock()
+
+	slog.Info("loaded config", "source", source, "approval_required", enabled)
+}
+
+// requiresApproval reports whether the call to the tool must be approved. A
+// condition that fails to evaluate requires approval.
+func requiresApproval(toolName string, req mcp.CallToolRequest) bool {
+	configsLock.RLock()
+	c := configs[toolName]
+	configsLock.RUnlock()
+	if !c.Enabled || c.Condition == "" {
+		return c.Enabled
+	}
+
+	ok, err := constraint.Eval(c.Condition, toolName, constraint.CallerFromMeta(req.Params.Meta), req.GetArguments())
+	if err != nil {
+		slog.Warn("approval condition failed, requiring approval", "tool", toolName, "err", err)
+		return true
+	}
+	return ok
+}
+
+func consentProxyHandler(ctx context.Context, req mcp.CallToolRequest, toolName string) (*mcp.CallToolResult, error) {
+	slog.Debug("proxying call", "tool", toolName)
+	if !requiresApproval(toolName, req) {
+		res, err := mcpClient.CallTool(ctx, req)
+		if err != nil {
+			return proxy.ForwardError(err), nil
+		}
+		return res, nil
 	}
 
 	callQueueLock.Lock()
+	if shuttingDown {
+		callQueueLock.Unlock()
+		return mcp.NewToolResultError("Consent proxy is shutting down"), nil
+	}
 	id := nextCallID
 	nextCallID++
-	pc := &pendingCall{ID: id, Request: req, ResponseC: make(chan *mcp.CallToolResult)}
+	pc := &pendingCall{ID: id, Request: req, ResponseC: make(chan *mcp.CallToolResult, 1), EnqueuedAt: time.Now()}
 	callQueue[id] = pc
+	waitingCalls.Add(1)
 	callQueueLock.Unlock()
+	defer waitingCalls.Done()
 
 	select {
 	case result := <-pc.ResponseC:
 		return result, nil
 	case <-ctx.Done():
+		callQueueLock.Lock()
+		delete(callQueue, id)
+		callQueueLock.Unlock()
 		return mcp.NewToolResultError("Cancelled while waiting for approval"), nil
 	}
 }
 
-func startHTTPServer() {
-	http.HandleFunc("/", listPendingCalls)
-	http.HandleFunc("/approve", handleApproval(true))
-	http.HandleFunc("/reject", handleApproval(false))
+// drainPendingCalls stops new calls from being queued and fails every call
+// still waiting for approval. It returns once their handlers have returned.
+func drainPendingCalls() {
+	callQueueLock.Lock()
+	shuttingDown = true
+	for id, pc := range callQueue {
+		pc.ResponseC <- mcp.NewToolResultError("Consent proxy is shutting down")
+		delete(callQueue, id)
+	}
+	callQueueLock.Unlock()
+
+	waitingCalls.Wait()
+}
+
+// newHTTPServer returns the server for the approval UI on port 8080.
+func newHTTPServer(forwardTimeout time.Duration) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", listPendingCalls)
+	mux.HandleFunc("GET /api/pending", listPendingCallsJSON)
+	mux.HandleFunc("GET /api/history", listHistoryJSON)
+	mux.HandleFunc("/approve", handleApproval(true, forwardTimeout))
+	mux.HandleFunc("/reject", handleApproval(false, forwardTimeout))
+	mux.HandleFunc("POST /approve-all", handleApprovalAll(true, forwardTimeout))
+	mux.HandleFunc("POST /reject-all", handleApprovalAll(false, forwardTimeout))
 
-	log.Println("HTTP approval UI at http://localhost:8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	return &http.Server{
+		Addr:    ":8080",
+		Handler: mux,
+	}
 }
 
-func listPendingCalls(w http.ResponseWriter, r *http.Request) {
+// sortedPendingCalls returns the queued calls ordered by ID, which is also the
+// order they were enqueued in, so listings don't reshuffle between refreshes.
+func sortedPendingCalls() []*pendingCall {
+	callQueueLock.Lock()
+	calls := make([]*pendingCall, 0, len(callQueue))
+	for _, pc := range callQueue {
+		calls = append(calls, pc)
+	}
+	callQueueLock.Unlock()
+	sort.Slice(calls, func(i, j int) bool { return calls[i].ID < calls[j].ID })
+	return calls
+}
+
+// queueStatus is how many calls are waiting for approval, and for how long
+// the oldest of them has been waiting.
+type queueStatus struct {
+	Depth             int            `json:"depth"`
+	ByTool            map[string]int `json:"by_tool"`
+	OldestWaitSeconds float64        `json:"oldest_wait_seconds"`
+}
+
+func currentQueueStatus() queueStatus {
+	qs := queueStatus{ByTool: map[string]int{}}
+	now := time.Now()
 	callQueueLock.Lock()
 	defer callQueueLock.Unlock()
+	for _, pc := range callQueue {
+		qs.Depth++
+		qs.ByTool[pc.Request.Params.Name]++
+		qs.OldestWaitSeconds = max(qs.OldestWaitSeconds, now.Sub(pc.EnqueuedAt).Seconds())
+	}
+	return qs
+}
+
+// addApprovalQueueTool registers an approval_queue tool reporting the queue
+// depth, so an agent can tell the human is the bottleneck and hold back
+// further calls that need approval. The name is chosen among the upstream's
+// tools with metatool.FreeName.
+func addApprovalQueueTool(s *server.MCPServer, tools []mcp.Tool) {
+	s.AddTool(mcp.NewTool(metatool.FreeName("approval_queue", tools),
+		mcp.WithDescription("Returns how many tool calls are waiting for human approval, per tool, and how long the oldest has waited. Consider waiting before making more calls that need approval while the queue is deep."),
+		mcp.WithReadOnlyHintAnnotation(true),
+	), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		qs := currentQueueStatus()
+		data, err := json.Marshal(qs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal queue status: %w", err)
+		}
+		return mcp.NewToolResultStructured(qs, string(data)), nil
+	})
+}
+
+func listPendingCalls(w http.ResponseWriter, r *http.Request) {
 	type row struct {
 		ID   int
 		Tool string
 		Args string
 	}
-	var rows []row
-	for _, pc := range callQueue {
+	type decisionRow struct {
+		row
+		Decision  string
+		DecidedAt string
+	}
+	var page struct {
+		Pending []row
+		Decided []decisionRow
+	}
+	for _, pc := range sortedPendingCalls() {
 		args, _ := json.MarshalIndent(pc.Request.Params.Arguments, "", "  ")
-		rows = append(rows, row{ID: pc.ID, Tool: pc.Request.Params.Name, Args: string(args)})
+		page.Pending = append(page.Pending, row{ID: pc.ID, Tool: pc.Request.Params.Name, Args: string(args)})
+	}
+	for _, d := range recentDecisions() {
+		args, _ := json.MarshalIndent(d.Arguments, "", "  ")
+		page.Decided = append(page.Decided, decisionRow{
+			row:       row{ID: d.ID, Tool: d.Tool, Args: string(args)},
+			Decision:  d.Decision,
+			DecidedAt: d.DecidedAt.Format(time.RFC3339),
+		})
 	}
 	tmpl := `
 <html>
@@ -184,9 +464,13 @@ func listPendingCalls(w http.ResponseWriter, r *http.Request) {
 </head>
 <body>
   <h2>Pending Tool Calls</h2>
+  {{if .Pending}}
+  <form method="post" action="/approve-all" style="display: inline"><button>✅ Approve all</button></form>
+  <form method="post" action="/reject-all" style="display: inline"><button>❌ Reject all</button></form>
+  {{end}}
   <table>
     <tr><th>ID</th><th>Tool</th><th>Arguments</th><th>Action</th></tr>
-    {{range .}}
+    {{range .Pending}}
     <tr>
       <td>{{.ID}}</td>
       <td>{{.Tool}}</td>
@@ -200,13 +484,108 @@ func listPendingCalls(w http.ResponseWriter, r *http.Request) {
     <tr><td colspan="4">No pending calls</td></tr>
     {{end}}
   </table>
+  <h2>Recent Decisions</h2>
+  <table>
+    <tr><th>ID</th><th>Tool</th><th>Arguments</th><th>Decision</th><th>Decided at</th></tr>
+    {{range .Decided}}
+    <tr>
+      <td>{{.ID}}</td>
+      <td>{{.Tool}}</td>
+      <td><pre>{{.Args}}</pre></td>
+      <td>{{if eq .Decision "approved"}}✅{{else}}❌{{end}} {{.Decision}}</td>
+      <td>{{.DecidedAt}}</td>
+    </tr>
+    {{else}}
+    <tr><td colspan="5">No decisions yet</td></tr>
+    {{end}}
+  </table>
 </body>
 </html>`
 	t := template.Must(template.New("page").Parse(tmpl))
-	t.Execute(w, rows)
+	t.Execute(w, page)
+}
+
+// listPendingCallsJSON serves the queue as JSON, oldest call first. Its weak
+// ETag only depends on which calls are queued, so pollers can send
+// If-None-Match and get a 304 until a call is enqueued or resolved.
+func listPendingCallsJSON(w http.ResponseWriter, r *http.Request) {
+	type pending struct {
+		ID         int       `json:"id"`
+		Tool       string    `json:"tool"`
+		Arguments  any       `json:"arguments"`
+		EnqueuedAt time.Time `json:"enqueued_at"`
+	}
+
+	pcs := sortedPendingCalls()
+	calls := make([]pending, 0, len(pcs))
+	for _, pc := range pcs {
+		calls = append(calls, pending{
+			ID:         pc.ID,
+			Tool:       pc.Request.Params.Name,
+			Arguments:  pc.Request.Params.Arguments,
+			EnqueuedAt: pc.EnqueuedAt,
+		})
+	}
+
+	// Call IDs are never reused, so the set of IDs identifies the queue.
+	h := fnv.New64a()
+	for _, c := range calls {
+		fmt.Fprintf(h, "%d,", c.ID)
+	}
+	etag := fmt.Sprintf(`W/"%x"`, h.Sum64())
+
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(calls)
+}
+
+// listHistoryJSON serves the recent decisions as JSON, newest first.
+func listHistoryJSON(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(recentDecisions())
+}
+
+// recordDecision adds the call to the history, dropping the oldest decision
+// once there are more than historySize.
+func recordDecision(pc *pendingCall, approve bool) {
+	d := decidedCall{
+		ID:        pc.ID,
+		Tool:      pc.Request.Params.Name,
+		Arguments: pc.Request.Params.Arguments,
+		Decision:  "rejected",
+		DecidedAt: time.Now(),
+	}
+	if approve {
+		d.Decision = "approved"
+	}
+
+	historyLock.Lock()
+	defer historyLock.Unlock()
+	history = append(history, d)
+	if n := len(history) - historySize; n > 0 {
+		history = append(history[:0:0], history[n:]...)
+	}
+}
+
+// recentDecisions returns the history, newest first.
+func recentDecisions() []decidedCall {
+	historyLock.Lock()
+	defer historyLock.Unlock()
+	decided := make([]decidedCall, len(history))
+	for i, d := range history {
+		decided[len(history)-1-i] = d
+	}
+	return decided
 }
 
-func handleApproval(approve bool) http.HandlerFunc {
+// handleApproval resolves a pending call. Approved calls are forwarded with a
+// fresh context, since the caller may have waited a long time for a human;
+// forwardTimeout bounds the upstream call, with 0 meaning no limit.
+func handleApproval(approve bool, forwardTimeout time.Duration) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		idStr := r.URL.Query().Get("id")
 		id, err := strconv.Atoi(idStr)
@@ -214,46 +593,59 @@ func handleApproval(approve bool) http.HandlerFunc {
 			http.Error(w, "Invalid ID", http.StatusBadRequest)
 			return
 		}
-		callQueueLock.Lock()
-		pc := callQueue[id]
-		delete(callQueue, id)
-		callQueueLock.Unlock()
+		pc := takePendingCall(id)
 		if pc == nil {
 			http.Error(w, "Not found", http.StatusNotFound)
 			return
 		}
-		if approve {
-			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-			defer cancel()
-			res, err := mcpClient.CallTool(ctx, pc.Request)
-			if err != nil {
-				pc.ResponseC <- mcp.NewToolResultError(fmt.Sprintf("Forward error: %v", err))
-			} else {
-				pc.ResponseC <- res
-			}
-		} else {
-			pc.ResponseC <- mcp.NewToolResultError("User rejected the request")
-		}
+		resolveCall(pc, approve, forwardTimeout)
 		http.Redirect(w, r, "/", http.StatusFound)
 	}
 }
 
-// mirrorStderr copies upstream stderr to our stderr, line-buffered, with a prefix.
-func mirrorStderr(prefix string, r io.Reader) {
-	buf := make([]byte, 32*1024)
-	for {
-		n, err := r.Read(buf)
-		if n > 0 {
-			chunk := buf[:n]
-			// We do not attempt to parse; just forward with a tag.
-			os.Stderr.Write([]byte(fmt.Sprintf("[%s-stderr] ", prefix)))
-			os.Stderr.Write(chunk)
-		}
-		if err != nil {
-			if err != io.EOF {
-				log.Printf("stderr mirror error: %v", err)
+// handleApprovalAll resolves every call pending when the request arrives.
+// Calls enqueued during the sweep are left for the next decision, and calls
+// resolved individually in the meantime are skipped. Approvals are forwarded
+// one at a time.
+func handleApprovalAll(approve bool, forwardTimeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for _, pc := range sortedPendingCalls() {
+			if pc = takePendingCall(pc.ID); pc != nil {
+				resolveCall(pc, approve, forwardTimeout)
 			}
-			return
 		}
+		http.Redirect(w, r, "/", http.StatusFound)
+	}
+}
+
+// takePendingCall removes the call from the queue and returns it, or returns
+// nil if it has already been resolved.
+func takePendingCall(id int) *pendingCall {
+	callQueueLock.Lock()
+	defer callQueueLock.Unlock()
+	pc := callQueue[id]
+	delete(callQueue, id)
+	return pc
+}
+
+// resolveCall forwards an approved call upstream, or rejects it, and hands
+// the result back to the waiting caller.
+func resolveCall(pc *pendingCall, approve bool, forwardTimeout time.Duration) {
+	recordDecision(pc, approve)
+	if !approve {
+		pc.ResponseC <- mcp.NewToolResultError("User rejected the request")
+		return
+	}
+
+	ctx, cancel := context.Background(), func() {}
+	if forwardTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, forwardTimeout)
+	}
+	defer cancel()
+	res, err := mcpClient.CallTool(ctx, pc.Request)
+	if err != nil {
+		pc.ResponseC <- proxy.ForwardError(err)
+	} else {
+		pc.ResponseC <- res
 	}
 }
@@ -0,0 +1,508 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/poy/adk-rnd/mcp/internal/mcptest"
+)
+
+func TestDrainPendingCallsFailsWaitingCalls(t *testing.T) {
+	defer func() {
+		callQueueLock.Lock()
+		shuttingDown = false
+		callQueueLock.Unlock()
+	}()
+
+	configsLock.Lock()
+	configs = map[string]MethodConfig{
+		"write": {MethodName: "write", Enabled: true},
+	}
+	configsLock.Unlock()
+
+	results := make(chan *mcp.CallToolResult, 1)
+	go func() {
+		res, _ := consentProxyHandler(context.Background(), mcp.CallToolRequest{}, "write")
+		results <- res
+	}()
+
+	// Wait for the call to be queued for approval.
+	for {
+		callQueueLock.Lock()
+		n := len(callQueue)
+		callQueueLock.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	drainPendingCalls()
+
+	select {
+	case res := <-results:
+		if !res.IsError {
+			t.Fatalf("expected an error result, got %+v", res)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("pending call was not released on shutdown")
+	}
+
+	res, _ := consentProxyHandler(context.Background(), mcp.CallToolRequest{}, "write")
+	if !res.IsError {
+		t.Fatal("expected new calls to be rejected after shutdown")
+	}
+}
+
+func TestReloadConfigTogglesApproval(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "config.json")
+	write := func(enabled bool) {
+		t.Helper()
+		data := []byte(`[{"methodName": "write", "enabled": ` + strconv.FormatBool(enabled) + `}]`)
+		if err := os.WriteFile(p, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(true)
+	if err := reloadConfig(p); err != nil {
+		t.Fatal(err)
+	}
+	if !requiresApproval("write", mcp.CallToolRequest{}) {
+		t.Fatal("expected write to require approval")
+	}
+
+	write(false)
+	if err := reloadConfig(p); err != nil {
+		t.Fatal(err)
+	}
+	if requiresApproval("write", mcp.CallToolRequest{}) {
+		t.Fatal("expected write to no longer require approval after reload")
+	}
+}
+
+func TestPendingCallsETagChangesOnEnqueue(t *testing.T) {
+	configsLock.Lock()
+	configs = map[string]MethodConfig{
+		"write": {MethodName: "write", Enabled: true},
+	}
+	configsLock.Unlock()
+
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/pending", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		listPendingCallsJSON(rec, req)
+		return rec
+	}
+
+	empty := get("")
+	etag := empty.Header().Get("ETag")
+	if !strings.HasPrefix(etag, `W/"`) {
+		t.Fatalf("expected a weak ETag, got %q", etag)
+	}
+	if rec := get(etag); rec.Code != http.StatusNotModified {
+		t.Fatalf("expected 304 for an unchanged queue, got %d", rec.Code)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		consentProxyHandler(ctx, mcp.CallToolRequest{Params: mcp.CallToolParams{Name: "write"}}, "write")
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	var rec *httptest.ResponseRecorder
+	for {
+		if rec = get(etag); rec.Code == http.StatusOK {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if rec.Header().Get("ETag") == etag {
+		t.Fatal("expected the ETag to change after a call was enqueued")
+	}
+
+	var calls []struct {
+		Tool       string    `json:"tool"`
+		EnqueuedAt time.Time `json:"enqueued_at"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &calls); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 1 || calls[0].Tool != "write" || calls[0].EnqueuedAt.IsZero() {
+		t.Fatalf("unexpected pending calls: %+v", calls)
+	}
+}
+
+func TestLoadConfigYAMLMatchesJSON(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"config.json": `[{"methodName": "write", "enabled": true}, {"methodName": "read", "enabled": false}]`,
+		"config.yaml": "# Writes need a human.\n- methodName: write\n  enabled: true\n- methodName: read\n  enabled: false\n",
+	}
+	parsed := map[string]map[string]MethodConfig{}
+	for name, data := range files {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cs, err := loadConfig(p)
+		if err != nil {
+			t.Fatalf("failed to load %s: %v", name, err)
+		}
+		parsed[name] = cs
+	}
+
+	if !reflect.DeepEqual(parsed["config.json"], parsed["config.yaml"]) {
+		t.Fatalf("expected identical configs, got %+v and %+v", parsed["config.json"], parsed["config.yaml"])
+	}
+	if !parsed["config.yaml"]["write"].Enabled {
+		t.Fatalf("expected write to be enabled, got %+v", parsed["config.yaml"])
+	}
+}
+
+func TestHandleApprovalUsesForwardTimeout(t *testing.T) {
+	upstream := server.NewMCPServer("slow", "v0.0.1")
+	upstream.AddTool(mcp.NewTool("slow"), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		select {
+		case <-time.After(200 * time.Millisecond):
+			return mcp.NewToolResultText("done"), nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	})
+	c := mcptest.NewClient(t, upstream)
+	prev := mcpClient
+	mcpClient = c
+	defer func() { mcpClient = prev }()
+
+	approve := func(timeout time.Duration) *mcp.CallToolResult {
+		t.Helper()
+		pc := &pendingCall{
+			ID:        1000,
+			Request:   mcp.CallToolRequest{Params: mcp.CallToolParams{Name: "slow"}},
+			ResponseC: make(chan *mcp.CallToolResult, 1),
+		}
+		callQueueLock.Lock()
+		callQueue[pc.ID] = pc
+		callQueueLock.Unlock()
+
+		rec := httptest.NewRecorder()
+		handleApproval(true, timeout)(rec, httptest.NewRequest(http.MethodPost, "/approve?id=1000", nil))
+		return <-pc.ResponseC
+	}
+
+	if res := approve(5 * time.Second); res.IsError {
+		t.Fatalf("expected the slow call to succeed with a generous timeout, got %+v", res)
+	}
+	if res := approve(0); res.IsError {
+		t.Fatalf("expected the slow call to succeed with no timeout, got %+v", res)
+	}
+	if res := approve(20 * time.Millisecond); !res.IsError {
+		t.Fatalf("expected the slow call to fail with a short timeout, got %+v", res)
+	}
+}
+
+func TestListPendingCallsSortedByID(t *testing.T) {
+	callQueueLock.Lock()
+	saved := callQueue
+	callQueue = map[int]*pendingCall{}
+	for _, id := range []int{42, 7, 19, 3, 28} {
+		callQueue[id] = &pendingCall{
+			ID:      id,
+			Request: mcp.CallToolRequest{Params: mcp.CallToolParams{Name: fmt.Sprintf("tool_%d", id)}},
+		}
+	}
+	callQueueLock.Unlock()
+	defer func() {
+		callQueueLock.Lock()
+		callQueue = saved
+		callQueueLock.Unlock()
+	}()
+
+	// Map iteration order is random, so repeat to catch unsorted output.
+	for range 10 {
+		rec := httptest.NewRecorder()
+		listPendingCalls(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		body := rec.Body.String()
+
+		last := -1
+		for _, id := range []int{3, 7, 19, 28, 42} {
+			i := strings.Index(body, fmt.Sprintf("tool_%d", id))
+			if i < last {
+				t.Fatalf("expected calls in ID order, got:\n%s", body)
+			}
+			last = i
+		}
+	}
+}
+
+func TestRejectAllClearsQueue(t *testing.T) {
+	configsLock.Lock()
+	configs = map[string]MethodConfig{
+		"write": {MethodName: "write", Enabled: true},
+	}
+	configsLock.Unlock()
+
+	results := make(chan *mcp.CallToolResult, 3)
+	for range 3 {
+		go func() {
+			res, _ := consentProxyHandler(context.Background(), mcp.CallToolRequest{Params: mcp.CallToolParams{Name: "write"}}, "write")
+			results <- res
+		}()
+	}
+	for len(sortedPendingCalls()) != 3 {
+		time.Sleep(time.Millisecond)
+	}
+
+	rec := httptest.NewRecorder()
+	handleApprovalAll(false, 0)(rec, httptest.NewRequest(http.MethodPost, "/reject-all", nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("expected a redirect back to the UI, got %d", rec.Code)
+	}
+
+	for range 3 {
+		select {
+		case res := <-results:
+			if !res.IsError || !strings.Contains(res.Content[0].(mcp.TextContent).Text, "rejected") {
+				t.Fatalf("expected a rejection, got %+v", res)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("pending call was not rejected")
+		}
+	}
+	if n := len(sortedPendingCalls()); n != 0 {
+		t.Fatalf("expected an empty queue, got %d calls", n)
+	}
+}
+
+func TestApprovalQueueReportsDepth(t *testing.T) {
+	configsLock.Lock()
+	configs = map[string]MethodConfig{
+		"write":  {MethodName: "write", Enabled: true},
+		"delete": {MethodName: "delete", Enabled: true},
+	}
+	configsLock.Unlock()
+
+	s := server.NewMCPServer("test", "dev")
+	addApprovalQueueTool(s, nil)
+	c, err := client.NewInProcessClient(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := c.Initialize(context.Background(), mcp.InitializeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	depth := func() queueStatus {
+		t.Helper()
+		res, err := c.CallTool(context.Background(), mcp.CallToolRequest{Params: mcp.CallToolParams{Name: "approval_queue"}})
+		if err != nil || res.IsError {
+			t.Fatalf("approval_queue failed: %v %+v", err, res)
+		}
+		var qs queueStatus
+		if err := json.Unmarshal([]byte(res.Content[0].(mcp.TextContent).Text), &qs); err != nil {
+			t.Fatal(err)
+		}
+		return qs
+	}
+
+	if qs := depth(); qs.Depth != 0 {
+		t.Fatalf("expected an empty queue, got %+v", qs)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for _, tool := range []string{"write", "write", "delete"} {
+		go consentProxyHandler(ctx, mcp.CallToolRequest{Params: mcp.CallToolParams{Name: tool}}, tool)
+	}
+	for len(sortedPendingCalls()) != 3 {
+		time.Sleep(time.Millisecond)
+	}
+
+	qs := depth()
+	cancel()
+	for len(sortedPendingCalls()) != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if qs.Depth != 3 || !reflect.DeepEqual(qs.ByTool, map[string]int{"write": 2, "delete": 1}) {
+		t.Fatalf("expected 3 queued calls, got %+v", qs)
+	}
+	if qs := depth(); qs.Depth != 0 {
+		t.Fatalf("expected an empty queue once the calls were cancelled, got %+v", qs)
+	}
+}
+
+func TestApprovalQueueKeepsUpstreamToolReachable(t *testing.T) {
+	upstream := server.ServerTool{
+		Tool: mcp.NewTool("approval_queue"),
+		Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultText("upstream"), nil
+		},
+	}
+	s := mcptest.NewFakeUpstream(upstream)
+	addApprovalQueueTool(s, []mcp.Tool{upstream.Tool})
+	c := mcptest.NewClient(t, s)
+
+	if got := mcptest.ResultText(mcptest.CallTool(t, c, "approval_queue", nil)); got != "upstream" {
+		t.Fatalf("expected the upstream's approval_queue to stay reachable, got %q", got)
+	}
+	if res := mcptest.CallTool(t, c, "__approval_queue", nil); res.IsError || !strings.Contains(mcptest.ResultText(res), "depth") {
+		t.Fatalf("expected the proxy's queue under __approval_queue, got %+v", res)
+	}
+}
+
+func TestDecidedCallsAppearInHistory(t *testing.T) {
+	historyLock.Lock()
+	saved, savedSize := history, historySize
+	history, historySize = nil, 2
+	historyLock.Unlock()
+	defer func() {
+		historyLock.Lock()
+		history, historySize = saved, savedSize
+		historyLock.Unlock()
+	}()
+
+	for id := 1; id <= 3; id++ {
+		pc := &pendingCall{
+			ID:        id,
+			Request:   mcp.CallToolRequest{Params: mcp.CallToolParams{Name: fmt.Sprintf("tool_%d", id), Arguments: map[string]any{"n": id}}},
+			ResponseC: make(chan *mcp.CallToolResult, 1),
+		}
+		resolveCall(pc, false, 0)
+	}
+
+	rec := httptest.NewRecorder()
+	listHistoryJSON(rec, httptest.NewRequest(http.MethodGet, "/api/history", nil))
+	var decided []decidedCall
+	if err := json.Unmarshal(rec.Body.Bytes(), &decided); err != nil {
+		t.Fatal(err)
+	}
+	if len(decided) != 2 || decided[0].ID != 3 || decided[1].ID != 2 {
+		t.Fatalf("expected the 2 most recent decisions, newest first, got %+v", decided)
+	}
+	if d := decided[0]; d.Tool != "tool_3" || d.Decision != "rejected" || d.DecidedAt.IsZero() || !reflect.DeepEqual(d.Arguments, map[string]any{"n": float64(3)}) {
+		t.Fatalf("unexpected decision: %+v", d)
+	}
+
+	rec = httptest.NewRecorder()
+	listPendingCalls(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if body := rec.Body.String(); !strings.Contains(body, "tool_3") || !strings.Contains(body, "rejected") || strings.Contains(body, "tool_1") {
+		t.Fatalf("expected the UI to list recent decisions, got:\n%s", body)
+	}
+}
+
+func TestReloadConfigFromEnv(t *testing.T) {
+	t.Setenv("TEST_HITL_CONFIG", `[{"methodName": "write", "enabled": true}]`)
+	if err := reloadConfigEnv("TEST_HITL_CONFIG"); err != nil {
+		t.Fatal(err)
+	}
+	if !requiresApproval("write", mcp.CallToolRequest{}) {
+		t.Fatal("expected write to require approval")
+	}
+	if err := reloadConfigEnv("TEST_HITL_CONFIG_UNSET"); err == nil {
+		t.Fatal("expected an unset variable to fail loading")
+	}
+}
+
+func TestPassThroughFailureHasErrorCode(t *testing.T) {
+	upstream := server.NewMCPServer("broken", "v0.0.1")
+	upstream.AddTool(mcp.NewTool("read"), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return nil, errors.New("disk on fire")
+	})
+	c := mcptest.NewClient(t, upstream)
+	prev := mcpClient
+	mcpClient = c
+	defer func() { mcpClient = prev }()
+	setConfig("test", map[string]MethodConfig{})
+
+	res, err := consentProxyHandler(context.Background(), mcp.CallToolRequest{Params: mcp.CallToolParams{Name: "read"}}, "read")
+	if err != nil {
+		t.Fatalf("expected the failure as a tool result, got error %v", err)
+	}
+	if structured, _ := res.StructuredContent.(map[string]any); !res.IsError || structured["code"] == nil {
+		t.Fatalf("expected a forward error with a code, got %+v", res)
+	}
+}
+
+func TestApprovalConditionGatesQueue(t *testing.T) {
+	upstream := server.NewMCPServer("bank", "v0.0.1")
+	upstream.AddTool(mcp.NewTool("pay"), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("paid"), nil
+	})
+	c := mcptest.NewClient(t, upstream)
+	prev := mcpClient
+	mcpClient = c
+	defer func() { mcpClient = prev }()
+
+	cs, err := configsByName([]MethodConfig{{MethodName: "pay", Enabled: true, Condition: "args.amount > 1000"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	setConfig("test", cs)
+	pay := func(amount float64) mcp.CallToolRequest {
+		return mcp.CallToolRequest{Params: mcp.CallToolParams{Name: "pay", Arguments: map[string]any{"amount": amount}}}
+	}
+
+	res, err := consentProxyHandler(context.Background(), pay(50), "pay")
+	if err != nil || res.IsError {
+		t.Fatalf("expected the small payment to be forwarded, got %+v, %v", res, err)
+	}
+	callQueueLock.Lock()
+	queued := len(callQueue)
+	callQueueLock.Unlock()
+	if queued != 0 {
+		t.Fatalf("expected the small payment to skip the queue, got %d queued", queued)
+	}
+
+	done := make(chan *mcp.CallToolResult, 1)
+	go func() {
+		res, _ := consentProxyHandler(context.Background(), pay(5000), "pay")
+		done <- res
+	}()
+	var pc *pendingCall
+	for deadline := time.Now().Add(time.Second); pc == nil; {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the large payment to be queued")
+		}
+		callQueueLock.Lock()
+		for _, p := range callQueue {
+			pc = p
+		}
+		callQueueLock.Unlock()
+		time.Sleep(5 * time.Millisecond)
+	}
+	callQueueLock.Lock()
+	delete(callQueue, pc.ID)
+	callQueueLock.Unlock()
+	pc.ResponseC <- mcp.NewToolResultError("rejected")
+	if res := <-done; !res.IsError {
+		t.Fatalf("expected the rejection to be returned, got %+v", res)
+	}
+
+	if _, err := configsByName([]MethodConfig{{MethodName: "pay", Enabled: true, Condition: "args.amount >"}}); err == nil {
+		t.Fatal("expected a malformed condition to be rejected")
+	}
+}
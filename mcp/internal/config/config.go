@@ -0,0 +1,58 @@
+// Package config reads the config files and environment variables the MCP
+// proxies in this repository are set up from.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrStdin is returned for a config path of "-". Stdin carries the MCP
+// protocol, so config can't be read from it.
+var ErrStdin = errors.New("can't read config from stdin as it carries the MCP protocol; use an environment variable instead")
+
+// ReadFile decodes the config file at p into v, as YAML when p has a .yaml
+// or .yml extension and as JSON otherwise.
+func ReadFile(p string, v any) error {
+	if p == "-" {
+		return ErrStdin
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	if err := unmarshal(p, data, v); err != nil {
+		return fmt.Errorf("failed to unmarshal %s: %w", p, err)
+	}
+	return nil
+}
+
+// ReadEnv decodes the environment variable name into v, so config can be
+// injected as a secret instead of mounted as a file. YAML is a superset of
+// JSON, so the value may be in either format.
+func ReadEnv(name string, v any) error {
+	data, ok := os.LookupEnv(name)
+	if !ok {
+		return fmt.Errorf("environment variable %s is not set", name)
+	}
+	if err := yaml.Unmarshal([]byte(data), v); err != nil {
+		return fmt.Errorf("failed to unmarshal %s: %w", name, err)
+	}
+	return nil
+}
+
+// unmarshal decodes data as YAML when p has a .yaml or .yml extension and as
+// JSON otherwise.
+func unmarshal(p string, data []byte, v any) error {
+	switch filepath.Ext(p) {
+	case ".yaml", ".yml":
+		return yaml.Unmarshal(data, v)
+	default:
+		return json.Unmarshal(data, v)
+	}
+}
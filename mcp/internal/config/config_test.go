@@ -0,0 +1,53 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadFileYAMLMatchesJSON(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"config.json": `[{"methodName": "write", "enabled": true}]`,
+		"config.yaml": "# Writes need a human.\n- methodName: write\n  enabled: true\n",
+	}
+	parsed := map[string]any{}
+	for name, data := range files {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		var v any
+		if err := ReadFile(p, &v); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		parsed[name] = v
+	}
+	if !reflect.DeepEqual(parsed["config.json"], parsed["config.yaml"]) {
+		t.Fatalf("expected identical configs, got %+v and %+v", parsed["config.json"], parsed["config.yaml"])
+	}
+
+	if err := ReadFile("-", new(any)); !errors.Is(err, ErrStdin) {
+		t.Fatalf("expected stdin to be refused, got %v", err)
+	}
+}
+
+func TestReadEnvAcceptsJSONAndYAML(t *testing.T) {
+	for _, data := range []string{`{"write": "args.path != ''"}`, "write: args.path != ''\n"} {
+		t.Setenv("TEST_CONFIG", data)
+		var c map[string]string
+		if err := ReadEnv("TEST_CONFIG", &c); err != nil {
+			t.Fatal(err)
+		}
+		if c["write"] != "args.path != ''" {
+			t.Fatalf("expected the write constraint from %q, got %+v", data, c)
+		}
+	}
+
+	if err := ReadEnv("TEST_CONFIG_UNSET", new(any)); err == nil {
+		t.Fatal("expected an unset variable to fail")
+	}
+}
@@ -0,0 +1,95 @@
+// Package constraint compiles and evaluates the CEL expressions the MCP
+// proxies in this repository use to decide what to do with a tool call.
+package constraint
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// newEnv returns the CEL environment constraints are compiled in. It is
+// built once and shared.
+var newEnv = sync.OnceValues(func() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable("args", cel.DynType),
+		cel.Variable("tool", cel.StringType),
+		cel.Variable("caller", cel.StringType),
+	)
+})
+
+// programs caches compiled constraints by expression, so those checked at
+// startup aren't compiled again for every call.
+var programs sync.Map // string -> cel.Program
+
+// Compile checks constraintExpr and returns it as a program over args, tool
+// and caller. An expression that can't evaluate to a boolean, such as
+// args.x + 1, is rejected here rather than failing every call at runtime.
+func Compile(constraintExpr string) (cel.Program, error) {
+	if prg, ok := programs.Load(constraintExpr); ok {
+		return prg.(cel.Program), nil
+	}
+
+	env, err := newEnv()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CEL env: %w", err)
+	}
+
+	ast, issues := env.Compile(constraintExpr)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("failed to compile CEL: %w", issues.Err())
+	}
+	if out := ast.OutputType(); !out.IsExactType(cel.BoolType) && !out.IsExactType(cel.DynType) {
+		return nil, fmt.Errorf("CEL constraint must return a boolean, not %s", out)
+	}
+
+	prg, err := env.Program(ast)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CEL program: %w", err)
+	}
+	programs.Store(constraintExpr, prg)
+	return prg, nil
+}
+
+// Eval runs the constraint with the call's arguments as args, the tool name
+// as tool, and the caller identity from the request's _meta.caller as caller
+// (empty if not set). An empty constraint always passes.
+func Eval(constraintExpr, tool, caller string, args map[string]any) (bool, error) {
+	if constraintExpr == "" {
+		return true, nil
+	}
+
+	prg, err := Compile(constraintExpr)
+	if err != nil {
+		return false, err
+	}
+
+	out, _, err := prg.Eval(map[string]any{
+		"args":   args,
+		"tool":   tool,
+		"caller": caller,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to evaluate CEL expression: %w", err)
+	}
+
+	// Expecting the output to be a boolean (true/false)
+	boolVal, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("CEL constraint did not return a boolean: got %T", out.Value())
+	}
+
+	return boolVal, nil
+}
+
+// CallerFromMeta returns the caller identity a client put in the request's
+// _meta, if any.
+func CallerFromMeta(meta *mcp.Meta) string {
+	if meta == nil {
+		return ""
+	}
+	caller, _ := meta.AdditionalFields["caller"].(string)
+	return caller
+}
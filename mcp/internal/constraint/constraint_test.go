@@ -0,0 +1,56 @@
+package constraint
+
+import (
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestEvalReferencesToolAndCaller(t *testing.T) {
+	expr := "!(tool == 'delete_db' && caller != 'admin')"
+	for _, tc := range []struct {
+		tool, caller string
+		want         bool
+	}{
+		{"delete_db", "agent", false},
+		{"delete_db", "admin", true},
+		{"read_db", "agent", true},
+	} {
+		got, err := Eval(expr, tc.tool, tc.caller, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("tool=%s caller=%s: got %v, want %v", tc.tool, tc.caller, got, tc.want)
+		}
+	}
+
+	// Expressions that only use args keep working.
+	ok, err := Eval("args.path != ''", "read_db", "", map[string]any{"path": "/tmp"})
+	if err != nil || !ok {
+		t.Fatalf("expected args-only expression to pass, got %v, %v", ok, err)
+	}
+}
+
+func TestCompileRejectsNonBooleanConstraints(t *testing.T) {
+	for _, expr := range []string{"args.x + 1", "tool", "caller.size()"} {
+		if _, err := Compile(expr); err == nil {
+			t.Errorf("expected %q to be rejected as non-boolean", expr)
+		}
+	}
+	for _, expr := range []string{"args.x", "args.x > 1", "tool == 'read_db'"} {
+		if _, err := Compile(expr); err != nil {
+			t.Errorf("expected %q to compile: %v", expr, err)
+		}
+	}
+}
+
+func TestCallerFromMeta(t *testing.T) {
+	if got := CallerFromMeta(nil); got != "" {
+		t.Fatalf("expected no caller, got %q", got)
+	}
+	meta := &mcp.Meta{AdditionalFields: map[string]any{"caller": "admin"}}
+	if got := CallerFromMeta(meta); got != "admin" {
+		t.Fatalf("expected admin, got %q", got)
+	}
+}
@@ -0,0 +1,38 @@
+// Package logging sets up the slog output shared by the MCP proxies in this
+// repository.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+)
+
+// Setup makes slog write lines at level and above to w. level is one
+// of debug, info, warn or error. Whatever still goes through the log package,
+// such as log.Fatal, is logged at error level so it is never suppressed.
+func Setup(w io.Writer, level string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q: want debug, info, warn or error", level)
+	}
+	slog.SetDefault(New(w, l))
+	slog.SetLogLoggerLevel(slog.LevelError)
+	log.SetFlags(0)
+	return nil
+}
+
+// New returns a logger writing text lines at level and above to w,
+// without timestamps.
+func New(w io.Writer, level slog.Level) *slog.Logger {
+	return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey && len(groups) == 0 {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+}
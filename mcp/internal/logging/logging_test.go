@@ -0,0 +1,37 @@
+package logging
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSetupFiltersByLevel(t *testing.T) {
+	defer func(l *slog.Logger, w io.Writer) {
+		slog.SetDefault(l)
+		log.SetOutput(w)
+	}(slog.Default(), log.Writer())
+
+	var buf bytes.Buffer
+	if err := Setup(&buf, "info"); err != nil {
+		t.Fatal(err)
+	}
+	slog.Debug("registered tool", "tool", "echo")
+	slog.Info("running")
+	slog.Warn("mirror failed")
+
+	got := buf.String()
+	if strings.Contains(got, "registered tool") {
+		t.Fatalf("expected debug lines to be suppressed at info level, got %q", got)
+	}
+	if want := "level=INFO msg=running\nlevel=WARN msg=\"mirror failed\"\n"; got != want {
+		t.Fatalf("unexpected log output:\ngot  %q\nwant %q", got, want)
+	}
+
+	if err := Setup(&buf, "verbose"); err == nil {
+		t.Fatal("expected an unknown level to be rejected")
+	}
+}
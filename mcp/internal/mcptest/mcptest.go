@@ -0,0 +1,124 @@
+// Package mcptest runs MCP servers in process for the tests of the MCP
+// proxies in this repository.
+package mcptest
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// NewClient returns an initialized client connected to srv without any
+// stdio plumbing. It is closed when the test ends.
+func NewClient(t *testing.T, srv *server.MCPServer) *client.Client {
+	t.Helper()
+	c := client.NewClient(transport.NewInProcessTransport(srv))
+	if err := c.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Initialize(context.Background(), mcp.InitializeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// NewFakeUpstream returns a server exposing tools, to stand in for the
+// upstream a proxy wraps.
+func NewFakeUpstream(tools ...server.ServerTool) *server.MCPServer {
+	srv := server.NewMCPServer("fake-upstream", "test")
+	srv.AddTools(tools...)
+	return srv
+}
+
+// EchoTool returns its "message" argument as text.
+func EchoTool() server.ServerTool {
+	return server.ServerTool{
+		Tool: mcp.NewTool("echo", mcp.WithString("message")),
+		Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultText(req.GetString("message", "")), nil
+		},
+	}
+}
+
+// CallTool calls the named tool and fails the test if the call itself fails.
+func CallTool(t *testing.T, c *client.Client, name string, args map[string]any) *mcp.CallToolResult {
+	t.Helper()
+	res, err := c.CallTool(context.Background(), mcp.CallToolRequest{
+		Request: mcp.Request{Method: "tools/call"},
+		Params: mcp.CallToolParams{
+			Name:      name,
+			Arguments: args,
+		},
+	})
+	if err != nil {
+		t.Fatalf("%s failed: %v", name, err)
+	}
+	return res
+}
+
+// ResultText returns the text of res's first content, or "" if it has none.
+func ResultText(res *mcp.CallToolResult) string {
+	if len(res.Content) == 0 {
+		return ""
+	}
+	text, _ := res.Content[0].(mcp.TextContent)
+	return text.Text
+}
+
+// CheckPreservesToolDefinitions fails the test unless a tool with
+// annotations and input and output schemas comes out of a proxy exactly as
+// the upstream defined it. register adds the proxy's tools to s, forwarding
+// calls to call. list fetches tool definitions without losing their raw
+// schemas, as proxy.ListUpstreamTools does.
+func CheckPreservesToolDefinitions(t *testing.T, list func(context.Context, *client.Client) ([]mcp.Tool, error), register func(s *server.MCPServer, tools []mcp.Tool, call func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error))) {
+	t.Helper()
+	upstreamTool := server.ServerTool{
+		Tool: mcp.NewToolWithRawSchema("lookup", "Look something up",
+			json.RawMessage(`{"type":"object","properties":{"key":{"type":"string"}},"additionalProperties":false}`)),
+		Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultText("found"), nil
+		},
+	}
+	mcp.WithTitleAnnotation("Lookup")(&upstreamTool.Tool)
+	mcp.WithReadOnlyHintAnnotation(true)(&upstreamTool.Tool)
+	mcp.WithDestructiveHintAnnotation(false)(&upstreamTool.Tool)
+	mcp.WithRawOutputSchema(json.RawMessage(`{"type":"object","properties":{"value":{"type":"string"}}}`))(&upstreamTool.Tool)
+
+	upstream := NewClient(t, NewFakeUpstream(upstreamTool))
+	tools, err := list(context.Background(), upstream)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := server.NewMCPServer("proxy", "test")
+	register(srv, tools, upstream.CallTool)
+	proxied, err := list(context.Background(), NewClient(t, srv))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := json.Marshal(upstreamTool.Tool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tool := range proxied {
+		if tool.Name != upstreamTool.Tool.Name {
+			continue
+		}
+		got, err := json.Marshal(tool)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(want) {
+			t.Fatalf("expected the proxied tool to match upstream:\ngot  %s\nwant %s", got, want)
+		}
+		return
+	}
+	t.Fatalf("expected the proxy to expose %s, got %+v", upstreamTool.Tool.Name, proxied)
+}
@@ -0,0 +1,11 @@
+package mcptest
+
+import "testing"
+
+func TestCallToolOnFakeUpstream(t *testing.T) {
+	c := NewClient(t, NewFakeUpstream(EchoTool()))
+	res := CallTool(t, c, "echo", map[string]any{"message": "hi"})
+	if res.IsError || ResultText(res) != "hi" {
+		t.Fatalf("expected the echo to come back, got %+v", res)
+	}
+}
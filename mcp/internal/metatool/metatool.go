@@ -0,0 +1,60 @@
+// Package metatool registers the tools the MCP servers in this repository
+// add about themselves, alongside their own tools or those of the upstream
+// they proxy.
+package metatool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// FreeName returns name, prefixed with underscores until it matches none of
+// tools. A proxy registers its own tools under the returned name so it
+// doesn't replace an upstream tool of the same name and leave it
+// unreachable. In a chain of proxies each hop adds its own prefix, so every
+// hop's tool stays reachable.
+func FreeName(name string, tools []mcp.Tool) string {
+	taken := make(map[string]bool, len(tools))
+	for _, t := range tools {
+		taken[t.Name] = true
+	}
+	free := name
+	for taken[free] {
+		free = "__" + free
+	}
+	if free != name {
+		slog.Info("upstream has a tool of the same name, registering ours under another name", "tool", name, "name", free)
+	}
+	return free
+}
+
+// AddServerInfo registers a server_info tool reporting this binary's name
+// and version, plus the upstream server's own info when this is a proxy.
+// Chained proxies stamp their version into the MCP server info, so each
+// hop's upstream field identifies the next one. tools are the upstream tools
+// a proxy exposes, and the name is chosen among them with FreeName. It
+// returns the name the tool was registered under.
+func AddServerInfo(s *server.MCPServer, version string, upstream *mcp.Implementation, tools []mcp.Tool) string {
+	name := FreeName("server_info", tools)
+	s.AddTool(mcp.NewTool(name,
+		mcp.WithDescription("Returns the name and version of this MCP server, and of the upstream server it wraps if any."),
+	), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		data, err := json.Marshal(map[string]any{
+			"name":     filepath.Base(os.Args[0]),
+			"version":  version,
+			"upstream": upstream,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal server info: %w", err)
+		}
+		return mcp.NewToolResultText(string(data)), nil
+	})
+	return name
+}
@@ -0,0 +1,40 @@
+package metatool
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/poy/adk-rnd/mcp/internal/mcptest"
+)
+
+func TestServerInfoKeepsUpstreamToolReachable(t *testing.T) {
+	// The upstream is itself a proxy with a server_info tool.
+	tools := []mcp.Tool{mcp.NewTool("echo"), mcp.NewTool("server_info")}
+
+	srv := server.NewMCPServer("proxy", "test")
+	for _, tool := range tools {
+		srv.AddTool(tool, nil)
+	}
+	name := AddServerInfo(srv, "v2", &mcp.Implementation{Name: "fake-upstream", Version: "test"}, tools)
+	if name != "__server_info" {
+		t.Fatalf("expected ours to be renamed around the upstream's, got %q", name)
+	}
+
+	c := mcptest.NewClient(t, srv)
+	var info struct {
+		Version  string
+		Upstream mcp.Implementation
+	}
+	if err := json.Unmarshal([]byte(mcptest.ResultText(mcptest.CallTool(t, c, name, nil))), &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Version != "v2" || info.Upstream.Name != "fake-upstream" {
+		t.Fatalf("expected this hop's info under %s, got %+v", name, info)
+	}
+
+	if got := AddServerInfo(server.NewMCPServer("standalone", "test"), "v1", nil, nil); got != "server_info" {
+		t.Fatalf("expected server_info without an upstream, got %q", got)
+	}
+}
@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// ErrCircuitOpen is returned for calls rejected while the circuit is open.
+var ErrCircuitOpen = errors.New("upstream circuit open")
+
+// circuitBreaker stops forwarding calls to an upstream that keeps failing.
+// After threshold consecutive failures the circuit opens and calls fail
+// immediately. Once cooldown has passed a single call is let through as a
+// probe: if it succeeds the circuit closes, otherwise it stays open for
+// another cooldown.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// BreakCircuit wraps call in a circuit breaker. A threshold of zero or less
+// leaves call unwrapped.
+func BreakCircuit(call func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error), threshold int, cooldown time.Duration) func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	if threshold <= 0 {
+		return call
+	}
+	b := &circuitBreaker{threshold: threshold, cooldown: cooldown, now: time.Now}
+	return b.wrap(call)
+}
+
+func (b *circuitBreaker) wrap(call func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error)) func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if err := b.allow(); err != nil {
+			return nil, err
+		}
+		res, err := call(ctx, req)
+		b.record(err)
+		return res, err
+	}
+}
+
+// allow reports whether a call may go ahead, claiming the probe slot if the
+// cooldown has passed.
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return nil
+	}
+	if retryIn := b.openedAt.Add(b.cooldown).Sub(b.now()); retryIn > 0 || b.probing {
+		return fmt.Errorf("%w after %d consecutive failures, retrying in %s", ErrCircuitOpen, b.failures, max(retryIn, 0).Round(time.Millisecond))
+	}
+	b.probing = true
+	return nil
+}
+
+// record updates the breaker with a call's outcome. Only failures to reach
+// the upstream count; a JSON-RPC error still means it's up, and a call the
+// client gave up on says nothing either way.
+func (b *circuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	if err == nil || ClassifyError(err) == CodeProtocolError {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openedAt = b.now()
+	}
+}
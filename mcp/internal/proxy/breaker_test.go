@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestCircuitBreakerOpensAndRecovers(t *testing.T) {
+	now := time.Unix(0, 0)
+	upstreamErr := io.EOF
+	calls := 0
+	b := &circuitBreaker{threshold: 2, cooldown: time.Minute, now: func() time.Time { return now }}
+	call := b.wrap(func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		calls++
+		if upstreamErr != nil {
+			return nil, upstreamErr
+		}
+		return mcp.NewToolResultText("ok"), nil
+	})
+
+	// Two consecutive failures open the circuit.
+	for range 2 {
+		if _, err := call(context.Background(), mcp.CallToolRequest{}); !errors.Is(err, io.EOF) {
+			t.Fatalf("expected the upstream error, got %v", err)
+		}
+	}
+	_, err := call(context.Background(), mcp.CallToolRequest{})
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected the circuit to be open, got %v", err)
+	}
+	if calls != 2 {
+		t.Fatalf("expected the open circuit not to reach upstream, got %d calls", calls)
+	}
+	if code := ClassifyError(err); code != CodeUpstreamUnavailable {
+		t.Fatalf("expected %s, got %s", CodeUpstreamUnavailable, code)
+	}
+
+	// After the cooldown a failed probe keeps it open.
+	now = now.Add(time.Minute)
+	if _, err := call(context.Background(), mcp.CallToolRequest{}); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected the probe to reach upstream, got %v", err)
+	}
+	if _, err := call(context.Background(), mcp.CallToolRequest{}); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected the circuit to reopen after a failed probe, got %v", err)
+	}
+
+	// A successful probe closes it.
+	now = now.Add(time.Minute)
+	upstreamErr = nil
+	for range 3 {
+		if _, err := call(context.Background(), mcp.CallToolRequest{}); err != nil {
+			t.Fatalf("expected the circuit to close after a successful probe, got %v", err)
+		}
+	}
+}
+
+func TestCircuitBreakerIgnoresProtocolErrors(t *testing.T) {
+	call := BreakCircuit(func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return nil, errors.New("invalid params")
+	}, 1, time.Minute)
+
+	for range 3 {
+		if _, err := call(context.Background(), mcp.CallToolRequest{}); errors.Is(err, ErrCircuitOpen) {
+			t.Fatal("expected protocol errors not to open the circuit")
+		}
+	}
+}
@@ -0,0 +1,3 @@
+// Package proxy holds the call wrappers, upstream helpers and tools about the
+// upstream shared by the MCP proxies in this repository.
+package proxy
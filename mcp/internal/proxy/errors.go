@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Codes reported in the structured content of ForwardError results.
+const (
+	CodeUpstreamUnavailable = "upstream_unavailable"
+	CodeTimeout             = "timeout"
+	CodeProtocolError       = "protocol_error"
+	CodeTooLarge            = "too_large"
+)
+
+// ClassifyError maps a failed upstream call to an error code. Failures to
+// reach the upstream at all are upstream_unavailable and calls over a size
+// limit are too_large; anything else, such as a JSON-RPC error or a
+// malformed response, is a protocol_error.
+func ClassifyError(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return CodeTimeout
+	case errors.Is(err, ErrArgsTooLarge), errors.Is(err, ErrResultTooLarge):
+		return CodeTooLarge
+	case errors.Is(err, ErrCircuitOpen), errors.As(err, new(*transport.Error)), errors.Is(err, io.EOF), errors.Is(err, io.ErrClosedPipe), errors.Is(err, syscall.EPIPE):
+		return CodeUpstreamUnavailable
+	default:
+		return CodeProtocolError
+	}
+}
+
+// ForwardError builds the error result for a failed upstream call, with a
+// machine-readable code alongside the message.
+func ForwardError(err error) *mcp.CallToolResult {
+	code := ClassifyError(err)
+	res := mcp.NewToolResultStructured(map[string]any{
+		"code":  code,
+		"error": err.Error(),
+	}, fmt.Sprintf("forward error (%s): %v", code, err))
+	res.IsError = true
+	return res
+}
@@ -0,0 +1,27 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/client/transport"
+)
+
+func TestClassifyError(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want string
+	}{
+		{transport.NewError(fmt.Errorf("waiting: %w", context.DeadlineExceeded)), CodeTimeout},
+		{transport.NewError(errors.New("failed to write request: broken pipe")), CodeUpstreamUnavailable},
+		{io.EOF, CodeUpstreamUnavailable},
+		{errors.New("Method not found"), CodeProtocolError},
+	} {
+		if got := ClassifyError(tc.err); got != tc.want {
+			t.Errorf("ClassifyError(%v) = %q, want %q", tc.err, got, tc.want)
+		}
+	}
+}
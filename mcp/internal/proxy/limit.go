@@ -0,0 +1,32 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"golang.org/x/sync/semaphore"
+)
+
+// LimitCalls wraps call so at most max calls run at once. Calls over the
+// limit wait for a slot, or fail immediately if failFast is set. A max of
+// zero or less leaves call unlimited.
+func LimitCalls(call func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error), max int64, failFast bool) func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	if max <= 0 {
+		return call
+	}
+
+	sem := semaphore.NewWeighted(max)
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if failFast {
+			if !sem.TryAcquire(1) {
+				return nil, fmt.Errorf("too many concurrent calls (limit %d)", max)
+			}
+		} else if err := sem.Acquire(ctx, 1); err != nil {
+			return nil, fmt.Errorf("waiting for a concurrency slot: %w", err)
+		}
+		defer sem.Release(1)
+
+		return call(ctx, req)
+	}
+}
@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestLimitCalls(t *testing.T) {
+	for _, failFast := range []bool{false, true} {
+		started := make(chan struct{}, 2)
+		release := make(chan struct{})
+		call := LimitCalls(func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			started <- struct{}{}
+			<-release
+			return mcp.NewToolResultText("ok"), nil
+		}, 1, failFast)
+
+		first := make(chan error, 1)
+		go func() {
+			_, err := call(context.Background(), mcp.CallToolRequest{})
+			first <- err
+		}()
+		<-started
+
+		second := make(chan error, 1)
+		go func() {
+			_, err := call(context.Background(), mcp.CallToolRequest{})
+			second <- err
+		}()
+
+		if failFast {
+			if err := <-second; err == nil {
+				t.Fatal("expected the call over the limit to be rejected")
+			}
+			close(release)
+		} else {
+			select {
+			case <-started:
+				t.Fatal("expected the call over the limit to wait")
+			case <-time.After(50 * time.Millisecond):
+			}
+			close(release)
+			if err := <-second; err != nil {
+				t.Fatalf("queued call failed: %v", err)
+			}
+		}
+
+		if err := <-first; err != nil {
+			t.Fatalf("first call failed: %v", err)
+		}
+	}
+}
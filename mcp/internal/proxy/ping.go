@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/poy/adk-rnd/mcp/internal/metatool"
+)
+
+// pingTimeout bounds how long ping_upstream waits for the upstream to answer.
+const pingTimeout = 5 * time.Second
+
+// AddPingUpstreamTool registers a ping_upstream tool that sends an MCP ping
+// to the upstream and reports whether it answered and how long it took. In a
+// chain of proxies, calling it at each hop shows which one is broken. The
+// name is chosen among the upstream's tools with metatool.FreeName.
+func AddPingUpstreamTool(s *server.MCPServer, ping func(context.Context) error, tools []mcp.Tool) {
+	s.AddTool(mcp.NewTool(metatool.FreeName("ping_upstream", tools),
+		mcp.WithDescription("Pings the upstream server this proxy wraps and returns whether it answered and the round-trip latency."),
+	), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+		defer cancel()
+
+		start := time.Now()
+		err := ping(ctx)
+		result := map[string]any{
+			"ok":         err == nil,
+			"latency_ms": float64(time.Since(start).Microseconds()) / 1000,
+		}
+		if err != nil {
+			result["code"] = ClassifyError(err)
+			result["error"] = err.Error()
+		}
+
+		data, merr := json.Marshal(result)
+		if merr != nil {
+			return nil, fmt.Errorf("failed to marshal ping result: %w", merr)
+		}
+		res := mcp.NewToolResultText(string(data))
+		res.IsError = err != nil
+		return res, nil
+	})
+}
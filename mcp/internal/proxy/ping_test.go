@@ -0,0 +1,45 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/poy/adk-rnd/mcp/internal/mcptest"
+)
+
+func TestPingUpstream(t *testing.T) {
+	upstream := mcptest.NewClient(t, mcptest.NewFakeUpstream(mcptest.EchoTool()))
+
+	srv := server.NewMCPServer("proxy", "test")
+	AddPingUpstreamTool(srv, upstream.Ping, nil)
+	c := mcptest.NewClient(t, srv)
+
+	var got struct {
+		OK        bool    `json:"ok"`
+		LatencyMS float64 `json:"latency_ms"`
+	}
+	res := mcptest.CallTool(t, c, "ping_upstream", nil)
+	if err := json.Unmarshal([]byte(mcptest.ResultText(res)), &got); err != nil {
+		t.Fatal(err)
+	}
+	if res.IsError || !got.OK || got.LatencyMS < 0 {
+		t.Fatalf("expected a successful ping, got %s", mcptest.ResultText(res))
+	}
+
+	broken := server.NewMCPServer("proxy", "test")
+	AddPingUpstreamTool(broken, func(context.Context) error { return io.EOF }, nil)
+	res = mcptest.CallTool(t, mcptest.NewClient(t, broken), "ping_upstream", nil)
+	var failed struct {
+		OK   bool   `json:"ok"`
+		Code string `json:"code"`
+	}
+	if err := json.Unmarshal([]byte(mcptest.ResultText(res)), &failed); err != nil {
+		t.Fatal(err)
+	}
+	if !res.IsError || failed.OK || failed.Code != CodeUpstreamUnavailable {
+		t.Fatalf("expected a failed ping, got %s", mcptest.ResultText(res))
+	}
+}
@@ -0,0 +1,37 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/poy/adk-rnd/mcp/internal/metatool"
+)
+
+// AddListProxiedToolsTool registers a list_proxied_tools tool reporting the
+// upstream tools this proxy forwards. Unlike tools/list it leaves out the
+// proxy's own tools, which makes it easier to see what a chain of proxies
+// ultimately exposes. The name is chosen among tools with
+// metatool.FreeName.
+func AddListProxiedToolsTool(s *server.MCPServer, tools []mcp.Tool) {
+	type proxiedTool struct {
+		Name        string `json:"name"`
+		Description string `json:"description,omitempty"`
+	}
+	proxied := make([]proxiedTool, len(tools))
+	for i, t := range tools {
+		proxied[i] = proxiedTool{Name: t.Name, Description: t.Description}
+	}
+
+	s.AddTool(mcp.NewTool(metatool.FreeName("list_proxied_tools", tools),
+		mcp.WithDescription("Returns the names and descriptions of the upstream tools this proxy forwards."),
+	), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		data, err := json.Marshal(proxied)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal proxied tools: %w", err)
+		}
+		return mcp.NewToolResultText(string(data)), nil
+	})
+}
@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/poy/adk-rnd/mcp/internal/mcptest"
+	"github.com/poy/adk-rnd/mcp/internal/metatool"
+)
+
+func TestListProxiedToolsReflectsUpstream(t *testing.T) {
+	upstream := mcptest.NewClient(t, mcptest.NewFakeUpstream(mcptest.EchoTool(), server.ServerTool{
+		Tool: mcp.NewTool("shout", mcp.WithDescription("Echoes loudly.")),
+		Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultText("!"), nil
+		},
+	}))
+	tools, err := ListUpstreamTools(context.Background(), upstream)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := server.NewMCPServer("proxy", "test")
+	for _, tool := range tools {
+		srv.AddTool(tool, upstream.CallTool)
+	}
+	metatool.AddServerInfo(srv, "test", nil, tools)
+	AddListProxiedToolsTool(srv, tools)
+	c := mcptest.NewClient(t, srv)
+
+	var listed []struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+	if err := json.Unmarshal([]byte(mcptest.ResultText(mcptest.CallTool(t, c, "list_proxied_tools", nil))), &listed); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, tool := range listed {
+		got[tool.Name] = tool.Description
+	}
+	if len(got) != 2 || got["shout"] != "Echoes loudly." {
+		t.Fatalf("expected only the upstream echo and shout tools, got %+v", listed)
+	}
+	if _, ok := got["echo"]; !ok {
+		t.Fatalf("expected echo to be listed, got %+v", listed)
+	}
+}
@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Errors returned by LimitSizes for calls over a limit.
+var (
+	ErrArgsTooLarge   = errors.New("arguments too large")
+	ErrResultTooLarge = errors.New("upstream result too large")
+)
+
+// LimitSizes wraps call to reject requests whose arguments encode to more
+// than maxArgs bytes of JSON, and upstream results that encode to more than
+// maxResult bytes. A limit of zero or less disables that check.
+func LimitSizes(call func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error), maxArgs, maxResult int) func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	if maxArgs <= 0 && maxResult <= 0 {
+		return call
+	}
+
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if maxArgs > 0 {
+			args, err := json.Marshal(req.Params.Arguments)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode arguments: %w", err)
+			}
+			if len(args) > maxArgs {
+				return nil, fmt.Errorf("%w: %d bytes, limit is %d", ErrArgsTooLarge, len(args), maxArgs)
+			}
+		}
+
+		res, err := call(ctx, req)
+		if err != nil || res == nil || maxResult <= 0 {
+			return res, err
+		}
+		out, err := json.Marshal(res)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode result: %w", err)
+		}
+		if len(out) > maxResult {
+			return nil, fmt.Errorf("%w: %d bytes, limit is %d", ErrResultTooLarge, len(out), maxResult)
+		}
+		return res, nil
+	}
+}
@@ -0,0 +1,39 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestLimitSizes(t *testing.T) {
+	upstream := func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText(strings.Repeat("x", req.GetInt("size", 0))), nil
+	}
+	call := LimitSizes(upstream, 100, 200)
+	request := func(args map[string]any) mcp.CallToolRequest {
+		var req mcp.CallToolRequest
+		req.Params.Arguments = args
+		return req
+	}
+
+	if res, err := call(context.Background(), request(map[string]any{"size": 10})); err != nil || res.IsError {
+		t.Fatalf("expected a small result to pass, got %+v, %v", res, err)
+	}
+
+	_, err := call(context.Background(), request(map[string]any{"size": 1000}))
+	if !errors.Is(err, ErrResultTooLarge) {
+		t.Fatalf("expected the oversized result to be rejected, got %v", err)
+	}
+	if res := ForwardError(err); !res.IsError || !strings.Contains(res.Content[0].(mcp.TextContent).Text, CodeTooLarge) {
+		t.Fatalf("expected a too_large error result, got %+v", res)
+	}
+
+	_, err = call(context.Background(), request(map[string]any{"padding": strings.Repeat("x", 200)}))
+	if !errors.Is(err, ErrArgsTooLarge) {
+		t.Fatalf("expected the oversized arguments to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SetupTracing exports spans over OTLP/HTTP when OTEL_EXPORTER_OTLP_ENDPOINT
+// or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is set, configured by the standard
+// OTEL_* variables. Otherwise the global tracer stays a no-op. The returned
+// function flushes pending spans.
+func SetupTracing(ctx context.Context, serviceName string) (func(context.Context) error, error) {
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", serviceName)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build trace resource: %w", err)
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return tp.Shutdown, nil
+}
+
+// TraceCalls wraps call so each call runs in a span named after the tool,
+// marked as an error if the call fails or the tool reports one. The span's
+// context is passed upstream in the request's _meta as traceparent (and
+// tracestate), so an upstream that understands it can continue the trace.
+func TraceCalls(tracer trace.Tracer, call func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error)) func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		ctx, span := tracer.Start(ctx, "tools/call "+req.Params.Name,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attribute.String("mcp.tool.name", req.Params.Name)),
+		)
+		defer span.End()
+
+		carrier := propagation.MapCarrier{}
+		otel.GetTextMapPropagator().Inject(ctx, carrier)
+		if len(carrier) > 0 {
+			// Copy the meta so the caller's request isn't modified.
+			meta := &mcp.Meta{AdditionalFields: map[string]any{}}
+			if req.Params.Meta != nil {
+				meta.ProgressToken = req.Params.Meta.ProgressToken
+				for k, v := range req.Params.Meta.AdditionalFields {
+					meta.AdditionalFields[k] = v
+				}
+			}
+			for k, v := range carrier {
+				meta.AdditionalFields[k] = v
+			}
+			req.Params.Meta = meta
+		}
+
+		res, err := call(ctx, req)
+		switch {
+		case err != nil:
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		case res != nil && res.IsError:
+			span.SetStatus(codes.Error, "tool returned an error")
+		}
+		return res, err
+	}
+}
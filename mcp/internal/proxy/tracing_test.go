@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTraceCallsRecordsSpans(t *testing.T) {
+	prev := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTextMapPropagator(prev)
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer tp.Shutdown(context.Background())
+
+	var gotMeta *mcp.Meta
+	call := TraceCalls(tp.Tracer("test"), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		gotMeta = req.Params.Meta
+		if req.Params.Name == "broken" {
+			return nil, errors.New("upstream went away")
+		}
+		return mcp.NewToolResultText("ok"), nil
+	})
+
+	if _, err := call(context.Background(), mcp.CallToolRequest{Params: mcp.CallToolParams{Name: "echo"}}); err != nil {
+		t.Fatal(err)
+	}
+	if gotMeta == nil || !strings.HasPrefix(gotMeta.AdditionalFields["traceparent"].(string), "00-") {
+		t.Fatalf("expected traceparent to be passed upstream, got %+v", gotMeta)
+	}
+	if _, err := call(context.Background(), mcp.CallToolRequest{Params: mcp.CallToolParams{Name: "broken"}}); err == nil {
+		t.Fatal("expected the upstream error to be returned")
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	if spans[0].Name != "tools/call echo" || spans[0].Status.Code == codes.Error {
+		t.Fatalf("unexpected span for echo: %+v", spans[0])
+	}
+	if !hasAttribute(spans[0].Attributes, attribute.String("mcp.tool.name", "echo")) {
+		t.Fatalf("expected the tool name attribute, got %v", spans[0].Attributes)
+	}
+	if spans[1].Name != "tools/call broken" || spans[1].Status.Code != codes.Error {
+		t.Fatalf("expected the failed call's span to have error status, got %+v", spans[1])
+	}
+	if !spans[1].EndTime.After(spans[1].StartTime) {
+		t.Fatalf("expected the span to record a duration, got %v to %v", spans[1].StartTime, spans[1].EndTime)
+	}
+}
+
+func hasAttribute(attrs []attribute.KeyValue, want attribute.KeyValue) bool {
+	for _, a := range attrs {
+		if a == want {
+			return true
+		}
+	}
+	return false
+}
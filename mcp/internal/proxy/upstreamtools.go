@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// ListUpstreamTools fetches every upstream tool with its input and output
+// schemas kept verbatim. Decoding into mcp.Tool alone drops the output schema
+// and any input schema keywords it doesn't model, so they would be missing
+// when the tools are re-registered.
+func ListUpstreamTools(ctx context.Context, c *client.Client) ([]mcp.Tool, error) {
+	var (
+		tools  []mcp.Tool
+		cursor mcp.Cursor
+	)
+	for page := 0; ; page++ {
+		var params any
+		if cursor != "" {
+			params = map[string]any{"cursor": cursor}
+		}
+		resp, err := c.GetTransport().SendRequest(ctx, transport.JSONRPCRequest{
+			JSONRPC: mcp.JSONRPC_VERSION,
+			ID:      mcp.NewRequestId(fmt.Sprintf("proxy-tools-list-%d", page)),
+			Method:  string(mcp.MethodToolsList),
+			Params:  params,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if resp.Error != nil {
+			return nil, fmt.Errorf("tools/list failed: %s", resp.Error.Message)
+		}
+
+		var result struct {
+			Tools      []json.RawMessage `json:"tools"`
+			NextCursor mcp.Cursor        `json:"nextCursor"`
+		}
+		if err := json.Unmarshal(resp.Result, &result); err != nil {
+			return nil, fmt.Errorf("failed to decode tools/list result: %w", err)
+		}
+		for _, raw := range result.Tools {
+			tool, err := decodeTool(raw)
+			if err != nil {
+				return nil, err
+			}
+			tools = append(tools, tool)
+		}
+
+		if result.NextCursor == "" {
+			return tools, nil
+		}
+		cursor = result.NextCursor
+	}
+}
+
+// decodeTool decodes a tool from a tools/list result, keeping its schemas
+// as raw JSON so they are re-encoded unchanged.
+func decodeTool(raw json.RawMessage) (mcp.Tool, error) {
+	var tool mcp.Tool
+	if err := json.Unmarshal(raw, &tool); err != nil {
+		return mcp.Tool{}, fmt.Errorf("failed to decode tool: %w", err)
+	}
+	var schemas struct {
+		InputSchema  json.RawMessage `json:"inputSchema"`
+		OutputSchema json.RawMessage `json:"outputSchema"`
+	}
+	if err := json.Unmarshal(raw, &schemas); err != nil {
+		return mcp.Tool{}, fmt.Errorf("failed to decode schemas of tool %s: %w", tool.Name, err)
+	}
+	if len(schemas.InputSchema) > 0 {
+		// mcp.Tool refuses to encode both forms of the input schema.
+		tool.InputSchema = mcp.ToolInputSchema{}
+		tool.RawInputSchema = schemas.InputSchema
+	}
+	if len(schemas.OutputSchema) > 0 {
+		tool.RawOutputSchema = schemas.OutputSchema
+	}
+	return tool, nil
+}
@@ -0,0 +1,33 @@
+package proxy
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDecodeToolKeepsSchemas(t *testing.T) {
+	raw := json.RawMessage(`{"name":"lookup","inputSchema":{"type":"object","properties":{"key":{"type":"string"}},"additionalProperties":false},"outputSchema":{"type":"object","properties":{"value":{"type":"string"}}}}`)
+	tool, err := decodeTool(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := json.Marshal(tool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want, have map[string]any
+	if err := json.Unmarshal(raw, &want); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(got, &have); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"inputSchema", "outputSchema"} {
+		w, _ := json.Marshal(want[key])
+		h, _ := json.Marshal(have[key])
+		if string(w) != string(h) {
+			t.Fatalf("expected %s to be kept verbatim:\ngot  %s\nwant %s", key, h, w)
+		}
+	}
+}
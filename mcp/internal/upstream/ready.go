@@ -0,0 +1,49 @@
+// Package upstream holds what the MCP proxies in this repository share for
+// running their upstream server: launching it, retrying its startup
+// requests, mirroring what it reports about itself and copying its stderr.
+package upstream
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Readiness is how long to wait for a slow-starting upstream to answer.
+type Readiness struct {
+	// Attempts is how many times each startup request is tried.
+	Attempts int
+	// Timeout bounds each attempt, or 0 for no bound. Without one, an
+	// upstream that is slow to answer holds up the first attempt for as long
+	// as it takes, and only errors such as a closed pipe lead to a retry.
+	// Those mean the upstream has exited, so retrying doesn't help either.
+	Timeout time.Duration
+	// Backoff is the pause after the first failed attempt. It doubles after
+	// each further one.
+	Backoff time.Duration
+}
+
+// Retry calls f until it succeeds or r.Attempts calls have failed, logging
+// each retry, and returns the last result.
+func Retry[T any](ctx context.Context, r Readiness, what string, f func(context.Context) (T, error)) (T, error) {
+	backoff := r.Backoff
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if r.Timeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, r.Timeout)
+		}
+		v, err := f(attemptCtx)
+		cancel()
+		if err == nil || attempt >= r.Attempts {
+			return v, err
+		}
+
+		slog.Warn("upstream not ready, retrying", "request", what, "attempt", attempt, "of", r.Attempts, "backoff", backoff, "err", err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return v, ctx.Err()
+		}
+		backoff *= 2
+	}
+}
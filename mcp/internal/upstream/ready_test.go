@@ -0,0 +1,54 @@
+package upstream
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func TestRetryWaitsForSlowUpstream(t *testing.T) {
+	// The upstream refuses to initialize until it has been asked twice.
+	var initializes atomic.Int32
+	hooks := &server.Hooks{}
+	hooks.AddOnRequestInitialization(func(ctx context.Context, id any, message any) error {
+		if raw, ok := message.(json.RawMessage); ok && bytes.Contains(raw, []byte(`"initialize"`)) && initializes.Add(1) < 2 {
+			return errors.New("still starting")
+		}
+		return nil
+	})
+	upstream := server.NewMCPServer("slow-upstream", "test", server.WithHooks(hooks))
+
+	c := client.NewClient(transport.NewInProcessTransport(upstream))
+	if err := c.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ready := Readiness{Attempts: 3, Timeout: time.Second, Backoff: time.Millisecond}
+	res, err := Retry(context.Background(), ready, "initialize", func(ctx context.Context) (*mcp.InitializeResult, error) {
+		return c.Initialize(ctx, mcp.InitializeRequest{})
+	})
+	if err != nil {
+		t.Fatalf("expected initialize to succeed on the second attempt: %v", err)
+	}
+	if n := initializes.Load(); n != 2 || res.ServerInfo.Name != "slow-upstream" {
+		t.Fatalf("expected 2 attempts to reach slow-upstream, got %d and %+v", n, res.ServerInfo)
+	}
+
+	initializes.Store(-10)
+	ready.Attempts = 2
+	if _, err := Retry(context.Background(), ready, "initialize", func(ctx context.Context) (*mcp.InitializeResult, error) {
+		return c.Initialize(ctx, mcp.InitializeRequest{})
+	}); err == nil {
+		t.Fatal("expected an upstream that stays unready to fail once attempts run out")
+	}
+}
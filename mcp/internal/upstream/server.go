@@ -0,0 +1,25 @@
+package upstream
+
+import (
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// NewProxyServer returns the server a proxy presents to clients. If init is
+// nil it is named name, with the given version. Otherwise it mirrors the
+// upstream's name, version, instructions and tool capabilities from init, so
+// clients see the server they are really talking to. In that case server_info
+// is the way to tell the proxy is there. Resources and prompts aren't
+// proxied, so they aren't advertised even if the upstream has them.
+func NewProxyServer(name, version string, init *mcp.InitializeResult, opts ...server.ServerOption) *server.MCPServer {
+	if init == nil || init.ServerInfo.Name == "" {
+		return server.NewMCPServer(name, version, opts...)
+	}
+	if init.Instructions != "" {
+		opts = append(opts, server.WithInstructions(init.Instructions))
+	}
+	if tools := init.Capabilities.Tools; tools != nil {
+		opts = append(opts, server.WithToolCapabilities(tools.ListChanged))
+	}
+	return server.NewMCPServer(init.ServerInfo.Name, init.ServerInfo.Version, opts...)
+}
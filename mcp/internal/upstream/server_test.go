@@ -0,0 +1,39 @@
+package upstream
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func TestProxyServerMirrorsUpstream(t *testing.T) {
+	initialize := func(srv *server.MCPServer) *mcp.InitializeResult {
+		t.Helper()
+		c := client.NewClient(transport.NewInProcessTransport(srv))
+		if err := c.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { c.Close() })
+		res, err := c.Initialize(context.Background(), mcp.InitializeRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	upstream := initialize(server.NewMCPServer("fake-upstream", "1.2.3", server.WithInstructions("use the tools")))
+
+	got := initialize(NewProxyServer("proxy", "0.1.0", upstream))
+	if got.ServerInfo.Name != "fake-upstream" || got.ServerInfo.Version != "1.2.3" || got.Instructions != "use the tools" {
+		t.Fatalf("expected the upstream's server info, got %+v with instructions %q", got.ServerInfo, got.Instructions)
+	}
+
+	got = initialize(NewProxyServer("proxy", "0.1.0", nil))
+	if got.ServerInfo.Name != "proxy" || got.ServerInfo.Version != "0.1.0" {
+		t.Fatalf("expected the proxy's own server info, got %+v", got.ServerInfo)
+	}
+}
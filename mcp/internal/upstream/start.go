@@ -0,0 +1,24 @@
+package upstream
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/mark3labs/mcp-go/client"
+)
+
+// Start launches the upstream MCP server over stdio. Failures report the
+// path, arguments and working directory that were tried.
+func Start(upstreamPath string, args []string) (*client.Client, error) {
+	wd, _ := os.Getwd()
+	resolved, err := exec.LookPath(upstreamPath)
+	if err != nil {
+		return nil, fmt.Errorf("upstream %q is not an executable file (args: %q, working dir: %q): %w", upstreamPath, args, wd, err)
+	}
+	c, err := client.NewStdioMCPClient(resolved, nil, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run upstream %q (resolved to %q, args: %q, working dir: %q): %w", upstreamPath, resolved, args, wd, err)
+	}
+	return c, nil
+}
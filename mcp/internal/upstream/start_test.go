@@ -0,0 +1,13 @@
+package upstream
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStartReportsMissingUpstream(t *testing.T) {
+	_, err := Start("./no-such-upstream", []string{"-x"})
+	if err == nil || !strings.Contains(err.Error(), `"./no-such-upstream"`) || !strings.Contains(err.Error(), `"-x"`) {
+		t.Fatalf("expected an error naming the upstream and its args, got %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package upstream
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// MirrorStderr copies upstream stderr to w a line at a time, prefixing each
+// line. A final line without a newline is flushed when r is closed.
+func MirrorStderr(w io.Writer, prefix string, r io.Reader) {
+	br := bufio.NewReader(r)
+	tag := fmt.Sprintf("[%s-stderr] ", prefix)
+	for {
+		line, err := br.ReadString('\n')
+		if line != "" {
+			if !strings.HasSuffix(line, "\n") {
+				line += "\n"
+			}
+			// Write each line at once so output from other writers can't
+			// land in the middle of it.
+			io.WriteString(w, tag+line)
+		}
+		if err != nil {
+			if err != io.EOF {
+				slog.Warn("stderr mirror error", "err", err)
+			}
+			return
+		}
+	}
+}
+
+// ForwardStderr sends each line of upstream stderr to the clients of the
+// server in s as an MCP log message notification. Until s is set, lines are
+// mirrored to w as MirrorStderr would, so output from a failing startup
+// isn't lost. Lines of any length are read, so a long one can't stop r from
+// being drained and leave the upstream blocked writing to a full pipe.
+func ForwardStderr(s *atomic.Pointer[server.MCPServer], w io.Writer, logger string, r io.Reader) {
+	br := bufio.NewReader(r)
+	tag := fmt.Sprintf("[%s-stderr] ", logger)
+	for {
+		line, err := br.ReadString('\n')
+		if line != "" {
+			line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+			if srv := s.Load(); srv == nil {
+				io.WriteString(w, tag+line+"\n")
+			} else {
+				srv.SendNotificationToAllClients("notifications/message", map[string]any{
+					"level":  mcp.LoggingLevelInfo,
+					"logger": logger,
+					"data":   line,
+				})
+			}
+		}
+		if err != nil {
+			if err != io.EOF {
+				slog.Warn("stderr forward error", "err", err)
+			}
+			return
+		}
+	}
+}
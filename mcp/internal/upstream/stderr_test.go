@@ -0,0 +1,77 @@
+package upstream
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/iotest"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func TestMirrorStderrPrefixesEachLine(t *testing.T) {
+	// Feed one byte at a time so lines arrive split across reads.
+	var out bytes.Buffer
+	MirrorStderr(&out, "upstream", iotest.OneByteReader(strings.NewReader("first\nsecond\n\npartial")))
+
+	want := "[upstream-stderr] first\n[upstream-stderr] second\n[upstream-stderr] \n[upstream-stderr] partial\n"
+	if got := out.String(); got != want {
+		t.Fatalf("expected one prefixed line per upstream line:\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestForwardStderrSendsLogNotifications(t *testing.T) {
+	s := server.NewMCPServer("test", "1.0.0", server.WithLogging())
+	sess := &testSession{notifications: make(chan mcp.JSONRPCNotification, 10)}
+	sess.Initialize()
+	if err := s.RegisterSession(context.Background(), sess); err != nil {
+		t.Fatal(err)
+	}
+
+	// Lines written before the server exists are mirrored instead.
+	var forwardTo atomic.Pointer[server.MCPServer]
+	var early bytes.Buffer
+	ForwardStderr(&forwardTo, &early, "upstream", strings.NewReader("starting up\n"))
+	if got := early.String(); got != "[upstream-stderr] starting up\n" {
+		t.Fatalf("expected early output to be mirrored, got %q", got)
+	}
+
+	// A line longer than bufio.Scanner allows mustn't stop the forwarding.
+	long := strings.Repeat("x", 100*1024)
+	forwardTo.Store(s)
+	ForwardStderr(&forwardTo, &early, "upstream", strings.NewReader(long+"\nsecond line\n"))
+	if got := early.String(); got != "[upstream-stderr] starting up\n" {
+		t.Fatalf("expected later output to be forwarded rather than mirrored, got %q", got)
+	}
+
+	for _, want := range []string{long, "second line"} {
+		n := <-sess.notifications
+		if n.Method != "notifications/message" {
+			t.Fatalf("unexpected notification method: %s", n.Method)
+		}
+		if got := n.Params.AdditionalFields["data"]; got != want {
+			t.Fatalf("expected log data of %d bytes, got %.40v", len(want), got)
+		}
+		if got := n.Params.AdditionalFields["logger"]; got != "upstream" {
+			t.Fatalf("expected logger upstream, got %v", got)
+		}
+	}
+}
+
+// testSession is a client session whose notifications can be read back by
+// the test.
+type testSession struct {
+	notifications chan mcp.JSONRPCNotification
+	initialized   atomic.Bool
+}
+
+func (s *testSession) Initialize()       { s.initialized.Store(true) }
+func (s *testSession) Initialized() bool { return s.initialized.Load() }
+func (s *testSession) SessionID() string { return "test-session" }
+
+func (s *testSession) NotificationChannel() chan<- mcp.JSONRPCNotification {
+	return s.notifications
+}
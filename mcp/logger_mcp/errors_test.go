@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/poy/adk-rnd/mcp/internal/proxy"
+)
+
+func TestProxyHandlerReportsTimeoutCode(t *testing.T) {
+	orig := logOutput
+	logOutput = io.Discard
+	defer func() { logOutput = orig }()
+
+	call := func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	res, err := proxyHandler(call, 1)(ctx, mcp.CallToolRequest{})
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if !res.IsError {
+		t.Fatal("expected an error result")
+	}
+	structured, ok := res.StructuredContent.(map[string]any)
+	if !ok || structured["code"] != proxy.CodeTimeout {
+		t.Fatalf("expected code %q, got %+v", proxy.CodeTimeout, res.StructuredContent)
+	}
+}
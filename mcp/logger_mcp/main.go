@@ -3,33 +3,85 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
+	"math/rand"
 	"os"
+	"sync/atomic"
 	"time"
 
 	"github.com/mark3labs/mcp-go/client"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
+	"github.com/poy/adk-rnd/mcp/internal/logging"
+	"github.com/poy/adk-rnd/mcp/internal/metatool"
+	"github.com/poy/adk-rnd/mcp/internal/proxy"
+	"github.com/poy/adk-rnd/mcp/internal/upstream"
+	"go.opentelemetry.io/otel"
 )
 
 func main() {
 	log.SetOutput(os.Stderr)
 	log.SetFlags(0)
 
-	if len(os.Args) < 2 {
-		log.Fatalf("usage: %s [UPSTREAM_MCP_PATH] <UPSTREAM_MCP_ARGS...>", os.Args[0])
+	forwardLogs := flag.Bool("forward-logs", false, "forward upstream stderr to the client as MCP log notifications instead of mirroring it to our stderr")
+	maxConcurrency := flag.Int64("max-concurrency", 0, "maximum number of upstream tool calls to run at once (default unlimited)")
+	failFast := flag.Bool("fail-fast", false, "reject calls over -max-concurrency instead of queueing them")
+	maxArgsBytes := flag.Int("max-args-bytes", 0, "reject calls whose arguments encode to more than this many bytes of JSON (default unlimited)")
+	maxResultBytes := flag.Int("max-result-bytes", 0, "reject upstream results that encode to more than this many bytes of JSON (default unlimited)")
+	breakerThreshold := flag.Int("breaker-threshold", 0, "consecutive upstream failures that open the circuit and fail calls fast (default disabled)")
+	breakerCooldown := flag.Duration("breaker-cooldown", 30*time.Second, "how long the circuit stays open before a call is let through to probe the upstream")
+	sampleRate := flag.Float64("sample-rate", 1.0, "fraction (0.0-1.0) of calls to log; errors are always logged")
+	pingUpstream := flag.Bool("ping-upstream", false, "add a ping_upstream tool reporting whether the upstream answers and how quickly")
+	listProxied := flag.Bool("list-proxied-tools", false, "add a list_proxied_tools tool reporting the upstream tools being forwarded")
+	replayLog := flag.String("replay-log", "", "log file to read the call to replay from, see -replay-id")
+	replayID := flag.String("replay-id", "", "instead of proxying, re-issue the call logged with this call_id in -replay-log against the upstream and print the result")
+	mirrorUpstream := flag.Bool("mirror-upstream", false, "report the upstream's server name, version, instructions and tool capabilities to clients instead of this proxy's own")
+	upstreamAttempts := flag.Int("upstream-attempts", 3, "how many times to try initializing the upstream and listing its tools before giving up")
+	upstreamTimeout := flag.Duration("upstream-timeout", 10*time.Second, "how long each of those attempts may take before it is abandoned and retried, or 0 for no limit, in which case only attempts that fail outright are retried")
+	logLevel := flag.String("log-level", "info", "minimum level of log lines to print: debug, info, warn or error")
+	showVersion := flag.Bool("version", false, "print the version and exit")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s <-sample-rate=1.0> <-forward-logs> <-max-concurrency=0> <-fail-fast> [UPSTREAM_MCP_PATH] <UPSTREAM_MCP_ARGS...>\n", os.Args[0])
+		flag.PrintDefaults()
 	}
-	upstreamPath := os.Args[1]
+	flag.Parse()
+	if err := logging.Setup(os.Stderr, *logLevel); err != nil {
+		log.Fatal(err)
+	}
+	if *showVersion {
+		fmt.Println(version)
+		return
+	}
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *sampleRate < 0 || *sampleRate > 1 {
+		log.Fatalf("-sample-rate must be between 0.0 and 1.0, got %v", *sampleRate)
+	}
+	upstreamPath := flag.Arg(0)
 
 	var args []string
-	if len(os.Args) > 2 {
-		args = append(args, os.Args[2:]...)
+	if flag.NArg() > 1 {
+		args = append(args, flag.Args()[1:]...)
+	}
+
+	if *replayID != "" {
+		if *replayLog == "" {
+			log.Fatal("-replay-id requires -replay-log")
+		}
+		if err := replay(context.Background(), *replayLog, *replayID, upstreamPath, args); err != nil {
+			log.Fatalf("replay failed: %v", err)
+		}
+		return
 	}
 
 	// Start upstream MCP over stdio.
-	mcpClient, err := client.NewStdioMCPClient(upstreamPath, nil, args...)
+	mcpClient, err := upstream.Start(upstreamPath, args)
 	if err != nil {
 		log.Fatalf("failed to start upstream: %v", err)
 	}
@@ -37,106 +89,148 @@ func main() {
 		_ = mcpClient.Close()
 	}()
 
-	// Mirror upstream stderr verbatim to our stderr.
+	// Mirror upstream stderr to our stderr from the start, so output from an
+	// upstream that fails to initialize is seen and a chatty one can't fill
+	// the pipe. With -forward-logs, lines go to the client as log
+	// notifications once the proxy server exists.
+	var forwardTo atomic.Pointer[server.MCPServer]
 	if r, ok := client.GetStderr(mcpClient); ok && r != nil {
-		go mirrorStderr("upstream", r)
+		if *forwardLogs {
+			go upstream.ForwardStderr(&forwardTo, os.Stderr, "upstream", r)
+		} else {
+			go upstream.MirrorStderr(os.Stderr, "upstream", r)
+		}
 	}
 
 	// Initialize upstream and log capabilities.
 	ctx := context.Background()
-	initResp, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{})
+	shutdownTracing, err := proxy.SetupTracing(ctx, "logger_mcp")
+	if err != nil {
+		log.Fatalf("failed to set up tracing: %v", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	ready := upstream.Readiness{Attempts: *upstreamAttempts, Timeout: *upstreamTimeout, Backoff: 500 * time.Millisecond}
+	initResp, err := upstream.Retry(ctx, ready, "initialize", func(ctx context.Context) (*mcp.InitializeResult, error) {
+		return mcpClient.Initialize(ctx, mcp.InitializeRequest{})
+	})
 	if err != nil {
 		log.Fatalf("upstream initialize failed: %v", err)
 	}
 	logJSON("upstream.initialize.response", initResp)
 
 	// Fetch upstream tools to expose identical interface.
-	listTools, err := mcpClient.ListTools(ctx, mcp.ListToolsRequest{})
+	tools, err := upstream.Retry(ctx, ready, "tools/list", func(ctx context.Context) ([]mcp.Tool, error) {
+		return proxy.ListUpstreamTools(ctx, mcpClient)
+	})
 	if err != nil {
 		log.Fatalf("upstream tools/list failed: %v", err)
 	}
-	logJSON("upstream.tools.list.response", listTools)
+	logJSON("upstream.tools.list.response", mcp.ListToolsResult{Tools: tools})
 
 	// Build our proxy MCP server on stdio.
-	s := server.NewMCPServer("passthrough-proxy", "1.0.0")
+	var mirrored *mcp.InitializeResult
+	if *mirrorUpstream {
+		mirrored = initResp
+	}
+	s := upstream.NewProxyServer("passthrough-proxy", version, mirrored, server.WithLogging())
+
+	forwardTo.Store(s)
 
 	// For each upstream tool, register a proxy handler that forwards the call.
-	for _, t := range listTools.Tools {
+	call := proxy.TraceCalls(otel.Tracer("logger_mcp"), proxy.LimitSizes(proxy.LimitCalls(proxy.BreakCircuit(mcpClient.CallTool, *breakerThreshold, *breakerCooldown), *maxConcurrency, *failFast), *maxArgsBytes, *maxResultBytes))
+	registerTools(s, tools, call, *sampleRate)
+	metatool.AddServerInfo(s, version, &initResp.ServerInfo, tools)
+	if *listProxied {
+		proxy.AddListProxiedToolsTool(s, tools)
+	}
+	if *pingUpstream {
+		proxy.AddPingUpstreamTool(s, mcpClient.Ping, tools)
+	}
+
+	slog.Info("passthrough proxy MCP server running on stdio")
+	if err := server.ServeStdio(s); err != nil {
+		log.Fatalf("ServeStdio error: %v", err)
+	}
+}
+
+// registerTools adds a logging proxy handler to s for each upstream tool.
+func registerTools(s *server.MCPServer, tools []mcp.Tool, call func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error), sampleRate float64) {
+	for _, t := range tools {
 		tool := t // capture
-		s.AddTool(tool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			// Log inbound request.
+		s.AddTool(tool, proxyHandler(call, sampleRate))
+		slog.Debug("registered passthrough tool", "tool", tool.Name)
+	}
+}
+
+// proxyHandler forwards each call via call and logs it. Only a sampleRate
+// fraction of calls have their request and response logged; the decision is
+// made once per call so both records are kept or dropped together. Errors are
+// always logged. Every record for a call carries the same call_id, which
+// -replay-id takes to re-issue the call.
+func proxyHandler(call func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error), sampleRate float64) server.ToolHandlerFunc {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		sampled := sampleRate >= 1 || rand.Float64() < sampleRate
+		callID := newCallID()
+
+		// Log inbound request.
+		if sampled {
 			logJSON("proxy.tools.call.request", struct {
+				CallID    string              `json:"call_id"`
 				Name      string              `json:"name"`
 				Arguments any                 `json:"arguments"`
 				Raw       mcp.CallToolRequest `json:"raw"`
 			}{
+				CallID:    callID,
 				Name:      req.Params.Name,
 				Arguments: req.Params.Arguments,
 				Raw:       req,
 			})
+		}
+
+		start := time.Now()
+		res, err := call(ctx, req)
+		d := time.Since(start)
+
+		if err != nil {
+			logJSON("proxy.tools.call.error", struct {
+				CallID string `json:"call_id"`
+				Name   string `json:"name"`
+				Error  string `json:"error"`
+				MS     int64  `json:"elapsed_ms"`
+			}{CallID: callID, Name: req.Params.Name, Error: err.Error(), MS: d.Milliseconds()})
+			// Return an MCP-formatted error result so the client gets something structured.
+			return proxy.ForwardError(err), nil
+		}
 
-			start := time.Now()
-			res, err := mcpClient.CallTool(ctx, req)
-			d := time.Since(start)
-
-			if err != nil {
-				logJSON("proxy.tools.call.error", struct {
-					Name  string `json:"name"`
-					Error string `json:"error"`
-					MS    int64  `json:"elapsed_ms"`
-				}{Name: req.Params.Name, Error: err.Error(), MS: d.Milliseconds()})
-				// Return an MCP-formatted error result so the client gets something structured.
-				return mcp.NewToolResultError(fmt.Sprintf("forward error: %v", err)), nil
-			}
-
-			// Log outbound response.
+		// Log outbound response. Error results are logged even when the
+		// call wasn't sampled.
+		if sampled || res != nil && res.IsError {
 			logJSON("proxy.tools.call.response", struct {
+				CallID string              `json:"call_id"`
 				Name   string              `json:"name"`
 				Result *mcp.CallToolResult `json:"result"`
 				MS     int64               `json:"elapsed_ms"`
-			}{Name: req.Params.Name, Result: res, MS: d.Milliseconds()})
-
-			return res, nil
-		})
-		log.Printf("registered passthrough tool: %s", tool.Name)
-	}
+			}{CallID: callID, Name: req.Params.Name, Result: res, MS: d.Milliseconds()})
+		}
 
-	log.Println("passthrough proxy MCP server running on stdio...")
-	if err := server.ServeStdio(s); err != nil {
-		log.Fatalf("ServeStdio error: %v", err)
+		return res, nil
 	}
 }
 
-// mirrorStderr copies upstream stderr to our stderr, line-buffered, with a prefix.
-func mirrorStderr(prefix string, r io.Reader) {
-	buf := make([]byte, 32*1024)
-	for {
-		n, err := r.Read(buf)
-		if n > 0 {
-			chunk := buf[:n]
-			// We do not attempt to parse; just forward with a tag.
-			os.Stderr.Write([]byte(fmt.Sprintf("[%s-stderr] ", prefix)))
-			os.Stderr.Write(chunk)
-		}
-		if err != nil {
-			if err != io.EOF {
-				log.Printf("stderr mirror error: %v", err)
-			}
-			return
-		}
-	}
-}
+// logOutput is where logJSON writes its records.
+var logOutput io.Writer = os.Stderr
 
-// logJSON prints a compact JSON record to stderr.
+// logJSON prints a compact JSON record to logOutput.
 func logJSON(kind string, v any) {
 	record := map[string]any{
 		"ts":   time.Now().Format(time.RFC3339Nano),
 		"type": kind,
 		"data": v,
 	}
-	enc := json.NewEncoder(os.Stderr)
+	enc := json.NewEncoder(logOutput)
 	enc.SetEscapeHTML(false)
 	if err := enc.Encode(record); err != nil {
-		log.Printf("json log encode error (%s): %v", kind, err)
+		slog.Error("json log encode error", "kind", kind, "err", err)
 	}
 }
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/poy/adk-rnd/mcp/internal/mcptest"
+)
+
+func TestProxyHandlerSampleRateZero(t *testing.T) {
+	var buf bytes.Buffer
+	orig := logOutput
+	logOutput = &buf
+	defer func() { logOutput = orig }()
+
+	call := func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		switch req.Params.Name {
+		case "fails":
+			return nil, errors.New("boom")
+		case "rejects":
+			return mcp.NewToolResultError("bad input"), nil
+		}
+		return mcp.NewToolResultText("ok"), nil
+	}
+	h := proxyHandler(call, 0)
+
+	for _, name := range []string{"works", "fails", "works", "rejects"} {
+		req := mcp.CallToolRequest{Params: mcp.CallToolParams{Name: name}}
+		if _, err := h(context.Background(), req); err != nil {
+			t.Fatalf("handler returned error: %v", err)
+		}
+	}
+
+	dec := json.NewDecoder(&buf)
+	var kinds []string
+	for dec.More() {
+		var record struct {
+			Type string `json:"type"`
+		}
+		if err := dec.Decode(&record); err != nil {
+			t.Fatalf("failed to decode log record: %v", err)
+		}
+		kinds = append(kinds, record.Type)
+	}
+
+	if strings.Join(kinds, ",") != "proxy.tools.call.error,proxy.tools.call.response" {
+		t.Fatalf("expected only the failed call and the error result to be logged, got %v", kinds)
+	}
+}
+
+func TestProxyForwardsAndLogsCalls(t *testing.T) {
+	var buf bytes.Buffer
+	orig := logOutput
+	logOutput = &buf
+	defer func() { logOutput = orig }()
+
+	upstream := mcptest.NewClient(t, mcptest.NewFakeUpstream(mcptest.EchoTool()))
+	list, err := upstream.ListTools(context.Background(), mcp.ListToolsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxy := server.NewMCPServer("proxy", "test")
+	for _, tool := range list.Tools {
+		proxy.AddTool(tool, proxyHandler(upstream.CallTool, 1))
+	}
+	c := mcptest.NewClient(t, proxy)
+
+	res := mcptest.CallTool(t, c, "echo", map[string]any{"message": "hi"})
+	if res.IsError || mcptest.ResultText(res) != "hi" {
+		t.Fatalf("expected the upstream result, got %+v", res)
+	}
+
+	for _, want := range []string{"proxy.tools.call.request", "proxy.tools.call.response"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Fatalf("expected a %s log record, got %s", want, buf.String())
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/poy/adk-rnd/mcp/internal/upstream"
+)
+
+// newCallID returns a random ID tying together the records logged for a call.
+func newCallID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("failed to generate call ID: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+// findLoggedCall returns the request logged under id in r. Lines that aren't
+// JSON records, such as plain log lines sharing stderr, are skipped.
+func findLoggedCall(r io.Reader, id string) (mcp.CallToolRequest, error) {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		var record struct {
+			Type string `json:"type"`
+			Data struct {
+				CallID string          `json:"call_id"`
+				Raw    json.RawMessage `json:"raw"`
+			} `json:"data"`
+		}
+		if json.Unmarshal(line, &record) == nil && record.Type == "proxy.tools.call.request" && record.Data.CallID == id {
+			var req mcp.CallToolRequest
+			if err := json.Unmarshal(record.Data.Raw, &req); err != nil {
+				return mcp.CallToolRequest{}, fmt.Errorf("failed to decode logged request %s: %w", id, err)
+			}
+			return req, nil
+		}
+		if err == io.EOF {
+			return mcp.CallToolRequest{}, fmt.Errorf("no request logged with call ID %s; it may not have been sampled", id)
+		}
+		if err != nil {
+			return mcp.CallToolRequest{}, err
+		}
+	}
+}
+
+// replay re-issues the call logged under id in the log at logPath against a
+// freshly started upstream and prints the result to stdout.
+func replay(ctx context.Context, logPath, id, upstreamPath string, args []string) error {
+	f, err := os.Open(logPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	req, err := findLoggedCall(f, id)
+	if err != nil {
+		return err
+	}
+
+	mcpClient, err := upstream.Start(upstreamPath, args)
+	if err != nil {
+		return err
+	}
+	defer mcpClient.Close()
+	if _, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+		return fmt.Errorf("upstream initialize failed: %w", err)
+	}
+
+	res, err := mcpClient.CallTool(ctx, req)
+	if err != nil {
+		return fmt.Errorf("%s failed: %w", req.Params.Name, err)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(res)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/poy/adk-rnd/mcp/internal/mcptest"
+)
+
+func TestReplayLoggedCall(t *testing.T) {
+	var buf bytes.Buffer
+	orig := logOutput
+	logOutput = &buf
+	defer func() { logOutput = orig }()
+
+	upstream := mcptest.NewClient(t, mcptest.NewFakeUpstream(mcptest.EchoTool()))
+	h := proxyHandler(upstream.CallTool, 1)
+	req := mcp.CallToolRequest{
+		Request: mcp.Request{Method: "tools/call"},
+		Params: mcp.CallToolParams{
+			Name:      "echo",
+			Arguments: map[string]any{"message": "hello again"},
+		},
+	}
+	want, err := h(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var callID string
+	dec := json.NewDecoder(bytes.NewReader(buf.Bytes()))
+	for dec.More() {
+		var record struct {
+			Type string `json:"type"`
+			Data struct {
+				CallID string `json:"call_id"`
+			} `json:"data"`
+		}
+		if err := dec.Decode(&record); err != nil {
+			t.Fatal(err)
+		}
+		if record.Type == "proxy.tools.call.response" {
+			callID = record.Data.CallID
+		}
+	}
+	if callID == "" {
+		t.Fatalf("expected the response record to carry a call ID, got %s", buf.String())
+	}
+
+	// Plain log lines share stderr with the records.
+	logged := "registered passthrough tool: echo\n" + buf.String()
+	replayed, err := findLoggedCall(strings.NewReader(logged), callID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := upstream.CallTool(context.Background(), replayed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected the replayed call to give %+v, got %+v", want, got)
+	}
+
+	if _, err := findLoggedCall(strings.NewReader(logged), "missing"); err == nil {
+		t.Fatal("expected an unknown call ID to fail")
+	}
+}
@@ -2,12 +2,20 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"flag"
 	"fmt"
-	"io"
 	"log"
+	"log/slog"
+	"maps"
 	"os"
+	"path"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -15,42 +23,91 @@ import (
 	"github.com/mark3labs/mcp-go/client"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
+	"github.com/poy/adk-rnd/mcp/internal/config"
+	"github.com/poy/adk-rnd/mcp/internal/logging"
+	"github.com/poy/adk-rnd/mcp/internal/metatool"
+	"github.com/poy/adk-rnd/mcp/internal/proxy"
+	"github.com/poy/adk-rnd/mcp/internal/upstream"
 )
 
 type MethodConfig struct {
-	MethodName string `json:"methodName"`
-	Enabled    bool   `json:"enabled"`
+	MethodName string `json:"methodName" yaml:"methodName"`
+	Enabled    bool   `json:"enabled" yaml:"enabled"`
+	// Coalesce attaches a call to a pending task started by an identical
+	// call, with the same tool and arguments, instead of starting another.
+	Coalesce bool `json:"coalesce" yaml:"coalesce"`
 }
 
 func main() {
 	log.SetFlags(0)
-	if len(os.Args) < 3 {
-		log.Fatalf("usage: %s [CONFIG_PATH] [UPSTREAM_MCP_PATH] <UPSTREAM_MCP_ARGS...>", os.Args[0])
+	forwardLogs := flag.Bool("forward-logs", false, "forward upstream stderr to the client as MCP log notifications instead of mirroring it to our stderr")
+	storeDir := flag.String("store-dir", "", "directory to persist task results in so they survive a restart (default in memory only)")
+	maxConcurrency := flag.Int("max-concurrency", 0, "maximum number of long running tasks to run at once; the rest are queued (default unlimited)")
+	configEnv := flag.String("config-env", "", "read the config from this environment variable instead of CONFIG_PATH")
+	flag.DurationVar(&checkCooldown, "check-cooldown", checkCooldown, "how long checking a pending task waits before answering, to pace clients that poll in a loop")
+	noCooldown := flag.Bool("no-cooldown", false, "answer checks of pending tasks at once, same as -check-cooldown=0; latency-sensitive clients get answers sooner, at the cost of more polling traffic")
+	mirrorUpstream := flag.Bool("mirror-upstream", false, "report the upstream's server name, version, instructions and tool capabilities to clients instead of this proxy's own")
+	upstreamAttempts := flag.Int("upstream-attempts", 3, "how many times to try initializing the upstream and listing its tools before giving up")
+	upstreamTimeout := flag.Duration("upstream-timeout", 10*time.Second, "how long each of those attempts may take before it is abandoned and retried, or 0 for no limit, in which case only attempts that fail outright are retried")
+	logLevel := flag.String("log-level", "info", "minimum level of log lines to print: debug, info, warn or error")
+	showVersion := flag.Bool("version", false, "print the version and exit")
+	flag.Parse()
+	if err := logging.Setup(os.Stderr, *logLevel); err != nil {
+		log.Fatal(err)
+	}
+	if *noCooldown {
+		checkCooldown = 0
+	}
+	if *showVersion {
+		fmt.Println(version)
+		return
+	}
+	// The config path is omitted when it comes from the environment.
+	nConfig := 1
+	if *configEnv != "" {
+		nConfig = 0
+	}
+	if flag.NArg() < nConfig+1 {
+		log.Fatalf("usage: %s <-forward-logs> <-config-env=VAR> [CONFIG_PATH[,OVERRIDE_PATH...]] [UPSTREAM_MCP_PATH] <UPSTREAM_MCP_ARGS...>", os.Args[0])
 	}
 
-	upstreamPath := os.Args[2]
+	upstreamPath := flag.Arg(nConfig)
+	workers.max = *maxConcurrency
+	if *storeDir != "" {
+		n, err := workers.openStore(*storeDir)
+		if err != nil {
+			log.Fatalf("failed to open task store: %v", err)
+		}
+		slog.Info("loaded tasks", "count", n, "dir", *storeDir)
+	}
 
-	configs, err := loadConfig(os.Args[1])
+	var configs map[string]MethodConfig
+	var err error
+	if *configEnv != "" {
+		configs, err = loadConfigEnv(*configEnv)
+	} else {
+		configs, err = loadConfig(flag.Arg(0))
+	}
 	if err != nil {
 		log.Fatalf("failed to load config: %v", err)
 	}
 
-	lroMethods := map[string]struct{}{}
+	lroMethods := map[string]MethodConfig{}
 	for _, c := range configs {
 		if !c.Enabled {
 			continue
 		}
-		log.Printf("putting %s behind a LRO", c.MethodName)
-		lroMethods[c.MethodName] = struct{}{}
+		if _, err := path.Match(c.MethodName, ""); err != nil {
+			log.Fatalf("invalid methodName pattern %q: %v", c.MethodName, err)
+		}
+		slog.Debug("configured LRO", "methodName", c.MethodName)
+		lroMethods[c.MethodName] = c
 	}
 
-	var args []string
-	if len(os.Args) > 2 {
-		args = append(args, os.Args[3:]...)
-	}
+	args := flag.Args()[nConfig+1:]
 
 	// Start upstream MCP over stdio.
-	mcpClient, err := client.NewStdioMCPClient(upstreamPath, nil, args...)
+	mcpClient, err := upstream.Start(upstreamPath, args)
 	if err != nil {
 		log.Fatalf("failed to start upstream: %v", err)
 	}
@@ -58,58 +115,50 @@ func main() {
 		_ = mcpClient.Close()
 	}()
 
-	// Mirror upstream stderr verbatim to our stderr.
+	// Mirror upstream stderr to our stderr from the start, so output from an
+	// upstream that fails to initialize is seen and a chatty one can't fill
+	// the pipe. With -forward-logs, lines go to the client as log
+	// notifications once the proxy server exists.
+	var forwardTo atomic.Pointer[server.MCPServer]
 	if r, ok := client.GetStderr(mcpClient); ok && r != nil {
-		go mirrorStderr("upstream", r)
+		if *forwardLogs {
+			go upstream.ForwardStderr(&forwardTo, os.Stderr, "upstream", r)
+		} else {
+			go upstream.MirrorStderr(os.Stderr, "upstream", r)
+		}
 	}
 
 	// Initialize upstream and log capabilities.
 	ctx := context.Background()
-	if _, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+	ready := upstream.Readiness{Attempts: *upstreamAttempts, Timeout: *upstreamTimeout, Backoff: 500 * time.Millisecond}
+	initResp, err := upstream.Retry(ctx, ready, "initialize", func(ctx context.Context) (*mcp.InitializeResult, error) {
+		return mcpClient.Initialize(ctx, mcp.InitializeRequest{})
+	})
+	if err != nil {
 		log.Fatalf("upstream initialize failed: %v", err)
 	}
 
 	// Fetch upstream tools to expose identical interface.
-	listTools, err := mcpClient.ListTools(ctx, mcp.ListToolsRequest{})
+	listTools, err := upstream.Retry(ctx, ready, "tools/list", func(ctx context.Context) (*mcp.ListToolsResult, error) {
+		return mcpClient.ListTools(ctx, mcp.ListToolsRequest{})
+	})
 	if err != nil {
 		log.Fatalf("upstream tools/list failed: %v", err)
 	}
 
 	// Build our proxy MCP server on stdio.
-	s := server.NewMCPServer("passthrough-proxy", "1.0.0")
-
-	s.AddTool(mcp.NewTool("check_long_running_task",
-		mcp.WithDescription("Checks to see if a long running task is done or still pending. If it's done, it will output the result."),
-		mcp.WithString("id", mcp.Required(), mcp.Description("The ID of the long running task")),
-	), checkLongRunningTaskHandler)
-
-	// For each upstream tool, register a proxy handler that forwards the call.
-	for _, t := range listTools.Tools {
-		tool := t
-		s.AddTool(tool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			if _, ok := lroMethods[t.Name]; !ok {
-				log.Printf("Not putting %s behind a LRO", t.Name)
-				res, err := mcpClient.CallTool(ctx, req)
-				if err != nil {
-					return mcp.NewToolResultError(fmt.Sprintf("forward error: %v", err)), nil
-				}
-				return res, nil
-			}
+	var mirrored *mcp.InitializeResult
+	if *mirrorUpstream {
+		mirrored = initResp
+	}
+	s := upstream.NewProxyServer("passthrough-proxy", version, mirrored, server.WithLogging())
 
-			log.Printf("Putting %s behind a LRO", t.Name)
+	forwardTo.Store(s)
 
-			return startLongRunningTask(func() *mcp.CallToolResult {
-				res, err := mcpClient.CallTool(ctx, req)
-				if err != nil {
-					return mcp.NewToolResultError(fmt.Sprintf("forward error: %v", err))
-				}
-				return res
-			}), nil
-		})
-		log.Printf("registered passthrough tool: %s", tool.Name)
-	}
+	registerTools(s, listTools.Tools, mcpClient.CallTool, lroMethods)
+	metatool.AddServerInfo(s, version, &initResp.ServerInfo, listTools.Tools)
 
-	log.Println("long running tasks: passthrough proxy MCP server running on stdio...")
+	slog.Info("long running tasks: passthrough proxy MCP server running on stdio")
 	if err := server.ServeStdio(s); err != nil {
 		log.Fatalf("ServeStdio error: %v", err)
 	}
@@ -140,7 +189,7 @@ func checkLongRunningTaskHandler(ctx context.Context, r mcp.CallToolRequest) (*m
 	if err != nil {
 		return mcp.NewToolResultErrorFromErr("missing required argument", err), nil
 	}
-	log.Printf("Check long running tasks at ID %s", id)
+	slog.Debug("checking long running task", "id", id)
 
 	val, ok := longRunningTasks.Load(id)
 	if !ok {
@@ -149,35 +198,272 @@ func checkLongRunningTaskHandler(ctx context.Context, r mcp.CallToolRequest) (*m
 	t := val.(*LongRunningTask)
 	switch status := t.Status(); status {
 	case Pending:
-		// We force a cooldown here.
-		log.Printf("Task %s is still pending, sleeping 3 seconds...", id)
-		time.Sleep(3 * time.Second)
-		return mcp.NewToolResultText(fmt.Sprintf("Task %s is pending", id)), nil
+		// Hold the answer back so clients that poll in a tight loop don't
+		// flood the proxy.
+		if checkCooldown > 0 {
+			slog.Debug("task still pending, cooling down", "id", id, "cooldown", checkCooldown)
+			select {
+			case <-time.After(checkCooldown):
+			case <-ctx.Done():
+			}
+		}
+		if pos := workers.position(t); pos > 0 {
+			return mcp.NewToolResultText(fmt.Sprintf("Task %s for %s is pending (queued, position %d)", id, t.callSummary(), pos)), nil
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("Task %s for %s is pending", id, t.callSummary())), nil
 	case Done:
 		result := t.Result()
 
-		log.Printf("Task %s is done", id)
-		return result, nil
+		slog.Debug("task done", "id", id)
+		if t.Tool == "" || result == nil {
+			return result, nil
+		}
+		// Copy so the stored result isn't appended to on every check.
+		out := *result
+		out.Content = append(append([]mcp.Content{}, result.Content...), mcp.NewTextContent(fmt.Sprintf("Task %s was started by %s", id, t.callSummary())))
+		return &out, nil
 	default:
 		panic(fmt.Sprintf("unknown task status: %v", status))
 	}
 }
 
-func startLongRunningTask(f func() *mcp.CallToolResult) *mcp.CallToolResult {
-	t := Run(f)
+// checkCooldown is how long a check of a pending task waits before
+// answering. It paces clients that poll in a loop, at the cost of latency; 0
+// answers at once but lets such clients poll as fast as they can.
+var checkCooldown = 3 * time.Second
+
+// registerTools adds check_long_running_task, list_lro_config and a proxy
+// handler for each upstream tool to s, putting calls to tools matching
+// lroMethods behind a long running task. The names of our own tools are
+// chosen with metatool.FreeName. It returns the name check_long_running_task
+// was registered under.
+func registerTools(s *server.MCPServer, tools []mcp.Tool, call func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error), lroMethods map[string]MethodConfig) string {
+	checkToolName := metatool.FreeName("check_long_running_task", tools)
+	s.AddTool(mcp.NewTool(checkToolName,
+		mcp.WithDescription("Checks to see if a long running task is done or still pending. If it's done, it will output the result."),
+		mcp.WithString("id", mcp.Required(), mcp.Description("The ID of the long running task")),
+	), checkLongRunningTaskHandler)
+
+	configToolName := metatool.FreeName("list_lro_config", append(tools[:len(tools):len(tools)], mcp.Tool{Name: checkToolName}))
+	plan := newLROPlan(tools, lroMethods)
+	plan.log()
+	s.AddTool(mcp.NewTool(configToolName,
+		mcp.WithDescription("Lists each tool and whether calls to it run as a long running task or pass straight through, plus any configured methodName that matched no tool."),
+	), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		data, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal config: %w", err)
+		}
+		return mcp.NewToolResultText(string(data)), nil
+	})
+
+	// For each upstream tool, register a proxy handler that forwards the call.
+	for _, t := range tools {
+		tool := t
+		s.AddTool(tool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			c, ok := lroConfig(lroMethods, t.Name)
+			if !ok {
+				slog.Debug("passing call through", "tool", t.Name)
+				res, err := call(ctx, req)
+				if err != nil {
+					return proxy.ForwardError(err), nil
+				}
+				return res, nil
+			}
+
+			slog.Debug("putting call behind a LRO", "tool", t.Name)
+
+			return startLongRunningTask(req, c.Coalesce, checkToolName, func() *mcp.CallToolResult {
+				res, err := call(ctx, req)
+				if err != nil {
+					return proxy.ForwardError(err)
+				}
+				return res
+			}), nil
+		})
+	}
+	return checkToolName
+}
+
+// lroPlan reports how the loaded config applies to the upstream tools, so
+// operators can check it took effect.
+type lroPlan struct {
+	Tools []lroPlanTool `json:"tools"`
+	// Unmatched lists the enabled methodNames that match no upstream tool,
+	// usually because of a typo.
+	Unmatched []string `json:"unmatched"`
+}
+
+type lroPlanTool struct {
+	Name string `json:"name"`
+	// Mode is "lro" or "passthrough".
+	Mode string `json:"mode"`
+	// MethodName is the configured name or pattern that matched, if any.
+	MethodName string `json:"methodName,omitempty"`
+}
+
+func newLROPlan(tools []mcp.Tool, lroMethods map[string]MethodConfig) lroPlan {
+	plan := lroPlan{Tools: []lroPlanTool{}, Unmatched: []string{}}
+	for _, t := range tools {
+		pt := lroPlanTool{Name: t.Name, Mode: "passthrough"}
+		if c, ok := lroConfig(lroMethods, t.Name); ok {
+			pt.Mode = "lro"
+			pt.MethodName = c.MethodName
+		}
+		plan.Tools = append(plan.Tools, pt)
+	}
+	for name := range lroMethods {
+		matched := false
+		for _, t := range tools {
+			if ok, _ := path.Match(name, t.Name); ok || name == t.Name {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			plan.Unmatched = append(plan.Unmatched, name)
+		}
+	}
+	sort.Strings(plan.Unmatched)
+	return plan
+}
+
+func (p lroPlan) log() {
+	for _, t := range p.Tools {
+		if t.Mode == "lro" {
+			slog.Info("tool is a LRO", "tool", t.Name, "methodName", t.MethodName)
+		} else {
+			slog.Info("tool is passthrough", "tool", t.Name)
+		}
+	}
+	for _, name := range p.Unmatched {
+		slog.Warn("methodName matches no upstream tool", "methodName", name)
+	}
+}
+
+// lroConfig returns the config for the tool name if it is one of lroMethods
+// or matches one of them as a glob in path.Match syntax, e.g. "delete_*". An
+// exact match wins over a glob. Of several matching globs, the most specific
+// one wins, that is the one with the most literal characters, and of equally
+// specific ones the lexically smallest, so the choice doesn't depend on map
+// order.
+func lroConfig(lroMethods map[string]MethodConfig, name string) (MethodConfig, bool) {
+	if c, ok := lroMethods[name]; ok {
+		return c, true
+	}
+	best, found := "", false
+	for g := range lroMethods {
+		if ok, _ := path.Match(g, name); !ok {
+			continue
+		}
+		if !found || globLiterals(g) > globLiterals(best) || globLiterals(g) == globLiterals(best) && g < best {
+			best, found = g, true
+		}
+	}
+	return lroMethods[best], found
+}
+
+// globLiterals counts the characters of the glob g that match only
+// themselves. A character class counts as one.
+func globLiterals(g string) int {
+	n := 0
+	for i := 0; i < len(g); i++ {
+		switch g[i] {
+		case '*', '?':
+			continue
+		case '\\':
+			i++
+		case '[':
+			for i < len(g) && g[i] != ']' {
+				i++
+			}
+		}
+		n++
+	}
+	return n
+}
+
+// inflight holds the pending tasks of tools with coalescing on, keyed by
+// coalesceKey.
+var inflight = struct {
+	sync.Mutex
+	m map[string]*LongRunningTask
+}{m: map[string]*LongRunningTask{}}
+
+// coalesceKey identifies calls with the same tool and arguments. Map keys
+// are sorted when encoded, so argument order doesn't matter.
+func coalesceKey(req mcp.CallToolRequest) string {
+	args, _ := json.Marshal(req.Params.Arguments)
+	sum := sha256.Sum256(args)
+	return req.Params.Name + ":" + hex.EncodeToString(sum[:])
+}
+
+// startLongRunningTask runs f as a task. If coalesce is set and an identical
+// call is still pending, the caller is given that task instead. The result
+// tells the caller to check on the task with the checkToolName tool.
+func startLongRunningTask(req mcp.CallToolRequest, coalesce bool, checkToolName string, f func() *mcp.CallToolResult) *mcp.CallToolResult {
+	if !coalesce {
+		t := Run(req.Params.Name, req.Params.Arguments, f)
+		longRunningTasks.Store(t.ID, t)
+		return startedResult(t, fmt.Sprintf("Started long running task with ID: %s.", t.ID), checkToolName)
+	}
+
+	key := coalesceKey(req)
+	inflight.Lock()
+	defer inflight.Unlock()
+	if t, ok := inflight.m[key]; ok {
+		slog.Debug("attaching call to pending task", "tool", req.Params.Name, "id", t.ID)
+		return startedResult(t, fmt.Sprintf("An identical call is already running as long running task with ID: %s.", t.ID), checkToolName)
+	}
+	t := Run(req.Params.Name, req.Params.Arguments, func() *mcp.CallToolResult {
+		defer func() {
+			inflight.Lock()
+			delete(inflight.m, key)
+			inflight.Unlock()
+		}()
+		return f()
+	})
+	inflight.m[key] = t
 	longRunningTasks.Store(t.ID, t)
+	return startedResult(t, fmt.Sprintf("Started long running task with ID: %s.", t.ID), checkToolName)
+}
+
+func startedResult(t *LongRunningTask, msg, checkToolName string) *mcp.CallToolResult {
 	return mcp.NewToolResultStructured(struct {
 		LongRunningTaskID string `json:"long_running_task_id"`
 	}{
 		LongRunningTaskID: t.ID,
-	}, fmt.Sprintf("Started long running task with ID: %s", t.ID))
+	}, fmt.Sprintf("%s Check on it with %s.", msg, checkToolName))
 }
 
 type LongRunningTask struct {
-	mu     sync.Mutex
-	ID     string
-	status LongRunningTaskStatus
-	result *mcp.CallToolResult
+	mu sync.Mutex
+	ID string
+	// Tool and Arguments are the call that started the task.
+	Tool      string
+	Arguments any
+	status    LongRunningTaskStatus
+	result    *mcp.CallToolResult
+}
+
+// maxSummaryArgs caps how much of the arguments callSummary includes.
+const maxSummaryArgs = 200
+
+// callSummary describes the call that started the task, e.g.
+// delete_user({"id":1}), so clients can match results to requests. Long
+// arguments are truncated.
+func (t *LongRunningTask) callSummary() string {
+	if t.Tool == "" {
+		return "an unknown call"
+	}
+	args, err := json.Marshal(t.Arguments)
+	if err != nil || t.Arguments == nil {
+		args = []byte("{}")
+	}
+	if len(args) > maxSummaryArgs {
+		args = append(args[:maxSummaryArgs:maxSummaryArgs], "..."...)
+	}
+	return fmt.Sprintf("%s(%s)", t.Tool, args)
 }
 
 func (t *LongRunningTask) Status() LongRunningTaskStatus {
@@ -192,58 +478,151 @@ func (t *LongRunningTask) Result() *mcp.CallToolResult {
 	return t.result
 }
 
-var nextID uint64
+// newTaskID returns a random ID so that clients can't guess the IDs of other
+// clients' tasks.
+func newTaskID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("failed to generate task ID: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+// workers runs the tasks started by Run.
+var workers = &taskPool{}
 
-func Run(f func() *mcp.CallToolResult) *LongRunningTask {
+// Run starts f as a task for the call to tool with args.
+func Run(tool string, args any, f func() *mcp.CallToolResult) *LongRunningTask {
 	t := &LongRunningTask{
-		ID:     fmt.Sprintf("%d", atomic.AddUint64(&nextID, 1)),
-		status: Pending,
+		ID:        newTaskID(),
+		Tool:      tool,
+		Arguments: args,
+		status:    Pending,
 	}
-	go func() {
-		out := f()
-		t.mu.Lock()
-		defer t.mu.Unlock()
-
-		t.status = Done
-		t.result = out
-	}()
+	// Save before starting so the pending record can't overwrite the
+	// finished one.
+	workers.save(t)
+	workers.submit(t, f)
 	return t
 }
 
-func loadConfig(p string) (map[string]MethodConfig, error) {
-	data, err := os.ReadFile(p)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read file: %w", err)
-	}
-	var cs []MethodConfig
-	if err := json.Unmarshal(data, &cs); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+func (t *LongRunningTask) finish(out *mcp.CallToolResult) {
+	t.mu.Lock()
+	t.status = Done
+	t.result = out
+	t.mu.Unlock()
+}
+
+// taskPool runs at most max tasks at once and queues the rest, starting them
+// in the order they were submitted. A max of zero or less runs every task
+// straight away.
+type taskPool struct {
+	mu      sync.Mutex
+	max     int
+	running int
+	queue   []queuedTask
+	// store persists the pool's tasks, or is nil when persistence is off.
+	store *taskStore
+}
+
+type queuedTask struct {
+	t *LongRunningTask
+	f func() *mcp.CallToolResult
+}
+
+func (p *taskPool) submit(t *LongRunningTask, f func() *mcp.CallToolResult) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.max > 0 && p.running >= p.max {
+		p.queue = append(p.queue, queuedTask{t: t, f: f})
+		return
 	}
+	p.running++
+	go p.run(queuedTask{t: t, f: f})
+}
 
-	m := map[string]MethodConfig{}
-	for _, c := range cs {
-		m[c.MethodName] = c
+// run runs the task, then hands its slot to the next queued task.
+func (p *taskPool) run(qt queuedTask) {
+	for {
+		qt.t.finish(qt.f())
+		p.save(qt.t)
+
+		p.mu.Lock()
+		if len(p.queue) == 0 {
+			p.running--
+			p.mu.Unlock()
+			return
+		}
+		qt = p.queue[0]
+		p.queue = p.queue[1:]
+		p.mu.Unlock()
 	}
+}
+
+// position returns the task's 1-based place in the queue, or 0 if it isn't
+// waiting for a slot.
+func (p *taskPool) position(t *LongRunningTask) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-	return m, nil
+	for i, qt := range p.queue {
+		if qt.t == t {
+			return i + 1
+		}
+	}
+	return 0
 }
 
-// mirrorStderr copies upstream stderr to our stderr, line-buffered, with a prefix.
-func mirrorStderr(prefix string, r io.Reader) {
-	buf := make([]byte, 32*1024)
-	for {
-		n, err := r.Read(buf)
-		if n > 0 {
-			chunk := buf[:n]
-			// We do not attempt to parse; just forward with a tag.
-			os.Stderr.Write([]byte(fmt.Sprintf("[%s-stderr] ", prefix)))
-			os.Stderr.Write(chunk)
+// loadConfig loads the config from p, which may list several files separated
+// by commas. Entries are keyed by methodName, and an entry in a later file is
+// merged over the earlier one field by field, so an override file only needs
+// the fields it changes.
+func loadConfig(p string) (map[string]MethodConfig, error) {
+	merged := map[string]map[string]any{}
+	for _, path := range strings.Split(p, ",") {
+		var entries []map[string]any
+		if err := config.ReadFile(path, &entries); err != nil {
+			return nil, err
 		}
-		if err != nil {
-			if err != io.EOF {
-				log.Printf("stderr mirror error: %v", err)
+		for _, e := range entries {
+			name, _ := e["methodName"].(string)
+			if merged[name] == nil {
+				merged[name] = map[string]any{}
 			}
-			return
+			maps.Copy(merged[name], e)
 		}
 	}
+
+	var cs []MethodConfig
+	for name, e := range merged {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return nil, fmt.Errorf("failed to merge config for %s: %w", name, err)
+		}
+		var c MethodConfig
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal config for %s: %w", name, err)
+		}
+		cs = append(cs, c)
+	}
+	return configsByName(cs), nil
+}
+
+// loadConfigEnv loads the config from the environment variable name, in JSON
+// or YAML.
+func loadConfigEnv(name string) (map[string]MethodConfig, error) {
+	var cs []MethodConfig
+	if err := config.ReadEnv(name, &cs); err != nil {
+		return nil, err
+	}
+	return configsByName(cs), nil
+}
+
+func configsByName(cs []MethodConfig) map[string]MethodConfig {
+	m := map[string]MethodConfig{}
+	for _, c := range cs {
+		m[c.MethodName] = c
+	}
+	return m
 }
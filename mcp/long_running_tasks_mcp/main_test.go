@@ -0,0 +1,474 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/poy/adk-rnd/mcp/internal/mcptest"
+)
+
+func TestRunIDsAreNotSequential(t *testing.T) {
+	f := func() *mcp.CallToolResult { return mcp.NewToolResultText("done") }
+	first, second := Run("test", nil, f).ID, Run("test", nil, f).ID
+
+	if first == second {
+		t.Fatalf("expected unique IDs, got %q twice", first)
+	}
+	a, errA := strconv.ParseUint(first, 10, 64)
+	b, errB := strconv.ParseUint(second, 10, 64)
+	if errA == nil && errB == nil && b == a+1 {
+		t.Fatalf("expected unguessable IDs, got sequential %q and %q", first, second)
+	}
+	if len(first) != 32 {
+		t.Fatalf("expected a 128-bit hex ID, got %q", first)
+	}
+}
+
+func TestRunQueuesTasksOverLimit(t *testing.T) {
+	prev := workers
+	workers = &taskPool{max: 2}
+	defer func() { workers = prev }()
+
+	release := make(chan struct{})
+	started := make(chan int, 3)
+	task := func(i int) func() *mcp.CallToolResult {
+		return func() *mcp.CallToolResult {
+			started <- i
+			<-release
+			return mcp.NewToolResultText("done")
+		}
+	}
+
+	tasks := []*LongRunningTask{Run("test", nil, task(0)), Run("test", nil, task(1)), Run("test", nil, task(2))}
+	for range 2 {
+		if i := <-started; i == 2 {
+			t.Fatal("expected the third task to wait for a slot")
+		}
+	}
+	select {
+	case <-started:
+		t.Fatal("expected only two tasks to run at once")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if pos := workers.position(tasks[2]); pos != 1 {
+		t.Fatalf("expected the third task to be first in the queue, got position %d", pos)
+	}
+	if tasks[2].Status() != Pending {
+		t.Fatalf("expected the queued task to be pending, got %v", tasks[2].Status())
+	}
+
+	// Finishing one task frees a slot for the queued one.
+	release <- struct{}{}
+	select {
+	case i := <-started:
+		if i != 2 {
+			t.Fatalf("expected the queued task to start, got task %d", i)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("queued task never started")
+	}
+	if pos := workers.position(tasks[2]); pos != 0 {
+		t.Fatalf("expected the task to have left the queue, got position %d", pos)
+	}
+	close(release)
+	for _, task := range tasks {
+		waitForDone(t, task)
+	}
+}
+
+func TestResultSurvivesRestart(t *testing.T) {
+	prev := workers
+	defer func() { workers = prev }()
+	dir := t.TempDir()
+	workers = &taskPool{}
+	if _, err := workers.openStore(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	task := Run("test", nil, func() *mcp.CallToolResult { return mcp.NewToolResultText("persisted") })
+	// The pool saves the result after the task is marked done, so wait for
+	// it to go idle.
+	deadline := time.Now().Add(time.Second)
+	for {
+		workers.mu.Lock()
+		running := workers.running
+		workers.mu.Unlock()
+		if running == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("task never finished")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Simulate a restart: forget every task and reload them from disk.
+	longRunningTasks.Range(func(k, _ any) bool {
+		longRunningTasks.Delete(k)
+		return true
+	})
+	workers = &taskPool{}
+	if _, err := workers.openStore(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := checkLongRunningTaskHandler(context.Background(), checkRequest(task.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text, _ := res.Content[0].(mcp.TextContent); res.IsError || text.Text != "persisted" {
+		t.Fatalf("expected the persisted result, got %+v", res)
+	}
+}
+
+func TestPendingTaskIsInterruptedByRestart(t *testing.T) {
+	dir := t.TempDir()
+	s, err := newTaskStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.save(&LongRunningTask{ID: "abc", status: Pending}); err != nil {
+		t.Fatal(err)
+	}
+
+	tasks, err := s.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 1 || tasks[0].Status() != Done || !tasks[0].result.IsError {
+		t.Fatalf("expected the pending task to come back as failed, got %+v", tasks)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "abc.json")); err != nil {
+		t.Fatalf("expected the task file to remain, got %v", err)
+	}
+}
+
+// waitForDone waits for the task to finish.
+func waitForDone(t *testing.T, task *LongRunningTask) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for task.Status() != Done {
+		if time.Now().After(deadline) {
+			t.Fatal("task never finished")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func checkRequest(id string) mcp.CallToolRequest {
+	var req mcp.CallToolRequest
+	req.Params.Name = "check_long_running_task"
+	req.Params.Arguments = map[string]any{"id": id}
+	return req
+}
+
+func TestCheckPendingTaskWithoutCooldown(t *testing.T) {
+	defer func(d time.Duration) { checkCooldown = d }(checkCooldown)
+	checkCooldown = 0
+
+	release := make(chan struct{})
+	defer close(release)
+	res := startLongRunningTask(mcp.CallToolRequest{Params: mcp.CallToolParams{Name: "slow"}}, false, "check_long_running_task", func() *mcp.CallToolResult {
+		<-release
+		return mcp.NewToolResultText("done")
+	})
+	id := res.StructuredContent.(struct {
+		LongRunningTaskID string `json:"long_running_task_id"`
+	}).LongRunningTaskID
+
+	start := time.Now()
+	res, err := checkLongRunningTaskHandler(context.Background(), checkRequest(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected an immediate answer without a cooldown, took %v", elapsed)
+	}
+	if text, _ := res.Content[0].(mcp.TextContent); !strings.Contains(text.Text, "is pending") {
+		t.Fatalf("expected the task to be pending, got %+v", res)
+	}
+}
+
+func TestLoadConfigFromEnv(t *testing.T) {
+	t.Setenv("TEST_LRO_CONFIG", "- methodName: slow\n  enabled: true\n")
+	cs, err := loadConfigEnv("TEST_LRO_CONFIG")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, ok := cs["slow"]; !ok || !c.Enabled {
+		t.Fatalf("expected slow to be enabled, got %+v", cs)
+	}
+	if _, err := loadConfig("-"); err == nil {
+		t.Fatal("expected reading config from stdin to be refused")
+	}
+}
+
+func TestLoadConfigMergesOverrideFiles(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.yaml")
+	override := filepath.Join(dir, "override.json")
+	if err := os.WriteFile(base, []byte("- methodName: deploy\n  enabled: true\n- methodName: build\n  enabled: true\n  coalesce: true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(override, []byte(`[{"methodName": "build", "enabled": false}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cs, err := loadConfig(base + "," + override)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]MethodConfig{
+		"deploy": {MethodName: "deploy", Enabled: true},
+		"build":  {MethodName: "build", Enabled: false, Coalesce: true},
+	}
+	if !reflect.DeepEqual(cs, want) {
+		t.Fatalf("expected the override to flip only build's enabled, got %+v", cs)
+	}
+}
+
+func TestCheckToolIsNamespacedOnCollision(t *testing.T) {
+	ctx := context.Background()
+	upstream := server.NewMCPServer("fake-upstream", "test")
+	upstream.AddTool(mcp.NewTool("check_long_running_task"), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("upstream"), nil
+	})
+	up := mcptest.NewClient(t, upstream)
+	tools, err := up.ListTools(ctx, mcp.ListToolsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := server.NewMCPServer("proxy", "test")
+	checkToolName := registerTools(s, tools.Tools, up.CallTool, nil)
+	if checkToolName != "__check_long_running_task" {
+		t.Fatalf("expected the injected tool to be namespaced, got %q", checkToolName)
+	}
+
+	proxy := mcptest.NewClient(t, s)
+
+	res, err := proxy.CallTool(ctx, checkRequest("abc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text, _ := res.Content[0].(mcp.TextContent); text.Text != "upstream" {
+		t.Fatalf("expected the upstream tool to be reachable, got %+v", res)
+	}
+	req := checkRequest("abc")
+	req.Params.Name = checkToolName
+	res, err = proxy.CallTool(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text, _ := res.Content[0].(mcp.TextContent); !res.IsError || !strings.Contains(text.Text, "unknown task ID") {
+		t.Fatalf("expected the injected tool to check tasks, got %+v", res)
+	}
+}
+
+func TestMethodNamePatternsSelectLROTools(t *testing.T) {
+	ctx := context.Background()
+	upstream := server.NewMCPServer("fake-upstream", "test")
+	for _, name := range []string{"delete_user", "delete_table", "get_user"} {
+		upstream.AddTool(mcp.NewTool(name), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultText("done"), nil
+		})
+	}
+	up := mcptest.NewClient(t, upstream)
+	tools, err := up.ListTools(ctx, mcp.ListToolsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := server.NewMCPServer("proxy", "test")
+	registerTools(s, tools.Tools, up.CallTool, map[string]MethodConfig{"delete_*": {MethodName: "delete_*", Enabled: true}})
+	proxy := mcptest.NewClient(t, s)
+
+	for name, wantLRO := range map[string]bool{"delete_user": true, "delete_table": true, "get_user": false} {
+		var req mcp.CallToolRequest
+		req.Params.Name = name
+		res, err := proxy.CallTool(ctx, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		text, _ := res.Content[0].(mcp.TextContent)
+		if gotLRO := strings.HasPrefix(text.Text, "Started long running task"); gotLRO != wantLRO {
+			t.Errorf("%s: expected LRO %v, got %q", name, wantLRO, text.Text)
+		}
+	}
+}
+
+func TestOverlappingPatternsPreferMostSpecific(t *testing.T) {
+	lroMethods := map[string]MethodConfig{
+		"*":             {MethodName: "*", Enabled: true},
+		"delete_*":      {MethodName: "delete_*", Enabled: true},
+		"delete_?ser":   {MethodName: "delete_?ser", Enabled: true},
+		"delete_[tu]*":  {MethodName: "delete_[tu]*", Enabled: true},
+		"*_user":        {MethodName: "*_user", Enabled: true},
+		"delete_user_*": {MethodName: "delete_user_*", Enabled: true},
+	}
+	// Run it repeatedly, as map order changes from one range to the next.
+	for range 20 {
+		for name, want := range map[string]string{
+			"delete_user":  "delete_?ser",
+			"delete_table": "delete_[tu]*",
+			"delete_row":   "delete_*",
+			"get_user":     "*_user",
+			"list":         "*",
+		} {
+			if c, ok := lroConfig(lroMethods, name); !ok || c.MethodName != want {
+				t.Fatalf("%s: expected %s to apply, got %+v", name, want, c)
+			}
+		}
+	}
+}
+
+func TestListLROConfigFlagsUnmatchedNames(t *testing.T) {
+	ctx := context.Background()
+	upstream := server.NewMCPServer("fake-upstream", "test")
+	for _, name := range []string{"delete_user", "get_user"} {
+		upstream.AddTool(mcp.NewTool(name), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultText("done"), nil
+		})
+	}
+	up := mcptest.NewClient(t, upstream)
+	tools, err := up.ListTools(ctx, mcp.ListToolsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := server.NewMCPServer("proxy", "test")
+	registerTools(s, tools.Tools, up.CallTool, map[string]MethodConfig{
+		"delete_*": {MethodName: "delete_*", Enabled: true},
+		"get_usr":  {MethodName: "get_usr", Enabled: true},
+	})
+	proxy := mcptest.NewClient(t, s)
+
+	var req mcp.CallToolRequest
+	req.Params.Name = "list_lro_config"
+	res, err := proxy.CallTool(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var plan lroPlan
+	if err := json.Unmarshal([]byte(res.Content[0].(mcp.TextContent).Text), &plan); err != nil {
+		t.Fatal(err)
+	}
+	want := lroPlan{
+		Tools: []lroPlanTool{
+			{Name: "delete_user", Mode: "lro", MethodName: "delete_*"},
+			{Name: "get_user", Mode: "passthrough"},
+		},
+		Unmatched: []string{"get_usr"},
+	}
+	if !reflect.DeepEqual(plan, want) {
+		t.Fatalf("expected %+v, got %+v", want, plan)
+	}
+}
+
+func TestIdenticalCallsCoalesce(t *testing.T) {
+	ctx := context.Background()
+	var calls atomic.Int32
+	release := make(chan struct{})
+	upstream := server.NewMCPServer("fake-upstream", "test")
+	upstream.AddTool(mcp.NewTool("slow", mcp.WithString("q")), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		calls.Add(1)
+		<-release
+		return mcp.NewToolResultText("done"), nil
+	})
+	up := mcptest.NewClient(t, upstream)
+	tools, err := up.ListTools(ctx, mcp.ListToolsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := server.NewMCPServer("proxy", "test")
+	registerTools(s, tools.Tools, up.CallTool, map[string]MethodConfig{"slow": {MethodName: "slow", Enabled: true, Coalesce: true}})
+	proxy := mcptest.NewClient(t, s)
+
+	taskID := regexp.MustCompile(`[0-9a-f]{32}`)
+	start := func(q string) string {
+		t.Helper()
+		var req mcp.CallToolRequest
+		req.Params.Name = "slow"
+		req.Params.Arguments = map[string]any{"q": q}
+		res, err := proxy.CallTool(ctx, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return taskID.FindString(res.Content[0].(mcp.TextContent).Text)
+	}
+	first, second, other := start("a"), start("a"), start("b")
+	if first == "" || first != second {
+		t.Fatalf("expected identical calls to share a task, got %q and %q", first, second)
+	}
+	if other == first {
+		t.Fatal("expected a call with different arguments to get its own task")
+	}
+
+	close(release)
+	val, _ := longRunningTasks.Load(first)
+	deadline := time.Now().Add(time.Second)
+	for val.(*LongRunningTask).Status() != Done {
+		if time.Now().After(deadline) {
+			t.Fatal("task never finished")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	val, _ = longRunningTasks.Load(other)
+	for val.(*LongRunningTask).Status() != Done {
+		if time.Now().After(deadline) {
+			t.Fatal("task never finished")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("expected one upstream call per distinct request, got %d", n)
+	}
+
+	// Once the task is done, the same call starts afresh.
+	if again := start("a"); again == first {
+		t.Fatal("expected a finished task not to be reused")
+	}
+}
+
+func TestCheckResponseNamesOriginatingCall(t *testing.T) {
+	res := startLongRunningTask(mcp.CallToolRequest{Params: mcp.CallToolParams{
+		Name:      "delete_user",
+		Arguments: map[string]any{"id": 7},
+	}}, false, "check_long_running_task", func() *mcp.CallToolResult { return mcp.NewToolResultText("deleted") })
+	id := res.StructuredContent.(struct {
+		LongRunningTaskID string `json:"long_running_task_id"`
+	}).LongRunningTaskID
+
+	val, _ := longRunningTasks.Load(id)
+	deadline := time.Now().Add(time.Second)
+	for val.(*LongRunningTask).Status() != Done {
+		if time.Now().After(deadline) {
+			t.Fatal("task never finished")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	res, err := checkLongRunningTaskHandler(context.Background(), checkRequest(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text, _ := res.Content[0].(mcp.TextContent); text.Text != "deleted" {
+		t.Fatalf("expected the upstream result first, got %+v", res.Content)
+	}
+	last, _ := res.Content[len(res.Content)-1].(mcp.TextContent)
+	if !strings.Contains(last.Text, `delete_user({"id":7})`) {
+		t.Fatalf("expected the check response to name the originating call, got %q", last.Text)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// taskStore keeps one JSON file per task in dir, named after the task ID.
+type taskStore struct {
+	dir string
+}
+
+type taskRecord struct {
+	ID        string              `json:"id"`
+	Tool      string              `json:"tool,omitempty"`
+	Arguments any                 `json:"arguments,omitempty"`
+	Status    string              `json:"status"`
+	Result    *mcp.CallToolResult `json:"result,omitempty"`
+}
+
+func newTaskStore(dir string) (*taskStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create store dir: %w", err)
+	}
+	return &taskStore{dir: dir}, nil
+}
+
+// save writes the task's current state. The file is replaced atomically so
+// a crash mid-write leaves the previous state.
+func (s *taskStore) save(t *LongRunningTask) error {
+	t.mu.Lock()
+	rec := taskRecord{ID: t.ID, Tool: t.Tool, Arguments: t.Arguments, Status: t.status.String(), Result: t.result}
+	t.mu.Unlock()
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal task %s: %w", t.ID, err)
+	}
+	tmp, err := os.CreateTemp(s.dir, t.ID+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(s.dir, t.ID+".json"))
+}
+
+// load reads every saved task. Tasks that were still pending belonged to a
+// previous process and will never finish, so they come back done with an
+// error result.
+func (s *taskStore) load() ([]*LongRunningTask, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read store dir: %w", err)
+	}
+
+	var tasks []*LongRunningTask
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var rec taskRecord
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", e.Name(), err)
+		}
+
+		t := &LongRunningTask{ID: rec.ID, Tool: rec.Tool, Arguments: rec.Arguments, status: Done, result: rec.Result}
+		if rec.Status != Done.String() || rec.Result == nil {
+			t.result = mcp.NewToolResultError("task was interrupted when the proxy restarted")
+			if err := s.save(t); err != nil {
+				slog.Error("failed to save task", "id", t.ID, "err", err)
+			}
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, nil
+}
+
+// openStore enables persistence to dir for the pool's tasks and registers
+// the tasks saved there, returning how many were loaded. It must be called
+// before any task is submitted.
+func (p *taskPool) openStore(dir string) (int, error) {
+	s, err := newTaskStore(dir)
+	if err != nil {
+		return 0, err
+	}
+	tasks, err := s.load()
+	if err != nil {
+		return 0, err
+	}
+	for _, t := range tasks {
+		longRunningTasks.Store(t.ID, t)
+	}
+	p.store = s
+	return len(tasks), nil
+}
+
+// save persists the task if the pool has a store.
+func (p *taskPool) save(t *LongRunningTask) {
+	if p.store == nil {
+		return
+	}
+	if err := p.store.save(t); err != nil {
+		slog.Error("failed to save task", "id", t.ID, "err", err)
+	}
+}
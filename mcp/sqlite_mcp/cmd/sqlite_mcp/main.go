@@ -2,18 +2,55 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
+	"os"
+	"strings"
 
 	"github.com/mark3labs/mcp-go/server"
+	"github.com/poy/adk-rnd/mcp/internal/metatool"
 	"github.com/poy/adk-rnd/mcp/sqlite_mcp/pkg/mcpserver"
 )
 
-var dataDir = flag.String("data-dir", "/tmp/sqlite_mcp", "The directory to store the data")
+var (
+	dataDir    = flag.String("data-dir", "/tmp/sqlite_mcp", "The directory to store the data")
+	stream     = flag.Bool("stream", false, "Stream run_sql rows as progress notifications to clients that request progress")
+	maxMB      = flag.Int64("max-total-mb", 0, "Refuse new sessions once database files use this many MB (default unlimited)")
+	key        = flag.String("encryption-key", "", "Encrypt database files with this key; requires SQLCipher. Falls back to $SQLITE_MCP_ENCRYPTION_KEY")
+	structured = flag.Bool("structured-results", false, "Also return JSON results as structured content for clients that support it")
+	allowed    = flag.String("allowed-statements", "", "Comma-separated statement types clients may run, e.g. SELECT,INSERT (default any)")
+	maxCell    = flag.Int("max-cell-bytes", 0, "Truncate text and blob values in results to this many bytes (default unlimited)")
+	discovery  = flag.Bool("session-discovery", false, "Add the label_session and list_sessions tools. They let any client find and open every session, so only use this when clients may share sessions")
+
+	showVersion = flag.Bool("version", false, "Print the version and exit")
+)
 
 func main() {
 	log.SetFlags(0)
 	flag.Parse()
-	srv := mcpserver.New(*dataDir)
+	if *showVersion {
+		fmt.Println(version)
+		return
+	}
+
+	if *key == "" {
+		*key = os.Getenv("SQLITE_MCP_ENCRYPTION_KEY")
+	}
+
+	opts := []mcpserver.Option{mcpserver.WithStreaming(*stream), mcpserver.WithMaxTotalMB(*maxMB), mcpserver.WithVersion(version), mcpserver.WithStructuredResults(*structured), mcpserver.WithMaxCellBytes(*maxCell), mcpserver.WithSessionDiscovery(*discovery)}
+	if *allowed != "" {
+		opts = append(opts, mcpserver.WithAllowedStatements(strings.Split(*allowed, ",")))
+	}
+	if *key != "" {
+		opt, err := mcpserver.WithEncryptionKey(*key)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, opt)
+	}
+
+	srv := mcpserver.New(*dataDir, opts...)
+	metatool.AddServerInfo(srv, version, nil, nil)
 	if err := server.ServeStdio(srv); err != nil {
 		log.Fatalf("failed to serve stdio: %v", err)
 	}
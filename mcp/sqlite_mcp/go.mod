@@ -3,8 +3,9 @@ module github.com/poy/adk-rnd/mcp/sqlite_mcp
 go 1.24.4
 
 require (
-	github.com/mark3labs/mcp-go v0.37.0
+	github.com/mark3labs/mcp-go v0.38.0
 	github.com/mattn/go-sqlite3 v1.14.31
+	github.com/poy/adk-rnd/mcp/internal v0.0.0
 )
 
 require (
@@ -18,3 +19,5 @@ require (
 	github.com/yosida95/uritemplate/v3 v3.0.2 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+replace github.com/poy/adk-rnd/mcp/internal => ../internal
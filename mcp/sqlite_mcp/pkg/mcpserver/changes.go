@@ -0,0 +1,205 @@
+package mcpserver
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// changesTable is the change log that watch_table's triggers write to. It
+// lives in the session's database, so it goes away with the session.
+const changesTable = "_mcp_changes"
+
+func (s *handlers) watchTableHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	session, err := req.RequireString("session")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	table, err := req.RequireString("table")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	// Watching creates the changes table and the triggers that fill it.
+	if err := s.checkAllowed("CREATE"); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	db, err := s.manager.GetDB(session)
+	if err != nil {
+		return mcp.NewToolResultErrorFromErr("invalid session", err), nil
+	}
+	defer db.Close()
+
+	cols, err := tableColumns(ctx, db, table)
+	if err != nil {
+		return nil, err
+	}
+	if len(cols) == 0 {
+		return mcp.NewToolResultError(fmt.Sprintf("no such table: %s", table)), nil
+	}
+	// Changes are keyed by rowid, which WITHOUT ROWID tables don't have.
+	var withoutRowid bool
+	if err := db.QueryRowContext(ctx, "SELECT COALESCE(MAX(wr), 0) FROM pragma_table_list WHERE name = ? COLLATE NOCASE;", table).Scan(&withoutRowid); err != nil {
+		return nil, err
+	}
+	if withoutRowid {
+		return mcp.NewToolResultError(fmt.Sprintf("can't watch %s: WITHOUT ROWID tables aren't supported", table)), nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		tbl TEXT NOT NULL,
+		op TEXT NOT NULL,
+		row_id INTEGER,
+		row TEXT,
+		changed_at TEXT NOT NULL DEFAULT (strftime('%%Y-%%m-%%dT%%H:%%M:%%fZ', 'now'))
+	);`, quoteIdent(changesTable))); err != nil {
+		return mcp.NewToolResultErrorFromErr("sql error", err), nil
+	}
+
+	// Each trigger records the row as JSON: the new values for inserts and
+	// updates, the old values for deletes. JSON can't hold BLOBs, so those
+	// are recorded as hex.
+	for _, t := range []struct{ op, ref string }{
+		{"INSERT", "NEW"},
+		{"UPDATE", "NEW"},
+		{"DELETE", "OLD"},
+	} {
+		pairs := make([]string, len(cols))
+		for i, col := range cols {
+			val := t.ref + "." + quoteIdent(col)
+			pairs[i] = fmt.Sprintf("%s, CASE WHEN typeof(%s) = 'blob' THEN hex(%s) ELSE %s END", quoteString(col), val, val, val)
+		}
+		trigger := quoteIdent(fmt.Sprintf("_mcp_watch_%s_%s", table, strings.ToLower(t.op)))
+		stmt := fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %s AFTER %s ON %s BEGIN
+			INSERT INTO %s (tbl, op, row_id, row) VALUES (%s, %s, %s.rowid, json_object(%s));
+		END;`, trigger, t.op, quoteIdent(table), quoteIdent(changesTable), quoteString(table), quoteString(strings.ToLower(t.op)), t.ref, strings.Join(pairs, ", "))
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return mcp.NewToolResultErrorFromErr("sql error", err), nil
+		}
+	}
+
+	// Hand back the current position so the caller only sees changes made
+	// from now on.
+	var cursor int64
+	if err := tx.QueryRowContext(ctx, fmt.Sprintf("SELECT COALESCE(MAX(id), 0) FROM %s;", quoteIdent(changesTable))).Scan(&cursor); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	jsonBytes, _ := json.Marshal(map[string]any{
+		"result": "ok",
+		"cursor": cursor,
+	})
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{
+				Type: "text",
+				Text: string(jsonBytes),
+			},
+		},
+	}, nil
+}
+
+func (s *handlers) pollChangesHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	session, err := req.RequireString("session")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	cursor := req.GetInt("cursor", 0)
+	limit := req.GetInt("limit", 100)
+
+	db, err := s.manager.GetDB(session)
+	if err != nil {
+		return mcp.NewToolResultErrorFromErr("invalid session", err), nil
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT id, tbl, op, row_id, row, changed_at FROM %s WHERE id > ? ORDER BY id LIMIT ?;", quoteIdent(changesTable)), cursor, limit)
+	if err != nil {
+		if strings.Contains(err.Error(), "no such table") {
+			return mcp.NewToolResultError("no tables are being watched; call watch_table first"), nil
+		}
+		return mcp.NewToolResultErrorFromErr("sql error", err), nil
+	}
+	defer rows.Close()
+
+	type change struct {
+		ID        int64           `json:"id"`
+		Table     string          `json:"table"`
+		Op        string          `json:"op"`
+		RowID     int64           `json:"row_id"`
+		Row       json.RawMessage `json:"row"`
+		ChangedAt string          `json:"changed_at"`
+	}
+	changes := []change{}
+	next := int64(cursor)
+	for rows.Next() {
+		var (
+			c   change
+			row string
+		)
+		if err := rows.Scan(&c.ID, &c.Table, &c.Op, &c.RowID, &row, &c.ChangedAt); err != nil {
+			return nil, err
+		}
+		c.Row = json.RawMessage(row)
+		changes = append(changes, c)
+		next = c.ID
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	jsonBytes, err := json.Marshal(map[string]any{
+		"changes": changes,
+		"cursor":  next,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{
+				Type: "text",
+				Text: string(jsonBytes),
+			},
+		},
+	}, nil
+}
+
+// tableColumns returns the table's column names, or none if it doesn't
+// exist.
+func tableColumns(ctx context.Context, db *sql.DB, table string) ([]string, error) {
+	rows, err := db.QueryContext(ctx, "SELECT name FROM pragma_table_info(?);", table)
+	if err != nil {
+		return nil, fmt.Errorf("sql error: %w", err)
+	}
+	defer rows.Close()
+
+	var cols []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		cols = append(cols, name)
+	}
+	return cols, rows.Err()
+}
+
+// quoteString quotes s as an SQL string literal.
+func quoteString(s string) string {
+	return `'` + strings.ReplaceAll(s, `'`, `''`) + `'`
+}
@@ -0,0 +1,75 @@
+package mcpserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func (s *handlers) importSQLHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	session, err := req.RequireString("session")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	script, err := req.RequireString("script")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	// Dumps made with the sqlite3 shell's .dump wrap themselves in a
+	// transaction. The script already runs in one, so those are skipped.
+	var stmts []string
+	for _, stmt := range splitStatements(script) {
+		switch statementType(stmt) {
+		case "BEGIN", "COMMIT", "END":
+			continue
+		case "ROLLBACK":
+			if !strings.Contains(strings.ToUpper(stmt), " TO ") {
+				return mcp.NewToolResultError("script contains ROLLBACK; nothing was imported"), nil
+			}
+		}
+		stmts = append(stmts, stmt)
+	}
+	if len(stmts) == 0 {
+		return mcp.NewToolResultError("script contains no statements"), nil
+	}
+	if err := s.checkAllowed(stmts...); err != nil {
+		return mcp.NewToolResultError(err.Error() + "; nothing was imported"), nil
+	}
+
+	db, err := s.manager.GetDB(session)
+	if err != nil {
+		return mcp.NewToolResultErrorFromErr("invalid session", err), nil
+	}
+	defer db.Close()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	for i, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return mcp.NewToolResultErrorFromErr(fmt.Sprintf("sql error in statement %d (%q), nothing was imported", i+1, truncate(stmt, 60)), err), nil
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return mcp.NewToolResultErrorFromErr("sql error", err), nil
+	}
+
+	jsonBytes, _ := json.Marshal(map[string]any{
+		"statements": len(stmts),
+	})
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{
+				Type: "text",
+				Text: string(jsonBytes),
+			},
+		},
+	}, nil
+}
@@ -2,48 +2,412 @@ package mcpserver
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"os"
+	"sort"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
+	"github.com/mattn/go-sqlite3"
 	"github.com/poy/adk-rnd/mcp/sqlite_mcp/pkg/sessionmanager"
 )
 
-func New(dataDir string) *server.MCPServer {
+// Option configures the server returned by New.
+type Option func(*handlers)
+
+// WithStreaming makes run_sql send each row to the client as a progress
+// notification while it is scanned instead of buffering the whole result.
+// Rows are only streamed for calls that carry a progress token; other calls
+// use the buffered response.
+func WithStreaming(enabled bool) Option {
+	return func(h *handlers) {
+		h.stream = enabled
+	}
+}
+
+// WithVersion sets the version the server reports to clients.
+func WithVersion(version string) Option {
+	return func(h *handlers) {
+		h.version = version
+	}
+}
+
+// WithMaxTotalMB caps the disk space used by database files. Once it is used
+// up, create_db refuses new on-disk sessions until old ones expire.
+func WithMaxTotalMB(mb int64) Option {
+	return func(h *handlers) {
+		h.manager.SetMaxTotalBytes(mb << 20)
+	}
+}
+
+// WithEncryptionKey encrypts on-disk session databases with key. It returns
+// sessionmanager.ErrEncryptionUnsupported if the linked SQLite library can't
+// encrypt.
+func WithEncryptionKey(key string) (Option, error) {
+	if key != "" && !sessionmanager.EncryptionSupported() {
+		return nil, sessionmanager.ErrEncryptionUnsupported
+	}
+	return func(h *handlers) {
+		// Support was checked above, so this can't fail.
+		_ = h.manager.SetEncryptionKey(key)
+	}, nil
+}
+
+// WithSessionDiscovery adds the label_session and list_sessions tools.
+// Session IDs are unguessable so that one client can't open another's
+// session; listing hands every client every ID, and labels are names a
+// client can guess. Only enable it when all clients may share sessions,
+// such as a single agent talking to its own server.
+func WithSessionDiscovery(enabled bool) Option {
+	return func(h *handlers) {
+		h.discovery = enabled
+	}
+}
+
+// WithStructuredResults makes tools that answer with a JSON object also
+// return it as structured content, alongside the text for clients that can't
+// use it.
+func WithStructuredResults(enabled bool) Option {
+	return func(h *handlers) {
+		h.structured = enabled
+	}
+}
+
+// WithAllowedStatements restricts the SQL clients may run to statements whose
+// leading keyword, such as SELECT or INSERT, is one of types. Nothing is
+// restricted when types is empty. Statements starting with WITH are their own
+// type, so allow it only if every kind of statement a CTE can prefix is
+// acceptable. Tools that run SQL of their own are held to the statements they
+// issue: watch_table needs CREATE, maintain_db needs VACUUM and ANALYZE, and
+// begin_snapshot needs PRAGMA unless the database is already in WAL mode.
+func WithAllowedStatements(types []string) Option {
+	return func(h *handlers) {
+		if len(types) == 0 {
+			h.allowed = nil
+			return
+		}
+		h.allowed = map[string]bool{}
+		for _, t := range types {
+			h.allowed[strings.ToUpper(strings.TrimSpace(t))] = true
+		}
+	}
+}
+
+// WithMaxCellBytes caps the size of each text or blob value in query
+// results. Longer values are cut short and end with a marker giving their
+// original length, so one large cell can't swamp the response. Values aren't
+// capped when n is 0.
+func WithMaxCellBytes(n int) Option {
+	return func(h *handlers) {
+		h.maxCellBytes = n
+	}
+}
+
+func New(dataDir string, opts ...Option) *server.MCPServer {
 	mgr := sessionmanager.NewSessionManager(dataDir, 15*time.Minute)
 
 	s := &handlers{
 		manager: mgr,
+		version: "v0.0.1",
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
 
-	server := server.NewMCPServer("SQLite", "v0.0.1")
+	sessionDesc := "Session ID returned after you create a database with create_db"
+	if s.discovery {
+		sessionDesc += ", or a label set with label_session"
+	}
+
+	var serverOpts []server.ServerOption
+	if s.structured {
+		serverOpts = append(serverOpts, server.WithToolHandlerMiddleware(structuredResults))
+	}
+	server := server.NewMCPServer("SQLite", s.version, serverOpts...)
 	server.AddTool(mcp.NewTool("create_db",
 		mcp.WithDescription("Create a new SQLite database session. This will provide a session that will be used with other method calls"),
+		mcp.WithBoolean("in_memory",
+			mcp.Description("Keep the database in memory instead of on disk. Useful for throwaway scratch work. Defaults to false."),
+		),
 	), s.createDBHandler)
+	server.AddTool(mcp.NewTool("clone_session",
+		mcp.WithDescription("Copy a session's database into a new, independent session, for example to try changes without touching the original. Returns the new session ID. In-memory sessions can't be cloned."),
+		mcp.WithString("session",
+			mcp.Required(),
+			mcp.Description(sessionDesc),
+		),
+	), s.cloneSessionHandler)
 	server.AddTool(mcp.NewTool("run_sql",
 		mcp.WithDescription("Execute a SQL statement against a session database"),
 		mcp.WithString("session",
 			mcp.Required(),
-			mcp.Description("Session ID returned after you create a database with create_db"),
+			mcp.Description(sessionDesc),
 		),
 		mcp.WithString("sql",
 			mcp.Required(),
-			mcp.Description("SQL statement to run. Must only be a single SQL statement."),
+			mcp.Description("SQL statement to run. Must only be a single SQL statement unless allow_multi is set."),
+		),
+		mcp.WithBoolean("allow_multi",
+			mcp.Description("Allow several semicolon-separated statements. They run in order and only the last one's result is returned. Can't be combined with params or pagination. Defaults to false."),
+		),
+		mcp.WithArray("params",
+			mcp.Description("Values for the statement's positional ? placeholders, in order."),
+		),
+		mcp.WithObject("named_params",
+			mcp.Description("Values for the statement's :name, @name or $name placeholders, keyed by name without the prefix. Can't be combined with params."),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum number of rows to return from a SELECT. Ignored if the statement already has a LIMIT clause."),
+		),
+		mcp.WithNumber("offset",
+			mcp.Description("Number of rows to skip before returning rows from a SELECT. Ignored if the statement already has a LIMIT clause."),
+		),
+		mcp.WithString("snapshot",
+			mcp.Description("Snapshot ID from begin_snapshot for the same session. The statement reads the database as it was when the snapshot began and can't write."),
 		),
 	), s.runSQLHandler)
+	server.AddTool(mcp.NewTool("query_table",
+		mcp.WithDescription("Run a query and return the rows as an aligned markdown table instead of JSON. Easier to read than run_sql for browsing data."),
+		mcp.WithString("session",
+			mcp.Required(),
+			mcp.Description(sessionDesc),
+		),
+		mcp.WithString("sql",
+			mcp.Required(),
+			mcp.Description("Query to run. Must only be a single SQL statement that returns rows."),
+		),
+		mcp.WithArray("params",
+			mcp.Description("Values for the statement's positional ? placeholders, in order."),
+		),
+		mcp.WithObject("named_params",
+			mcp.Description("Values for the statement's :name, @name or $name placeholders, keyed by name without the prefix. Can't be combined with params."),
+		),
+		mcp.WithNumber("max_rows",
+			mcp.Description(fmt.Sprintf("Maximum number of rows to show. Defaults to %d.", defaultTableRows)),
+		),
+		mcp.WithNumber("max_column_width",
+			mcp.Description(fmt.Sprintf("Longer values are cut short. Defaults to %d characters.", defaultTableColumnWidth)),
+		),
+		mcp.WithString("snapshot",
+			mcp.Description("Snapshot ID from begin_snapshot for the same session. The query reads the database as it was when the snapshot began."),
+		),
+	), s.queryTableHandler)
+	server.AddTool(mcp.NewTool("begin_snapshot",
+		mcp.WithDescription(fmt.Sprintf("Open a read-only, point-in-time view of a session for consistent analysis across several queries. Pass the returned ID as 'snapshot' to run_sql or query_table; those queries won't see writes made after the snapshot began, while other calls can keep writing. Switches the database to WAL mode, which needs PRAGMA to be an allowed statement type. Not available for in-memory sessions. Snapshots end with end_snapshot or after %v unused.", snapshotIdleTimeout)),
+		mcp.WithString("session",
+			mcp.Required(),
+			mcp.Description(sessionDesc),
+		),
+	), s.beginSnapshotHandler)
+	server.AddTool(mcp.NewTool("end_snapshot",
+		mcp.WithDescription("Release a snapshot opened with begin_snapshot."),
+		mcp.WithString("snapshot",
+			mcp.Required(),
+			mcp.Description("Snapshot ID returned by begin_snapshot"),
+		),
+	), s.endSnapshotHandler)
+	server.AddTool(mcp.NewTool("maintain_db",
+		mcp.WithDescription("Run VACUUM and ANALYZE against a session database to reclaim free pages and refresh query planner statistics. Fails while a snapshot or another transaction is open. Returns the size of the database and its WAL file before and after."),
+		mcp.WithString("session",
+			mcp.Required(),
+			mcp.Description(sessionDesc),
+		),
+	), s.maintainDBHandler)
+	server.AddTool(mcp.NewTool("show_create",
+		mcp.WithDescription("Return the SQL that recreates a table: its CREATE TABLE statement followed by CREATE INDEX statements for its indexes, like SHOW CREATE TABLE in other databases."),
+		mcp.WithString("session",
+			mcp.Required(),
+			mcp.Description(sessionDesc),
+		),
+		mcp.WithString("table",
+			mcp.Required(),
+			mcp.Description("Name of the table"),
+		),
+	), s.showCreateHandler)
+	server.AddTool(mcp.NewTool("explain_sql",
+		mcp.WithDescription("Show the query plan SQLite would use for a SELECT statement without running it. Useful for checking whether an index is used."),
+		mcp.WithString("session",
+			mcp.Required(),
+			mcp.Description(sessionDesc),
+		),
+		mcp.WithString("sql",
+			mcp.Required(),
+			mcp.Description("SELECT statement to explain. Must only be a single SQL statement."),
+		),
+	), s.explainSQLHandler)
+	server.AddTool(mcp.NewTool("bulk_insert",
+		mcp.WithDescription("Insert many rows into a table in a single transaction. Much faster than calling run_sql once per row."),
+		mcp.WithString("session",
+			mcp.Required(),
+			mcp.Description(sessionDesc),
+		),
+		mcp.WithString("table",
+			mcp.Required(),
+			mcp.Description("Name of the table to insert into"),
+		),
+		mcp.WithArray("rows",
+			mcp.Required(),
+			mcp.Description("Rows to insert. Each row is an object mapping column name to value, and every row must have the same columns."),
+			mcp.Items(map[string]any{"type": "object"}),
+		),
+	), s.bulkInsertHandler)
+	server.AddTool(mcp.NewTool("upsert",
+		mcp.WithDescription("Insert rows into a table, updating the existing row instead when one has the same values in the conflict columns. Runs in a single transaction, so calling it again with the same rows is safe. Returns how many rows were inserted and how many updated."),
+		mcp.WithString("session",
+			mcp.Required(),
+			mcp.Description(sessionDesc),
+		),
+		mcp.WithString("table",
+			mcp.Required(),
+			mcp.Description("Name of the table to upsert into"),
+		),
+		mcp.WithArray("conflict_columns",
+			mcp.Required(),
+			mcp.Description("Columns that identify a row, such as the primary key. They must be covered by a PRIMARY KEY or UNIQUE constraint, and every row must include them."),
+			mcp.WithStringItems(),
+		),
+		mcp.WithArray("rows",
+			mcp.Required(),
+			mcp.Description("Rows to upsert. Each row is an object mapping column name to value, and every row must have the same columns. Columns other than the conflict columns are overwritten on existing rows."),
+			mcp.Items(map[string]any{"type": "object"}),
+		),
+	), s.upsertHandler)
+	server.AddTool(mcp.NewTool("import_sql",
+		mcp.WithDescription("Run a SQL script, such as a schema or a dump, in a single transaction. If any statement fails nothing is imported. Returns the number of statements run."),
+		mcp.WithString("session",
+			mcp.Required(),
+			mcp.Description(sessionDesc),
+		),
+		mcp.WithString("script",
+			mcp.Required(),
+			mcp.Description("Semicolon-separated SQL statements. Comments are allowed, and BEGIN/COMMIT wrapping the script is ignored."),
+		),
+	), s.importSQLHandler)
+	server.AddTool(mcp.NewTool("reset_data",
+		mcp.WithDescription("Delete every row from every table in a session database and restart AUTOINCREMENT counters, keeping the schema. Runs in a single transaction. Returns the number of rows deleted from each table."),
+		mcp.WithString("session",
+			mcp.Required(),
+			mcp.Description(sessionDesc),
+		),
+	), s.resetDataHandler)
+	server.AddTool(mcp.NewTool("watch_table",
+		mcp.WithDescription("Start recording inserts, updates and deletes on a table so they can be fetched with poll_changes. BLOB values are recorded as hex strings. WITHOUT ROWID tables can't be watched. Returns the cursor to poll from."),
+		mcp.WithString("session",
+			mcp.Required(),
+			mcp.Description(sessionDesc),
+		),
+		mcp.WithString("table",
+			mcp.Required(),
+			mcp.Description("Name of the table to watch"),
+		),
+	), s.watchTableHandler)
+	server.AddTool(mcp.NewTool("poll_changes",
+		mcp.WithDescription("Return changes to watched tables made after the cursor, oldest first, along with the cursor to pass on the next call."),
+		mcp.WithString("session",
+			mcp.Required(),
+			mcp.Description(sessionDesc),
+		),
+		mcp.WithNumber("cursor",
+			mcp.Description("Cursor returned by watch_table or the previous poll_changes call. Defaults to 0, which returns every recorded change."),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum number of changes to return. Defaults to 100."),
+		),
+	), s.pollChangesHandler)
+	server.AddTool(mcp.NewTool("session_metrics",
+		mcp.WithDescription("Report how many run_sql queries a session has run, the rows they returned, how many failed and the total time spent running them."),
+		mcp.WithString("session",
+			mcp.Required(),
+			mcp.Description(sessionDesc),
+		),
+	), s.sessionMetricsHandler)
+	server.AddTool(mcp.NewTool("storage_stats",
+		mcp.WithDescription("Report the number of sessions and the disk space used by their database files, along with the storage quota if one is set."),
+	), s.storageStatsHandler)
+	if s.discovery {
+		addDiscoveryTools(server, s)
+	}
 
 	return server
 }
 
+// addDiscoveryTools registers label_session and list_sessions. Both let any
+// client find sessions without being handed their IDs, so they are only
+// added when WithSessionDiscovery is on.
+func addDiscoveryTools(server *server.MCPServer, s *handlers) {
+	server.AddTool(mcp.NewTool("label_session",
+		mcp.WithDescription("Give a session a human-readable label. The label can then be passed as 'session' to any tool in place of the session ID."),
+		mcp.WithString("session",
+			mcp.Required(),
+			mcp.Description("Session ID returned after you create a database with create_db, or its current label"),
+		),
+		mcp.WithString("label",
+			mcp.Required(),
+			mcp.Description("Label for the session, unique across sessions. An empty label removes the current one."),
+		),
+	), s.labelSessionHandler)
+	server.AddTool(mcp.NewTool("list_sessions",
+		mcp.WithDescription("List the live sessions with their IDs, labels, sizes and access times, a page at a time."),
+		mcp.WithNumber("page",
+			mcp.Description("Page to return, starting at 1. Defaults to 1."),
+		),
+		mcp.WithNumber("page_size",
+			mcp.Description(fmt.Sprintf("Number of sessions per page. Defaults to %d.", defaultSessionPageSize)),
+		),
+		mcp.WithString("sort_by",
+			mcp.Description("Order of the listing: id, created (oldest first), last_access (most recent first) or size (largest first). Defaults to id."),
+			mcp.Enum("id", "created", "last_access", "size"),
+		),
+	), s.listSessionsHandler)
+}
+
 type handlers struct {
 	manager *sessionmanager.SessionManager
+	stream  bool
+	version string
+	// structured adds structured content to JSON object results.
+	structured bool
+	// allowed holds the statement types clients may run, or nil for any.
+	allowed map[string]bool
+	// snapshots holds the read snapshots opened with begin_snapshot.
+	snapshots snapshotSet
+	// discovery adds the tools that find sessions by label or listing.
+	discovery bool
+	// maxCellBytes caps text and blob values in results, or 0 for no cap.
+	maxCellBytes int
+}
+
+// checkAllowed returns an error naming the first statement whose type isn't
+// allowed.
+func (s *handlers) checkAllowed(stmts ...string) error {
+	if s.allowed == nil {
+		return nil
+	}
+	for _, stmt := range stmts {
+		if typ := statementType(stmt); !s.allowed[typ] {
+			return fmt.Errorf("statement type %s not allowed", typ)
+		}
+	}
+	return nil
 }
 
 func (s *handlers) createDBHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	sessionID, err := s.manager.CreateDatabase()
+	create := s.manager.CreateDatabase
+	if req.GetBool("in_memory", false) {
+		create = s.manager.CreateInMemoryDatabase
+	}
+
+	sessionID, err := create()
+	if errors.Is(err, sessionmanager.ErrQuotaExceeded) {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
 	if err != nil {
 		log.Printf("failed to create db: %v", err)
 		return nil, err
@@ -67,40 +431,263 @@ func (s *handlers) createDBHandler(ctx context.Context, req mcp.CallToolRequest)
 	}, nil
 }
 
+func (s *handlers) cloneSessionHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	session, err := req.RequireString("session")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	cloneID, err := s.manager.CloneDatabase(session)
+	if err != nil {
+		return mcp.NewToolResultErrorFromErr("failed to clone session", err), nil
+	}
+
+	contentBytes, err := json.Marshal(map[string]string{
+		"session": cloneID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{
+				Text: string(contentBytes),
+				Type: "text",
+			},
+		},
+	}, nil
+}
+
+func (s *handlers) storageStatsHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	stats, err := s.manager.Stats()
+	if err != nil {
+		return nil, err
+	}
+
+	jsonBytes, err := json.Marshal(stats)
+	if err != nil {
+		return nil, err
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{
+				Type: "text",
+				Text: string(jsonBytes),
+			},
+		},
+	}, nil
+}
+
+func (s *handlers) sessionMetricsHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	session, err := req.RequireString("session")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	metrics, err := s.manager.Metrics(session)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	jsonBytes, err := json.Marshal(metrics)
+	if err != nil {
+		return nil, err
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{
+				Type: "text",
+				Text: string(jsonBytes),
+			},
+		},
+	}, nil
+}
+
+func (s *handlers) labelSessionHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	session, err := req.RequireString("session")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	label, err := req.RequireString("label")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	if err := s.manager.SetLabel(session, label); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	jsonBytes, _ := json.Marshal(map[string]any{
+		"result": "ok",
+		"label":  label,
+	})
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{
+				Type: "text",
+				Text: string(jsonBytes),
+			},
+		},
+	}, nil
+}
+
+// defaultSessionPageSize is list_sessions' page_size when none is given.
+const defaultSessionPageSize = 100
+
+func (s *handlers) listSessionsHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	page := req.GetInt("page", 1)
+	pageSize := req.GetInt("page_size", defaultSessionPageSize)
+	if page < 1 || pageSize < 1 {
+		return mcp.NewToolResultError("'page' and 'page_size' must be at least 1"), nil
+	}
+
+	// ListSessions sorts by ID; the stable sorts keep that as the tie-break.
+	sessions := s.manager.ListSessions()
+	switch sortBy := req.GetString("sort_by", "id"); sortBy {
+	case "id":
+	case "created":
+		sort.SliceStable(sessions, func(i, j int) bool { return sessions[i].CreatedAt.Before(sessions[j].CreatedAt) })
+	case "last_access":
+		sort.SliceStable(sessions, func(i, j int) bool { return sessions[i].LastAccess.After(sessions[j].LastAccess) })
+	case "size":
+		sort.SliceStable(sessions, func(i, j int) bool { return sessions[i].SizeBytes > sessions[j].SizeBytes })
+	default:
+		return mcp.NewToolResultError(fmt.Sprintf("unknown sort_by %q; use id, created, last_access or size", sortBy)), nil
+	}
+
+	resp := map[string]any{
+		"total": len(sessions),
+	}
+	// Check the page before multiplying so a huge page can't overflow.
+	start := len(sessions)
+	if page-1 <= len(sessions)/pageSize {
+		start = min((page-1)*pageSize, len(sessions))
+	}
+	end := start + min(pageSize, len(sessions)-start)
+	resp["sessions"] = sessions[start:end]
+	if end < len(sessions) {
+		resp["next_page"] = page + 1
+	}
+	jsonBytes, err := json.Marshal(resp)
+	if err != nil {
+		return nil, err
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{
+				Type: "text",
+				Text: string(jsonBytes),
+			},
+		},
+	}, nil
+}
+
 func (s *handlers) runSQLHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	args := req.Params.Arguments.(map[string]any)
-	session := args["session"].(string)
-	sqlStmt := args["sql"].(string)
+	var returned int64
+	start := time.Now()
+	res, err := s.runSQL(ctx, req, &returned)
+	s.manager.RecordQuery(strings.TrimSpace(req.GetString("session", "")), returned, time.Since(start), err != nil || res.IsError)
+	return res, err
+}
+
+// runSQL runs the statement, counting the rows it returns in returned.
+func (s *handlers) runSQL(ctx context.Context, req mcp.CallToolRequest, returned *int64) (*mcp.CallToolResult, error) {
+	session, err := req.RequireString("session")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	sqlStmt, err := req.RequireString("sql")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	session, sqlStmt = strings.TrimSpace(session), normalizeSQL(sqlStmt)
 
 	if session == "" || sqlStmt == "" {
-		return nil, fmt.Errorf("missing required parameters 'session' or 'sql'")
+		return mcp.NewToolResultError("missing required parameters 'session' or 'sql'"), nil
 	}
 
-	db, err := s.manager.GetDB(session)
+	// The driver would quietly run only part of a multi-statement string for
+	// queries, so only allow it when asked for.
+	var leading []string
+	if stmts := splitStatements(sqlStmt); len(stmts) > 1 {
+		if !req.GetBool("allow_multi", false) {
+			extra := make([]string, len(stmts)-1)
+			for i, stmt := range stmts[1:] {
+				extra[i] = fmt.Sprintf("%q", truncate(stmt, 60))
+			}
+			return mcp.NewToolResultError(fmt.Sprintf("run_sql runs a single statement but got %d; extra statements: %s. Send them in separate calls or set allow_multi", len(stmts), strings.Join(extra, ", "))), nil
+		}
+		if args := req.GetArguments(); args["params"] != nil || args["named_params"] != nil || req.GetInt("limit", 0) > 0 || req.GetInt("offset", 0) > 0 {
+			return mcp.NewToolResultError("params, named_params, limit and offset can't be used with allow_multi"), nil
+		}
+		leading, sqlStmt = stmts[:len(stmts)-1], stmts[len(stmts)-1]
+	}
+	if err := s.checkAllowed(append(leading, sqlStmt)...); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	var conn *sql.Conn
+	if id := req.GetString("snapshot", ""); id != "" {
+		if err := checkSnapshotStatements(append(leading, sqlStmt)...); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		path, err := s.manager.GetPath(session)
+		if err != nil {
+			return mcp.NewToolResultErrorFromErr("invalid session", err), nil
+		}
+		snap, release, err := s.snapshots.acquire(id, path)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		defer release()
+		conn = snap.conn
+	} else {
+		db, err := s.manager.GetDB(session)
+		if err != nil {
+			return mcp.NewToolResultErrorFromErr("invalid session", err), nil
+		}
+		defer db.Close()
+
+		// Pin a single connection so changes() and last_insert_rowid()
+		// report on the statement we just ran.
+		conn, err = db.Conn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+	}
+
+	for _, stmt := range leading {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return mcp.NewToolResultErrorFromErr("sql error", err), nil
+		}
+	}
+
+	args := req.GetArguments()
+	params, ok := args["params"].([]any)
+	if !ok && args["params"] != nil {
+		return mcp.NewToolResultError("'params' must be an array"), nil
+	}
+	namedParams, ok := args["named_params"].(map[string]any)
+	if !ok && args["named_params"] != nil {
+		return mcp.NewToolResultError("'named_params' must be an object"), nil
+	}
+	bound, err := bindArgs(sqlStmt, params, namedParams)
 	if err != nil {
-		return nil, fmt.Errorf("invalid session: %w", err)
+		return mcp.NewToolResultError(err.Error()), nil
 	}
-	defer db.Close()
 
-	rows, err := db.Query(sqlStmt)
+	sqlStmt, pageArgs := paginate(sqlStmt, req.GetInt("limit", 0), req.GetInt("offset", 0))
+	bound = append(bound, pageArgs...)
+
+	rows, err := conn.QueryContext(ctx, sqlStmt, bound...)
 	if err != nil {
 		// If it's not a query, try Exec (e.g. INSERT, CREATE, etc)
-		if _, execErr := db.Exec(sqlStmt); execErr != nil {
-			return nil, fmt.Errorf("sql error: %w", execErr)
-		}
-		// Return an empty result to indicate success
-		resp := map[string]any{
-			"result": "ok",
-		}
-		jsonBytes, _ := json.Marshal(resp)
-		return &mcp.CallToolResult{
-			Content: []mcp.Content{
-				mcp.TextContent{
-					Type: "text",
-					Text: string(jsonBytes),
-				},
-			},
-		}, nil
+		res, execErr := conn.ExecContext(ctx, sqlStmt, bound...)
+		if execErr != nil {
+			return mcp.NewToolResultErrorFromErr("sql error", execErr), nil
+		}
+		rowsAffected, _ := res.RowsAffected()
+		lastInsertID, _ := res.LastInsertId()
+		return writeResult(rowsAffected, lastInsertID), nil
 	}
 	defer rows.Close()
 
@@ -109,34 +696,123 @@ func (s *handlers) runSQLHandler(ctx context.Context, req mcp.CallToolRequest) (
 		return nil, err
 	}
 
-	var results []map[string]any
+	var (
+		results  []map[string]any
+		streamed int
+	)
+	progressToken := s.progressToken(ctx, req)
 
 	for rows.Next() {
-		raw := make([]any, len(cols))
-		ptrs := make([]any, len(cols))
-		for i := range raw {
-			ptrs[i] = &raw[i]
-		}
-		if err := rows.Scan(ptrs...); err != nil {
+		values, err := s.scanValues(rows, len(cols))
+		if err != nil {
 			return nil, err
 		}
+		*returned++
 		row := make(map[string]any)
 		for i, colName := range cols {
-			switch v := raw[i].(type) {
-			case nil:
-				row[colName] = nil
-			case []byte:
-				row[colName] = string(v)
-			default:
-				row[colName] = v
-			}
+			row[colName] = values[i]
+		}
+
+		if progressToken == nil {
+			results = append(results, row)
+			continue
+		}
+
+		streamed++
+		rowBytes, err := json.Marshal(row)
+		if err != nil {
+			return nil, err
+		}
+		if err := sendProgress(ctx, progressToken, streamed, string(rowBytes)); err != nil {
+			return nil, fmt.Errorf("failed to stream row: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		// Errors raised while stepping through the rows, such as a
+		// constraint failing, come from the statement itself.
+		return mcp.NewToolResultErrorFromErr("sql error", err), nil
+	}
+
+	if len(cols) == 0 {
+		// The statement didn't produce a result set (e.g. INSERT, UPDATE), so
+		// report what it changed instead.
+		rows.Close()
+		var rowsAffected, lastInsertID int64
+		if err := conn.QueryRowContext(ctx, "SELECT changes(), last_insert_rowid();").Scan(&rowsAffected, &lastInsertID); err != nil {
+			return nil, err
 		}
-		results = append(results, row)
+		return writeResult(rowsAffected, lastInsertID), nil
 	}
 
 	resp := map[string]any{
 		"results": results,
 	}
+	if progressToken != nil {
+		resp = map[string]any{
+			"streamed_rows": streamed,
+		}
+	}
+	jsonBytes, _ := json.Marshal(resp)
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{
+				Type: "text",
+				Text: string(jsonBytes),
+			},
+		},
+	}, nil
+}
+
+func (s *handlers) maintainDBHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	session, err := req.RequireString("session")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if err := s.checkAllowed("VACUUM", "ANALYZE"); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	path, err := s.manager.GetPath(session)
+	if err != nil {
+		return mcp.NewToolResultErrorFromErr("invalid session", err), nil
+	}
+
+	before, err := dbSize(path)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := s.manager.GetDB(session)
+	if err != nil {
+		return mcp.NewToolResultErrorFromErr("invalid session", err), nil
+	}
+	defer db.Close()
+
+	// VACUUM can't run while another connection, such as an open snapshot,
+	// holds a transaction on the database. In rollback journal mode it fails
+	// with SQLITE_BUSY. In WAL mode it would go ahead and copy the database
+	// into the WAL, so first checkpoint it, which reports SQLITE_BUSY while a
+	// reader still needs the WAL. Checkpointing again afterwards moves the
+	// vacuumed database back into the main file.
+	for _, stmt := range []string{walCheckpoint, "VACUUM;", "ANALYZE;", walCheckpoint} {
+		if err := execMaintenance(ctx, db, stmt); err != nil {
+			var sqliteErr sqlite3.Error
+			if errors.As(err, &sqliteErr) && (sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked) {
+				return mcp.NewToolResultError(fmt.Sprintf("a transaction is open for session %s, try again once it has finished", session)), nil
+			}
+			return mcp.NewToolResultErrorFromErr("sql error", err), nil
+		}
+	}
+
+	after, err := dbSize(path)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := map[string]any{
+		"size_before": before,
+		"size_after":  after,
+	}
 	jsonBytes, _ := json.Marshal(resp)
 	return &mcp.CallToolResult{
 		Content: []mcp.Content{
@@ -147,3 +823,409 @@ func (s *handlers) runSQLHandler(ctx context.Context, req mcp.CallToolRequest) (
 		},
 	}, nil
 }
+
+const walCheckpoint = "PRAGMA wal_checkpoint(TRUNCATE);"
+
+// execMaintenance runs one of maintain_db's statements. wal_checkpoint
+// reports a blocked checkpoint in its result row rather than as an error, so
+// that is turned into SQLITE_BUSY. Outside WAL mode the checkpoint does
+// nothing.
+func execMaintenance(ctx context.Context, db *sql.DB, stmt string) error {
+	if stmt != walCheckpoint {
+		_, err := db.ExecContext(ctx, stmt)
+		return err
+	}
+	var busy, logFrames, checkpointed int
+	if err := db.QueryRowContext(ctx, stmt).Scan(&busy, &logFrames, &checkpointed); err != nil {
+		return err
+	}
+	if busy != 0 {
+		return sqlite3.Error{Code: sqlite3.ErrBusy}
+	}
+	return nil
+}
+
+// dbSize returns the size of the database at path, including its WAL file
+// when the database is in WAL mode, where recent changes live until they are
+// checkpointed into the main file.
+func dbSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	size := info.Size()
+	if wal, err := os.Stat(path + "-wal"); err == nil {
+		size += wal.Size()
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return 0, err
+	}
+	return size, nil
+}
+
+func (s *handlers) explainSQLHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	session, err := req.RequireString("session")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	sqlStmt, err := req.RequireString("sql")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	// The database would run every statement after the first, so anything
+	// but a single one is refused.
+	if stmts := splitStatements(sqlStmt); len(stmts) != 1 {
+		return mcp.NewToolResultError(fmt.Sprintf("explain_sql explains a single statement but got %d", len(stmts))), nil
+	}
+	switch statementType(sqlStmt) {
+	case "SELECT", "WITH":
+	default:
+		return mcp.NewToolResultError("explain_sql only supports SELECT statements; use run_sql to execute other statements"), nil
+	}
+	if err := s.checkAllowed(sqlStmt); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	db, err := s.manager.GetDB(session)
+	if err != nil {
+		return mcp.NewToolResultErrorFromErr("invalid session", err), nil
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, "EXPLAIN QUERY PLAN "+sqlStmt)
+	if err != nil {
+		return mcp.NewToolResultErrorFromErr("sql error", err), nil
+	}
+	defer rows.Close()
+
+	type planRow struct {
+		ID     int64  `json:"id"`
+		Parent int64  `json:"parent"`
+		Detail string `json:"detail"`
+	}
+	plan := []planRow{}
+	for rows.Next() {
+		var (
+			r       planRow
+			notUsed int64
+		)
+		if err := rows.Scan(&r.ID, &r.Parent, &notUsed, &r.Detail); err != nil {
+			return nil, err
+		}
+		plan = append(plan, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	resp := map[string]any{
+		"plan": plan,
+	}
+	jsonBytes, _ := json.Marshal(resp)
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{
+				Type: "text",
+				Text: string(jsonBytes),
+			},
+		},
+	}, nil
+}
+
+func (s *handlers) bulkInsertHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	session, err := req.RequireString("session")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	table, err := req.RequireString("table")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if err := s.checkAllowed("INSERT"); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	rows, cols, err := uniformRows(req.GetArguments()["rows"])
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	quoted := make([]string, len(cols))
+	placeholders := make([]string, len(cols))
+	for i, col := range cols {
+		quoted[i] = quoteIdent(col)
+		placeholders[i] = "?"
+	}
+	insertStmt := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s);", quoteIdent(table), strings.Join(quoted, ", "), strings.Join(placeholders, ", "))
+
+	db, err := s.manager.GetDB(session)
+	if err != nil {
+		return mcp.NewToolResultErrorFromErr("invalid session", err), nil
+	}
+	defer db.Close()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, insertStmt)
+	if err != nil {
+		return mcp.NewToolResultErrorFromErr("sql error", err), nil
+	}
+	defer stmt.Close()
+
+	values := make([]any, len(cols))
+	for i, row := range rows {
+		for j, col := range cols {
+			values[j] = row[col]
+		}
+		if _, err := stmt.ExecContext(ctx, values...); err != nil {
+			return mcp.NewToolResultErrorFromErr(fmt.Sprintf("sql error inserting row %d", i), err), nil
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return mcp.NewToolResultErrorFromErr("sql error", err), nil
+	}
+
+	resp := map[string]any{
+		"inserted": len(rows),
+	}
+	jsonBytes, _ := json.Marshal(resp)
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{
+				Type: "text",
+				Text: string(jsonBytes),
+			},
+		},
+	}, nil
+}
+
+// uniformRows checks that raw is a non-empty array of objects that all have
+// the same keys, and returns them along with those keys, sorted.
+func uniformRows(raw any) ([]map[string]any, []string, error) {
+	rawRows, ok := raw.([]any)
+	if !ok || len(rawRows) == 0 {
+		return nil, nil, errors.New("'rows' must be a non-empty array of objects")
+	}
+	rows := make([]map[string]any, len(rawRows))
+	for i, r := range rawRows {
+		row, ok := r.(map[string]any)
+		if !ok {
+			return nil, nil, fmt.Errorf("row %d is not an object", i)
+		}
+		rows[i] = row
+	}
+
+	// Every row must have the same columns as the first.
+	var cols []string
+	for col := range rows[0] {
+		cols = append(cols, col)
+	}
+	if len(cols) == 0 {
+		return nil, nil, errors.New("rows must have at least one column")
+	}
+	sort.Strings(cols)
+	for i, row := range rows {
+		if len(row) != len(cols) {
+			return nil, nil, fmt.Errorf("row %d has different columns than row 0", i)
+		}
+		for _, col := range cols {
+			if _, ok := row[col]; !ok {
+				return nil, nil, fmt.Errorf("row %d is missing column %q", i, col)
+			}
+		}
+	}
+	return rows, cols, nil
+}
+
+// quoteIdent quotes a table or column name for use in a SQL statement.
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// statementType returns the leading keyword of the SQL statement, upper-cased,
+// skipping any comments before it.
+func statementType(sqlStmt string) string {
+	for {
+		sqlStmt = strings.TrimLeft(sqlStmt, " \t\r\n(")
+		if sqlStmt == "" || (sqlStmt[0] != '-' && sqlStmt[0] != '/') {
+			break
+		}
+		end, ok := skipQuoted(sqlStmt, 0)
+		if !ok {
+			break
+		}
+		sqlStmt = sqlStmt[end+1:]
+	}
+	fields := strings.Fields(sqlStmt)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToUpper(strings.TrimRight(fields[0], "(;"))
+}
+
+// paginate wraps a SELECT in a subquery limited to the requested page. It
+// leaves the statement untouched if no page was requested, if it isn't a
+// SELECT, or if it already has its own LIMIT.
+func paginate(sqlStmt string, limit, offset int) (string, []any) {
+	if limit <= 0 && offset <= 0 {
+		return sqlStmt, nil
+	}
+	switch statementType(sqlStmt) {
+	case "SELECT", "WITH":
+	default:
+		return sqlStmt, nil
+	}
+	for _, f := range strings.FieldsFunc(strings.ToUpper(sqlStmt), func(r rune) bool {
+		return !(r == '_' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	}) {
+		if f == "LIMIT" {
+			return sqlStmt, nil
+		}
+	}
+
+	if limit <= 0 {
+		// SQLite requires a LIMIT before OFFSET; a negative one means no limit.
+		limit = -1
+	}
+	// Named so they bind the same way whether the statement itself uses
+	// positional or named parameters.
+	// Splitting drops the terminator and any comment after it. A trailing
+	// comment with no terminator stays, so the closing parenthesis goes on a
+	// line of its own.
+	inner := strings.TrimSpace(sqlStmt)
+	if stmts := splitStatements(sqlStmt); len(stmts) == 1 {
+		inner = stmts[0]
+	}
+	return "SELECT * FROM (" + inner + "\n) LIMIT :mcp_page_limit OFFSET :mcp_page_offset", []any{
+		sql.Named("mcp_page_limit", limit),
+		sql.Named("mcp_page_offset", max(offset, 0)),
+	}
+}
+
+// structuredResults copies a successful result whose only content is a JSON
+// object in text into its structured content.
+func structuredResults(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		res, err := next(ctx, req)
+		if err != nil || res == nil || res.IsError || res.StructuredContent != nil || len(res.Content) != 1 {
+			return res, err
+		}
+		text, ok := res.Content[0].(mcp.TextContent)
+		if !ok {
+			return res, nil
+		}
+		var obj map[string]any
+		if json.Unmarshal([]byte(text.Text), &obj) == nil {
+			res.StructuredContent = obj
+		}
+		return res, nil
+	}
+}
+
+// scanValues scans the current row's n columns, returning text and blobs as
+// strings capped at maxCellBytes.
+func (s *handlers) scanValues(rows *sql.Rows, n int) ([]any, error) {
+	raw := make([]any, n)
+	ptrs := make([]any, n)
+	for i := range raw {
+		ptrs[i] = &raw[i]
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		return nil, err
+	}
+	for i, v := range raw {
+		switch v := v.(type) {
+		case []byte:
+			raw[i] = s.capCell(string(v))
+		case string:
+			raw[i] = s.capCell(v)
+		}
+	}
+	return raw, nil
+}
+
+// capCell shortens v to maxCellBytes, without splitting a UTF-8 sequence,
+// and marks it as truncated.
+func (s *handlers) capCell(v string) string {
+	if s.maxCellBytes <= 0 || len(v) <= s.maxCellBytes {
+		return v
+	}
+	n := s.maxCellBytes
+	for n > 0 && !utf8.RuneStart(v[n]) {
+		n--
+	}
+	return fmt.Sprintf("%s...(truncated, %d bytes in total)", v[:n], len(v))
+}
+
+// truncate shortens s to at most n bytes for use in messages.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+// writeResult builds the response for a statement that modified the database.
+func writeResult(rowsAffected, lastInsertID int64) *mcp.CallToolResult {
+	resp := map[string]any{
+		"result":         "ok",
+		"rows_affected":  rowsAffected,
+		"last_insert_id": lastInsertID,
+	}
+	jsonBytes, _ := json.Marshal(resp)
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{
+				Type: "text",
+				Text: string(jsonBytes),
+			},
+		},
+	}
+}
+
+// sendProgress sends a progress notification to the client session in ctx.
+// Unlike SendNotificationToClient, which fails once the session's
+// notification queue is full, it waits for the client to catch up, so a
+// large result slows down rather than failing partway through.
+func sendProgress(ctx context.Context, token mcp.ProgressToken, progress int, message string) error {
+	session := server.ClientSessionFromContext(ctx)
+	if session == nil || !session.Initialized() {
+		return server.ErrNotificationNotInitialized
+	}
+	notification := mcp.JSONRPCNotification{
+		JSONRPC: mcp.JSONRPC_VERSION,
+		Notification: mcp.Notification{
+			Method: "notifications/progress",
+			Params: mcp.NotificationParams{
+				AdditionalFields: map[string]any{
+					"progressToken": token,
+					"progress":      progress,
+					"message":       message,
+				},
+			},
+		},
+	}
+	select {
+	case session.NotificationChannel() <- notification:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// progressToken returns the token to stream rows against, or nil if the
+// results should be buffered. Streaming requires it to be enabled, a client
+// session to notify and a progress token on the request.
+func (s *handlers) progressToken(ctx context.Context, req mcp.CallToolRequest) mcp.ProgressToken {
+	if !s.stream || req.Params.Meta == nil {
+		return nil
+	}
+	if server.ServerFromContext(ctx) == nil || server.ClientSessionFromContext(ctx) == nil {
+		return nil
+	}
+	return req.Params.Meta.ProgressToken
+}
@@ -3,12 +3,20 @@ package mcpserver_test
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/mark3labs/mcp-go/client"
 	"github.com/mark3labs/mcp-go/client/transport"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/poy/adk-rnd/mcp/sqlite_mcp/pkg/mcpserver"
+	"github.com/poy/adk-rnd/mcp/sqlite_mcp/pkg/sessionmanager"
 )
 
 func TestCreateAndQuerySQLite(t *testing.T) {
@@ -121,3 +129,1674 @@ func TestRunSQLWithSession(t *testing.T) {
 		t.Fatalf("unexpected query results: %+v", out.Results)
 	}
 }
+
+func TestRunSQLStreamsRows(t *testing.T) {
+	srv := mcpserver.New(t.TempDir(), mcpserver.WithStreaming(true))
+	sess := &testSession{notifications: make(chan mcp.JSONRPCNotification, 10)}
+	ctx := srv.WithContext(context.Background(), sess)
+
+	tx := transport.NewInProcessTransport(srv)
+	mcpClient := client.NewClient(tx)
+	if _, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	session := createSession(t, mcpClient)
+	// More rows than the session's notification queue holds, so streaming
+	// has to wait for the client to catch up.
+	const total = 50
+	for _, stmt := range []string{
+		"CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);",
+		fmt.Sprintf("WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x+1 FROM c WHERE x < %d) INSERT INTO users (name) SELECT 'user' || x FROM c;", total),
+	} {
+		runSQL(t, ctx, mcpClient, session, stmt, nil)
+	}
+
+	names := make(chan []string)
+	go func() {
+		var got []string
+		for len(got) < total {
+			n := <-sess.notifications
+			if n.Method != "notifications/progress" {
+				t.Errorf("unexpected notification method: %s", n.Method)
+				continue
+			}
+			var row map[string]any
+			if err := json.Unmarshal([]byte(n.Params.AdditionalFields["message"].(string)), &row); err != nil {
+				t.Errorf("failed to unmarshal streamed row: %v", err)
+				continue
+			}
+			got = append(got, row["name"].(string))
+			// A slow client.
+			time.Sleep(time.Millisecond)
+		}
+		names <- got
+	}()
+
+	res := runSQL(t, ctx, mcpClient, session, "SELECT name FROM users ORDER BY id;", &mcp.Meta{ProgressToken: "rows"})
+	if res.IsError {
+		t.Fatalf("run_sql failed while streaming: %+v", res)
+	}
+
+	var out struct {
+		StreamedRows int `json:"streamed_rows"`
+	}
+	if err := json.Unmarshal([]byte(res.Content[0].(mcp.TextContent).Text), &out); err != nil {
+		t.Fatalf("failed to unmarshal result JSON: %v", err)
+	}
+	if out.StreamedRows != total {
+		t.Fatalf("expected %d streamed rows, got %d", total, out.StreamedRows)
+	}
+
+	got := <-names
+	if len(got) != total || got[0] != "user1" || got[total-1] != fmt.Sprintf("user%d", total) {
+		t.Fatalf("unexpected streamed rows: %v", got)
+	}
+}
+
+func TestMaintainDBShrinksFile(t *testing.T) {
+	server := mcpserver.New(t.TempDir())
+	tx := transport.NewInProcessTransport(server)
+	mcpClient := client.NewClient(tx)
+	ctx := context.Background()
+	if _, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	session := createSession(t, mcpClient)
+	for _, stmt := range []string{
+		"CREATE TABLE blobs (id INTEGER PRIMARY KEY, data TEXT);",
+		"WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x+1 FROM c WHERE x < 2000) INSERT INTO blobs (data) SELECT hex(randomblob(256)) FROM c;",
+		"DELETE FROM blobs WHERE id > 10;",
+	} {
+		runSQL(t, ctx, mcpClient, session, stmt, nil)
+	}
+
+	maintainReq := mcp.CallToolRequest{
+		Request: mcp.Request{Method: "tools/call"},
+		Params: mcp.CallToolParams{
+			Name:      "maintain_db",
+			Arguments: map[string]string{"session": session},
+		},
+	}
+	res, err := mcpClient.CallTool(ctx, maintainReq)
+	if err != nil {
+		t.Fatalf("maintain_db failed: %v", err)
+	}
+
+	var out struct {
+		SizeBefore int64 `json:"size_before"`
+		SizeAfter  int64 `json:"size_after"`
+	}
+	if err := json.Unmarshal([]byte(res.Content[0].(mcp.TextContent).Text), &out); err != nil {
+		t.Fatalf("failed to unmarshal result JSON: %v", err)
+	}
+	if out.SizeAfter >= out.SizeBefore {
+		t.Fatalf("expected file to shrink, got before=%d after=%d", out.SizeBefore, out.SizeAfter)
+	}
+}
+
+func TestMaintainDBRefusesWhileSnapshotIsOpen(t *testing.T) {
+	server := mcpserver.New(t.TempDir())
+	tx := transport.NewInProcessTransport(server)
+	mcpClient := client.NewClient(tx)
+	ctx := context.Background()
+	if _, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	session := createSession(t, mcpClient)
+	runSQL(t, ctx, mcpClient, session, "CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);", nil)
+
+	call := func(name string, args map[string]any) *mcp.CallToolResult {
+		t.Helper()
+		res, err := mcpClient.CallTool(ctx, mcp.CallToolRequest{
+			Request: mcp.Request{Method: "tools/call"},
+			Params:  mcp.CallToolParams{Name: name, Arguments: args},
+		})
+		if err != nil {
+			t.Fatalf("%s failed: %v", name, err)
+		}
+		return res
+	}
+	var begun struct {
+		Snapshot string `json:"snapshot"`
+	}
+	res := call("begin_snapshot", map[string]any{"session": session})
+	if err := json.Unmarshal([]byte(res.Content[0].(mcp.TextContent).Text), &begun); err != nil || begun.Snapshot == "" {
+		t.Fatalf("expected a snapshot ID, got %+v", res)
+	}
+	// The snapshot's read transaction starts at its first read.
+	call("run_sql", map[string]any{"session": session, "sql": "SELECT COUNT(*) FROM users;", "snapshot": begun.Snapshot})
+
+	res = call("maintain_db", map[string]any{"session": session})
+	if !res.IsError || !strings.Contains(res.Content[0].(mcp.TextContent).Text, "a transaction is open") {
+		t.Fatalf("expected maintain_db to refuse while the snapshot is open, got %+v", res)
+	}
+
+	call("end_snapshot", map[string]any{"snapshot": begun.Snapshot})
+	if res := call("maintain_db", map[string]any{"session": session}); res.IsError {
+		t.Fatalf("expected maintain_db to succeed once the snapshot ended, got %+v", res)
+	}
+}
+
+func TestRunSQLReportsRowsAffected(t *testing.T) {
+	server := mcpserver.New(t.TempDir())
+	tx := transport.NewInProcessTransport(server)
+	mcpClient := client.NewClient(tx)
+	ctx := context.Background()
+	if _, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	session := createSession(t, mcpClient)
+	for _, stmt := range []string{
+		"CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, active INTEGER);",
+		"INSERT INTO users (name, active) VALUES ('Alice', 0), ('Bob', 0), ('Carol', 1);",
+	} {
+		runSQL(t, ctx, mcpClient, session, stmt, nil)
+	}
+
+	res := runSQL(t, ctx, mcpClient, session, "UPDATE users SET active = 1 WHERE active = 0;", nil)
+
+	var out struct {
+		RowsAffected int64 `json:"rows_affected"`
+	}
+	if err := json.Unmarshal([]byte(res.Content[0].(mcp.TextContent).Text), &out); err != nil {
+		t.Fatalf("failed to unmarshal result JSON: %v", err)
+	}
+	if out.RowsAffected != 2 {
+		t.Fatalf("expected 2 rows affected, got %d", out.RowsAffected)
+	}
+}
+
+func TestRunSQLRejectsMalformedArguments(t *testing.T) {
+	server := mcpserver.New(t.TempDir())
+	tx := transport.NewInProcessTransport(server)
+	mcpClient := client.NewClient(tx)
+	ctx := context.Background()
+	if _, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, args := range []any{
+		[]string{"not", "a", "map"},
+		map[string]any{"session": 42, "sql": "SELECT 1;"},
+	} {
+		req := mcp.CallToolRequest{
+			Request: mcp.Request{Method: "tools/call"},
+			Params: mcp.CallToolParams{
+				Name:      "run_sql",
+				Arguments: args,
+			},
+		}
+		res, err := mcpClient.CallTool(ctx, req)
+		if err != nil {
+			t.Fatalf("run_sql failed: %v", err)
+		}
+		if !res.IsError {
+			t.Fatalf("expected a tool error for arguments %v", args)
+		}
+	}
+}
+
+func TestExplainSQL(t *testing.T) {
+	server := mcpserver.New(t.TempDir())
+	tx := transport.NewInProcessTransport(server)
+	mcpClient := client.NewClient(tx)
+	ctx := context.Background()
+	if _, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	session := createSession(t, mcpClient)
+	runSQL(t, ctx, mcpClient, session, "CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);", nil)
+
+	explain := func(stmt string) *mcp.CallToolResult {
+		t.Helper()
+		req := mcp.CallToolRequest{
+			Request: mcp.Request{Method: "tools/call"},
+			Params: mcp.CallToolParams{
+				Name: "explain_sql",
+				Arguments: map[string]string{
+					"session": session,
+					"sql":     stmt,
+				},
+			},
+		}
+		res, err := mcpClient.CallTool(ctx, req)
+		if err != nil {
+			t.Fatalf("explain_sql failed: %v", err)
+		}
+		return res
+	}
+	planDetail := func(res *mcp.CallToolResult) string {
+		t.Helper()
+		var out struct {
+			Plan []struct {
+				Detail string `json:"detail"`
+			} `json:"plan"`
+		}
+		if err := json.Unmarshal([]byte(res.Content[0].(mcp.TextContent).Text), &out); err != nil {
+			t.Fatalf("failed to unmarshal result JSON: %v", err)
+		}
+		if len(out.Plan) == 0 {
+			t.Fatal("expected a query plan")
+		}
+		return out.Plan[0].Detail
+	}
+
+	const query = "SELECT id FROM users WHERE name = 'Alice';"
+	if detail := planDetail(explain(query)); !strings.Contains(detail, "SCAN") {
+		t.Fatalf("expected a table scan without an index, got %q", detail)
+	}
+
+	runSQL(t, ctx, mcpClient, session, "CREATE INDEX users_name ON users (name);", nil)
+	if detail := planDetail(explain(query)); !strings.Contains(detail, "users_name") {
+		t.Fatalf("expected the index to be used, got %q", detail)
+	}
+
+	if res := explain("DELETE FROM users;"); !res.IsError {
+		t.Fatal("expected non-SELECT statements to be rejected")
+	}
+
+	for _, stmt := range []string{
+		"SELECT 1; INSERT INTO users (name) VALUES ('Mallory');",
+		"SELECT 1; DROP TABLE users",
+	} {
+		if res := explain(stmt); !res.IsError || !strings.Contains(res.Content[0].(mcp.TextContent).Text, "single statement") {
+			t.Fatalf("expected %q to be refused, got %+v", stmt, res)
+		}
+	}
+	res := runSQL(t, ctx, mcpClient, session, "SELECT COUNT(*) AS n FROM users;", nil)
+	if res.IsError || !strings.Contains(res.Content[0].(mcp.TextContent).Text, `"n":0`) {
+		t.Fatalf("expected the users table to survive untouched, got %+v", res)
+	}
+}
+
+func TestInMemorySession(t *testing.T) {
+	dataDir := t.TempDir()
+	server := mcpserver.New(dataDir)
+	tx := transport.NewInProcessTransport(server)
+	mcpClient := client.NewClient(tx)
+	ctx := context.Background()
+	if _, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	createReq := mcp.CallToolRequest{
+		Request: mcp.Request{Method: "tools/call"},
+		Params: mcp.CallToolParams{
+			Name:      "create_db",
+			Arguments: map[string]any{"in_memory": true},
+		},
+	}
+	createRes, err := mcpClient.CallTool(ctx, createReq)
+	if err != nil {
+		t.Fatalf("create_db failed: %v", err)
+	}
+	var created struct {
+		Session string `json:"session"`
+	}
+	if err := json.Unmarshal([]byte(createRes.Content[0].(mcp.TextContent).Text), &created); err != nil {
+		t.Fatalf("failed to unmarshal session ID: %v", err)
+	}
+
+	for _, stmt := range []string{
+		"CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);",
+		"INSERT INTO users (name) VALUES ('Alice');",
+	} {
+		runSQL(t, ctx, mcpClient, created.Session, stmt, nil)
+	}
+	res := runSQL(t, ctx, mcpClient, created.Session, "SELECT name FROM users;", nil)
+
+	var out struct {
+		Results []map[string]any `json:"results"`
+	}
+	if err := json.Unmarshal([]byte(res.Content[0].(mcp.TextContent).Text), &out); err != nil {
+		t.Fatalf("failed to unmarshal result JSON: %v", err)
+	}
+	if len(out.Results) != 1 || out.Results[0]["name"] != "Alice" {
+		t.Fatalf("unexpected query results: %+v", out.Results)
+	}
+
+	entries, err := os.ReadDir(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected nothing written to the data dir, found %d entries", len(entries))
+	}
+}
+
+func TestBulkInsert(t *testing.T) {
+	server := mcpserver.New(t.TempDir())
+	tx := transport.NewInProcessTransport(server)
+	mcpClient := client.NewClient(tx)
+	ctx := context.Background()
+	if _, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	session := createSession(t, mcpClient)
+	runSQL(t, ctx, mcpClient, session, "CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);", nil)
+
+	var rows []map[string]any
+	for i := 1; i <= 1000; i++ {
+		rows = append(rows, map[string]any{"id": i, "name": fmt.Sprintf("user-%d", i)})
+	}
+	req := mcp.CallToolRequest{
+		Request: mcp.Request{Method: "tools/call"},
+		Params: mcp.CallToolParams{
+			Name: "bulk_insert",
+			Arguments: map[string]any{
+				"session": session,
+				"table":   "users",
+				"rows":    rows,
+			},
+		},
+	}
+	res, err := mcpClient.CallTool(ctx, req)
+	if err != nil {
+		t.Fatalf("bulk_insert failed: %v", err)
+	}
+	var inserted struct {
+		Inserted int `json:"inserted"`
+	}
+	if err := json.Unmarshal([]byte(res.Content[0].(mcp.TextContent).Text), &inserted); err != nil {
+		t.Fatalf("failed to unmarshal result JSON: %v", err)
+	}
+	if inserted.Inserted != 1000 {
+		t.Fatalf("expected 1000 rows inserted, got %d", inserted.Inserted)
+	}
+
+	res = runSQL(t, ctx, mcpClient, session, "SELECT COUNT(*) AS n, (SELECT name FROM users WHERE id = 500) AS sample FROM users;", nil)
+	var out struct {
+		Results []map[string]any `json:"results"`
+	}
+	if err := json.Unmarshal([]byte(res.Content[0].(mcp.TextContent).Text), &out); err != nil {
+		t.Fatalf("failed to unmarshal result JSON: %v", err)
+	}
+	if out.Results[0]["n"] != float64(1000) || out.Results[0]["sample"] != "user-500" {
+		t.Fatalf("unexpected query results: %+v", out.Results)
+	}
+}
+
+func TestRunSQLPaginatesSelect(t *testing.T) {
+	server := mcpserver.New(t.TempDir())
+	tx := transport.NewInProcessTransport(server)
+	mcpClient := client.NewClient(tx)
+	ctx := context.Background()
+	if _, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	session := createSession(t, mcpClient)
+	runSQL(t, ctx, mcpClient, session, "CREATE TABLE items (id INTEGER PRIMARY KEY);", nil)
+	for i := 1; i <= 7; i++ {
+		runSQL(t, ctx, mcpClient, session, fmt.Sprintf("INSERT INTO items (id) VALUES (%d);", i), nil)
+	}
+
+	page := func(stmt string, limit, offset int) []float64 {
+		t.Helper()
+		req := mcp.CallToolRequest{
+			Request: mcp.Request{Method: "tools/call"},
+			Params: mcp.CallToolParams{
+				Name: "run_sql",
+				Arguments: map[string]any{
+					"session": session,
+					"sql":     stmt,
+					"limit":   limit,
+					"offset":  offset,
+				},
+			},
+		}
+		res, err := mcpClient.CallTool(ctx, req)
+		if err != nil {
+			t.Fatalf("run_sql failed: %v", err)
+		}
+		var out struct {
+			Results []map[string]any `json:"results"`
+		}
+		if err := json.Unmarshal([]byte(res.Content[0].(mcp.TextContent).Text), &out); err != nil {
+			t.Fatalf("failed to unmarshal result JSON: %v", err)
+		}
+		var ids []float64
+		for _, row := range out.Results {
+			ids = append(ids, row["id"].(float64))
+		}
+		return ids
+	}
+
+	var all []float64
+	for offset := 0; ; offset += 3 {
+		ids := page("SELECT id FROM items ORDER BY id;", 3, offset)
+		if len(ids) == 0 {
+			break
+		}
+		if len(ids) > 3 {
+			t.Fatalf("expected at most 3 rows per page, got %v", ids)
+		}
+		all = append(all, ids...)
+	}
+	if fmt.Sprint(all) != "[1 2 3 4 5 6 7]" {
+		t.Fatalf("unexpected rows across pages: %v", all)
+	}
+
+	// Statements with their own LIMIT are left alone.
+	if ids := page("SELECT id FROM items ORDER BY id LIMIT 5", 2, 1); len(ids) != 5 || ids[0] != 1 {
+		t.Fatalf("expected statement LIMIT to win, got %v", ids)
+	}
+
+	// A trailing comment mustn't swallow the subquery's closing parenthesis.
+	for _, stmt := range []string{
+		"SELECT id FROM items ORDER BY id -- oldest first",
+		"SELECT id FROM items ORDER BY id; -- oldest first",
+		"SELECT id FROM items ORDER BY id /* oldest first */",
+	} {
+		if ids := page(stmt, 2, 1); fmt.Sprint(ids) != "[2 3]" {
+			t.Fatalf("expected %q to be paged, got %v", stmt, ids)
+		}
+	}
+}
+
+func TestStorageQuotaBlocksCreateDB(t *testing.T) {
+	server := mcpserver.New(t.TempDir(), mcpserver.WithMaxTotalMB(1))
+	tx := transport.NewInProcessTransport(server)
+	mcpClient := client.NewClient(tx)
+	ctx := context.Background()
+	if _, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	session := createSession(t, mcpClient)
+	runSQL(t, ctx, mcpClient, session, "CREATE TABLE blobs AS SELECT randomblob(2000000) AS b;", nil)
+
+	res, err := mcpClient.CallTool(ctx, mcp.CallToolRequest{
+		Request: mcp.Request{Method: "tools/call"},
+		Params:  mcp.CallToolParams{Name: "create_db"},
+	})
+	if err != nil {
+		t.Fatalf("create_db failed: %v", err)
+	}
+	if !res.IsError || !strings.Contains(res.Content[0].(mcp.TextContent).Text, "quota") {
+		t.Fatalf("expected a quota error, got %+v", res)
+	}
+
+	res, err = mcpClient.CallTool(ctx, mcp.CallToolRequest{
+		Request: mcp.Request{Method: "tools/call"},
+		Params:  mcp.CallToolParams{Name: "storage_stats"},
+	})
+	if err != nil {
+		t.Fatalf("storage_stats failed: %v", err)
+	}
+	var stats struct {
+		Sessions      int   `json:"sessions"`
+		TotalBytes    int64 `json:"total_bytes"`
+		MaxTotalBytes int64 `json:"max_total_bytes"`
+	}
+	if err := json.Unmarshal([]byte(res.Content[0].(mcp.TextContent).Text), &stats); err != nil {
+		t.Fatalf("failed to unmarshal stats: %v", err)
+	}
+	if stats.Sessions != 1 || stats.TotalBytes < 2000000 || stats.MaxTotalBytes != 1<<20 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestWatchTableAndPollChanges(t *testing.T) {
+	server := mcpserver.New(t.TempDir())
+	tx := transport.NewInProcessTransport(server)
+	mcpClient := client.NewClient(tx)
+	ctx := context.Background()
+	if _, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	session := createSession(t, mcpClient)
+	runSQL(t, ctx, mcpClient, session, "CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);", nil)
+	// Rows written before the watch starts shouldn't show up.
+	runSQL(t, ctx, mcpClient, session, "INSERT INTO users (name) VALUES ('alice');", nil)
+
+	res, err := mcpClient.CallTool(ctx, mcp.CallToolRequest{
+		Request: mcp.Request{Method: "tools/call"},
+		Params: mcp.CallToolParams{
+			Name:      "watch_table",
+			Arguments: map[string]any{"session": session, "table": "users"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("watch_table failed: %v", err)
+	}
+	if res.IsError {
+		t.Fatalf("watch_table returned an error: %+v", res)
+	}
+	var watched struct {
+		Cursor int64 `json:"cursor"`
+	}
+	if err := json.Unmarshal([]byte(res.Content[0].(mcp.TextContent).Text), &watched); err != nil {
+		t.Fatalf("failed to unmarshal watch_table result: %v", err)
+	}
+
+	runSQL(t, ctx, mcpClient, session, "INSERT INTO users (name) VALUES ('bob');", nil)
+	runSQL(t, ctx, mcpClient, session, "DELETE FROM users WHERE name = 'alice';", nil)
+
+	type change struct {
+		Table string         `json:"table"`
+		Op    string         `json:"op"`
+		Row   map[string]any `json:"row"`
+	}
+	poll := func(cursor int64) ([]change, int64) {
+		t.Helper()
+		res, err := mcpClient.CallTool(ctx, mcp.CallToolRequest{
+			Request: mcp.Request{Method: "tools/call"},
+			Params: mcp.CallToolParams{
+				Name:      "poll_changes",
+				Arguments: map[string]any{"session": session, "cursor": cursor},
+			},
+		})
+		if err != nil {
+			t.Fatalf("poll_changes failed: %v", err)
+		}
+		var out struct {
+			Changes []change `json:"changes"`
+			Cursor  int64    `json:"cursor"`
+		}
+		if err := json.Unmarshal([]byte(res.Content[0].(mcp.TextContent).Text), &out); err != nil {
+			t.Fatalf("failed to unmarshal poll_changes result: %v", err)
+		}
+		return out.Changes, out.Cursor
+	}
+
+	changes, cursor := poll(watched.Cursor)
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 changes, got %+v", changes)
+	}
+	if changes[0].Table != "users" || changes[0].Op != "insert" || changes[0].Row["name"] != "bob" {
+		t.Fatalf("unexpected insert change: %+v", changes[0])
+	}
+	if changes[1].Op != "delete" || changes[1].Row["name"] != "alice" {
+		t.Fatalf("unexpected delete change: %+v", changes[1])
+	}
+
+	if changes, _ := poll(cursor); len(changes) != 0 {
+		t.Fatalf("expected no changes past the cursor, got %+v", changes)
+	}
+}
+
+func TestRunSQLNamedParams(t *testing.T) {
+	server := mcpserver.New(t.TempDir())
+	tx := transport.NewInProcessTransport(server)
+	mcpClient := client.NewClient(tx)
+	ctx := context.Background()
+	if _, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	session := createSession(t, mcpClient)
+	for _, stmt := range []string{
+		"CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, active INTEGER);",
+		"INSERT INTO users (name, active) VALUES ('alice', 0), ('bob', 0), ('carol', 0);",
+	} {
+		runSQL(t, ctx, mcpClient, session, stmt, nil)
+	}
+
+	call := func(args map[string]any) *mcp.CallToolResult {
+		t.Helper()
+		args["session"] = session
+		res, err := mcpClient.CallTool(ctx, mcp.CallToolRequest{
+			Request: mcp.Request{Method: "tools/call"},
+			Params:  mcp.CallToolParams{Name: "run_sql", Arguments: args},
+		})
+		if err != nil {
+			t.Fatalf("run_sql failed: %v", err)
+		}
+		return res
+	}
+
+	// Each prefix style binds, and the names don't need to be in order.
+	res := call(map[string]any{
+		"sql":          "UPDATE users SET active = @active WHERE name IN (:first, $second);",
+		"named_params": map[string]any{"second": "carol", "first": "alice", "active": 1},
+	})
+	if res.IsError {
+		t.Fatalf("unexpected error: %+v", res)
+	}
+	var written struct {
+		RowsAffected int64 `json:"rows_affected"`
+	}
+	if err := json.Unmarshal([]byte(res.Content[0].(mcp.TextContent).Text), &written); err != nil {
+		t.Fatal(err)
+	}
+	if written.RowsAffected != 2 {
+		t.Fatalf("expected 2 rows updated, got %d", written.RowsAffected)
+	}
+
+	// A placeholder without a value is rejected rather than bound as NULL.
+	res = call(map[string]any{
+		"sql":          "UPDATE users SET active = :active WHERE name = :name;",
+		"named_params": map[string]any{"active": 0},
+	})
+	if !res.IsError || !strings.Contains(res.Content[0].(mcp.TextContent).Text, "name") {
+		t.Fatalf("expected a missing placeholder error, got %+v", res)
+	}
+
+	// Named params still work alongside pagination.
+	res = call(map[string]any{
+		"sql":          "SELECT name FROM users WHERE active = :active ORDER BY id;",
+		"named_params": map[string]any{"active": 1},
+		"limit":        1,
+		"offset":       1,
+	})
+	if res.IsError {
+		t.Fatalf("unexpected error: %+v", res)
+	}
+	if got := res.Content[0].(mcp.TextContent).Text; !strings.Contains(got, "carol") || strings.Contains(got, "alice") {
+		t.Fatalf("expected only carol, got %s", got)
+	}
+}
+
+func TestRunSQLRejectsMultipleStatements(t *testing.T) {
+	server := mcpserver.New(t.TempDir())
+	tx := transport.NewInProcessTransport(server)
+	mcpClient := client.NewClient(tx)
+	ctx := context.Background()
+	if _, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	session := createSession(t, mcpClient)
+	runSQL(t, ctx, mcpClient, session, "CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);", nil)
+
+	res := runSQL(t, ctx, mcpClient, session, "INSERT INTO users (name) VALUES ('a;b'); DELETE FROM users; -- trailing comment", nil)
+	if !res.IsError {
+		t.Fatalf("expected an error for two statements, got %+v", res)
+	}
+	if got := res.Content[0].(mcp.TextContent).Text; !strings.Contains(got, "got 2") || !strings.Contains(got, "DELETE FROM users") {
+		t.Fatalf("expected the error to name the extra statement, got %q", got)
+	}
+	if got := runSQL(t, ctx, mcpClient, session, "SELECT COUNT(*) AS n FROM users;", nil).Content[0].(mcp.TextContent).Text; !strings.Contains(got, `"n":0`) {
+		t.Fatalf("expected nothing to have run, got %s", got)
+	}
+
+	// A trigger body's semicolons belong to the one statement.
+	res = runSQL(t, ctx, mcpClient, session, `CREATE TRIGGER users_upper AFTER INSERT ON users BEGIN
+		UPDATE users SET name = CASE WHEN NEW.name IS NULL THEN '' ELSE upper(NEW.name) END WHERE id = NEW.id;
+	END;`, nil)
+	if res.IsError {
+		t.Fatalf("expected CREATE TRIGGER to be a single statement, got %+v", res)
+	}
+
+	res, err := mcpClient.CallTool(ctx, mcp.CallToolRequest{
+		Request: mcp.Request{Method: "tools/call"},
+		Params: mcp.CallToolParams{
+			Name: "run_sql",
+			Arguments: map[string]any{
+				"session":     session,
+				"sql":         "INSERT INTO users (name) VALUES ('ann'); SELECT name FROM users;",
+				"allow_multi": true,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("run_sql failed: %v", err)
+	}
+	if got := res.Content[0].(mcp.TextContent).Text; res.IsError || !strings.Contains(got, "ANN") {
+		t.Fatalf("expected allow_multi to run both statements, got %s", got)
+	}
+}
+
+func TestSessionDiscoveryIsOptIn(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		server := mcpserver.New(t.TempDir(), mcpserver.WithSessionDiscovery(enabled))
+		tx := transport.NewInProcessTransport(server)
+		mcpClient := client.NewClient(tx)
+		ctx := context.Background()
+		if _, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+			t.Fatal(err)
+		}
+		tools, err := mcpClient.ListTools(ctx, mcp.ListToolsRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := 0
+		for _, tool := range tools.Tools {
+			if tool.Name == "label_session" || tool.Name == "list_sessions" {
+				found++
+			}
+		}
+		if want := map[bool]int{false: 0, true: 2}[enabled]; found != want {
+			t.Fatalf("with discovery %v, expected %d discovery tools, got %d", enabled, want, found)
+		}
+	}
+}
+
+func TestLabelSession(t *testing.T) {
+	server := mcpserver.New(t.TempDir(), mcpserver.WithSessionDiscovery(true))
+	tx := transport.NewInProcessTransport(server)
+	mcpClient := client.NewClient(tx)
+	ctx := context.Background()
+	if _, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	session := createSession(t, mcpClient)
+	other := createSession(t, mcpClient)
+
+	label := func(session, label string) *mcp.CallToolResult {
+		t.Helper()
+		res, err := mcpClient.CallTool(ctx, mcp.CallToolRequest{
+			Request: mcp.Request{Method: "tools/call"},
+			Params: mcp.CallToolParams{
+				Name:      "label_session",
+				Arguments: map[string]any{"session": session, "label": label},
+			},
+		})
+		if err != nil {
+			t.Fatalf("label_session failed: %v", err)
+		}
+		return res
+	}
+	if res := label(session, "inventory"); res.IsError {
+		t.Fatalf("unexpected error: %+v", res)
+	}
+	if res := label(other, "inventory"); !res.IsError {
+		t.Fatalf("expected a duplicate label to be rejected, got %+v", res)
+	}
+
+	// The label works anywhere a session ID does.
+	runSQL(t, ctx, mcpClient, "inventory", "CREATE TABLE items (name TEXT);", nil)
+	runSQL(t, ctx, mcpClient, session, "INSERT INTO items VALUES ('widget');", nil)
+	if got := runSQL(t, ctx, mcpClient, "inventory", "SELECT name FROM items;", nil).Content[0].(mcp.TextContent).Text; !strings.Contains(got, "widget") {
+		t.Fatalf("expected to query the labelled session, got %s", got)
+	}
+
+	res, err := mcpClient.CallTool(ctx, mcp.CallToolRequest{
+		Request: mcp.Request{Method: "tools/call"},
+		Params:  mcp.CallToolParams{Name: "list_sessions"},
+	})
+	if err != nil {
+		t.Fatalf("list_sessions failed: %v", err)
+	}
+	var listed struct {
+		Sessions []struct {
+			ID    string `json:"id"`
+			Label string `json:"label"`
+		} `json:"sessions"`
+	}
+	if err := json.Unmarshal([]byte(res.Content[0].(mcp.TextContent).Text), &listed); err != nil {
+		t.Fatal(err)
+	}
+	labels := map[string]string{}
+	for _, s := range listed.Sessions {
+		labels[s.ID] = s.Label
+	}
+	if len(labels) != 2 || labels[session] != "inventory" || labels[other] != "" {
+		t.Fatalf("unexpected sessions: %+v", listed.Sessions)
+	}
+}
+
+func TestRunSQLReportsSQLErrorsAsToolResults(t *testing.T) {
+	server := mcpserver.New(t.TempDir())
+	tx := transport.NewInProcessTransport(server)
+	mcpClient := client.NewClient(tx)
+	ctx := context.Background()
+	if _, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// runSQL fails the test if the call itself errors.
+	session := createSession(t, mcpClient)
+	res := runSQL(t, ctx, mcpClient, session, "SELEC * FROM users;", nil)
+	if got := res.Content[0].(mcp.TextContent).Text; !res.IsError || !strings.Contains(got, "syntax error") {
+		t.Fatalf("expected a syntax error result, got %+v", res)
+	}
+
+	res = runSQL(t, ctx, mcpClient, "no-such-session", "SELECT 1;", nil)
+	if got := res.Content[0].(mcp.TextContent).Text; !res.IsError || !strings.Contains(got, "invalid session") {
+		t.Fatalf("expected an invalid session result, got %+v", res)
+	}
+}
+
+func TestImportSQLRunsScriptInTransaction(t *testing.T) {
+	server := mcpserver.New(t.TempDir())
+	tx := transport.NewInProcessTransport(server)
+	mcpClient := client.NewClient(tx)
+	ctx := context.Background()
+	if _, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	session := createSession(t, mcpClient)
+	importSQL := func(script string) *mcp.CallToolResult {
+		t.Helper()
+		res, err := mcpClient.CallTool(ctx, mcp.CallToolRequest{
+			Request: mcp.Request{Method: "tools/call"},
+			Params: mcp.CallToolParams{
+				Name:      "import_sql",
+				Arguments: map[string]any{"session": session, "script": script},
+			},
+		})
+		if err != nil {
+			t.Fatalf("import_sql failed: %v", err)
+		}
+		return res
+	}
+
+	res := importSQL(`-- Schema; with a semicolon in a comment.
+BEGIN TRANSACTION;
+CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);
+CREATE TABLE audit (msg TEXT);
+CREATE TRIGGER users_audit AFTER INSERT ON users BEGIN
+	INSERT INTO audit (msg) VALUES ('added ' || NEW.name);
+END;
+/* Data */
+INSERT INTO users (name) VALUES ('alice');
+INSERT INTO users (name) VALUES ('b;ob');
+COMMIT;
+`)
+	if got := res.Content[0].(mcp.TextContent).Text; res.IsError || got != `{"statements":5}` {
+		t.Fatalf("expected 5 statements to run, got %+v", res)
+	}
+	if got := runSQL(t, ctx, mcpClient, session, "SELECT COUNT(*) AS n FROM audit;", nil).Content[0].(mcp.TextContent).Text; !strings.Contains(got, `"n":2`) {
+		t.Fatalf("expected the trigger to have recorded both rows, got %s", got)
+	}
+
+	// A failing statement leaves nothing behind.
+	res = importSQL("INSERT INTO users (name) VALUES ('carol'); INSERT INTO nowhere VALUES (1);")
+	if got := res.Content[0].(mcp.TextContent).Text; !res.IsError || !strings.Contains(got, "statement 2") {
+		t.Fatalf("expected the second statement to fail, got %+v", res)
+	}
+	if got := runSQL(t, ctx, mcpClient, session, "SELECT COUNT(*) AS n FROM users;", nil).Content[0].(mcp.TextContent).Text; !strings.Contains(got, `"n":2`) {
+		t.Fatalf("expected the failed import to be rolled back, got %s", got)
+	}
+}
+
+func TestSessionMetricsCountQueries(t *testing.T) {
+	server := mcpserver.New(t.TempDir())
+	tx := transport.NewInProcessTransport(server)
+	mcpClient := client.NewClient(tx)
+	ctx := context.Background()
+	if _, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	session := createSession(t, mcpClient)
+	runSQL(t, ctx, mcpClient, session, "CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);", nil)
+	runSQL(t, ctx, mcpClient, session, "INSERT INTO users (name) VALUES ('alice'), ('bob');", nil)
+	runSQL(t, ctx, mcpClient, session, "SELECT * FROM users;", nil)
+	runSQL(t, ctx, mcpClient, session, "SELECT * FROM nowhere;", nil)
+
+	res, err := mcpClient.CallTool(ctx, mcp.CallToolRequest{
+		Request: mcp.Request{Method: "tools/call"},
+		Params: mcp.CallToolParams{
+			Name:      "session_metrics",
+			Arguments: map[string]any{"session": session},
+		},
+	})
+	if err != nil {
+		t.Fatalf("session_metrics failed: %v", err)
+	}
+	var metrics struct {
+		Queries     int64   `json:"queries"`
+		Rows        int64   `json:"rows"`
+		Errors      int64   `json:"errors"`
+		QueryTimeMS float64 `json:"query_time_ms"`
+	}
+	if err := json.Unmarshal([]byte(res.Content[0].(mcp.TextContent).Text), &metrics); err != nil {
+		t.Fatal(err)
+	}
+	if metrics.Queries != 4 || metrics.Rows != 2 || metrics.Errors != 1 || metrics.QueryTimeMS <= 0 {
+		t.Fatalf("unexpected metrics: %+v", metrics)
+	}
+}
+
+func TestQueryTableFormatsMarkdown(t *testing.T) {
+	server := mcpserver.New(t.TempDir())
+	tx := transport.NewInProcessTransport(server)
+	mcpClient := client.NewClient(tx)
+	ctx := context.Background()
+	if _, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	session := createSession(t, mcpClient)
+	runSQL(t, ctx, mcpClient, session, "CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);", nil)
+	runSQL(t, ctx, mcpClient, session, "INSERT INTO users (name) VALUES ('alice'), ('a|b'), (NULL);", nil)
+
+	res, err := mcpClient.CallTool(ctx, mcp.CallToolRequest{
+		Request: mcp.Request{Method: "tools/call"},
+		Params: mcp.CallToolParams{
+			Name:      "query_table",
+			Arguments: map[string]any{"session": session, "sql": "SELECT id, name FROM users ORDER BY id;", "max_rows": 2},
+		},
+	})
+	if err != nil {
+		t.Fatalf("query_table failed: %v", err)
+	}
+	want := `| id  | name  |
+| --- | ----- |
+| 1   | alice |
+| 2   | a\|b  |
+(only the first 2 rows are shown)`
+	if got := res.Content[0].(mcp.TextContent).Text; res.IsError || got != want {
+		t.Fatalf("unexpected table:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWithEncryptionKeyReportsUnsupportedEncryption(t *testing.T) {
+	if sessionmanager.EncryptionSupported() {
+		t.Skip("the linked SQLite library supports encryption")
+	}
+	if _, err := mcpserver.WithEncryptionKey("secret"); !errors.Is(err, sessionmanager.ErrEncryptionUnsupported) {
+		t.Fatalf("expected WithEncryptionKey to report that encryption is unsupported, got %v", err)
+	}
+}
+
+func TestAllowedStatementsBlockOtherTypes(t *testing.T) {
+	server := mcpserver.New(t.TempDir(), mcpserver.WithAllowedStatements([]string{"create", "INSERT", " SELECT"}))
+	tx := transport.NewInProcessTransport(server)
+	mcpClient := client.NewClient(tx)
+	ctx := context.Background()
+	if _, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	session := createSession(t, mcpClient)
+	runSQL(t, ctx, mcpClient, session, "CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);", nil)
+	if res := runSQL(t, ctx, mcpClient, session, "INSERT INTO users (name) VALUES ('alice');", nil); res.IsError {
+		t.Fatalf("expected INSERT to be allowed, got %+v", res)
+	}
+
+	res := runSQL(t, ctx, mcpClient, session, "/* cleanup */ DROP TABLE users;", nil)
+	if got := res.Content[0].(mcp.TextContent).Text; !res.IsError || got != "statement type DROP not allowed" {
+		t.Fatalf("expected DROP to be refused, got %+v", res)
+	}
+	if got := runSQL(t, ctx, mcpClient, session, "SELECT COUNT(*) AS n FROM users;", nil).Content[0].(mcp.TextContent).Text; !strings.Contains(got, `"n":1`) {
+		t.Fatalf("expected the table to survive, got %s", got)
+	}
+}
+
+func TestAllowedStatementsApplyToExplainSQL(t *testing.T) {
+	server := mcpserver.New(t.TempDir(), mcpserver.WithAllowedStatements([]string{"CREATE", "INSERT"}))
+	tx := transport.NewInProcessTransport(server)
+	mcpClient := client.NewClient(tx)
+	ctx := context.Background()
+	if _, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	session := createSession(t, mcpClient)
+	runSQL(t, ctx, mcpClient, session, "CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);", nil)
+	res, err := mcpClient.CallTool(ctx, mcp.CallToolRequest{
+		Request: mcp.Request{Method: "tools/call"},
+		Params: mcp.CallToolParams{Name: "explain_sql", Arguments: map[string]any{
+			"session": session,
+			"sql":     "SELECT * FROM users;",
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := res.Content[0].(mcp.TextContent).Text; !res.IsError || got != "statement type SELECT not allowed" {
+		t.Fatalf("expected explain_sql to honor the allowlist, got %+v", res)
+	}
+}
+
+func TestAllowedStatementsApplyToToolsThatRunTheirOwnSQL(t *testing.T) {
+	server := mcpserver.New(t.TempDir(), mcpserver.WithAllowedStatements([]string{"SELECT", "INSERT"}))
+	tx := transport.NewInProcessTransport(server)
+	mcpClient := client.NewClient(tx)
+	ctx := context.Background()
+	if _, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	session := createSession(t, mcpClient)
+	for name, want := range map[string]string{
+		"watch_table":    "statement type CREATE not allowed",
+		"maintain_db":    "statement type VACUUM not allowed",
+		"begin_snapshot": "can't switch the database to WAL mode: statement type PRAGMA not allowed",
+	} {
+		res, err := mcpClient.CallTool(ctx, mcp.CallToolRequest{
+			Request: mcp.Request{Method: "tools/call"},
+			Params: mcp.CallToolParams{Name: name, Arguments: map[string]any{
+				"session": session,
+				"table":   "users",
+			}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := res.Content[0].(mcp.TextContent).Text; !res.IsError || got != want {
+			t.Fatalf("expected %s to honor the allowlist, got %+v", name, res)
+		}
+	}
+}
+
+func TestListSessionsPages(t *testing.T) {
+	server := mcpserver.New(t.TempDir(), mcpserver.WithSessionDiscovery(true))
+	tx := transport.NewInProcessTransport(server)
+	mcpClient := client.NewClient(tx)
+	ctx := context.Background()
+	if _, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var created []string
+	for range 5 {
+		created = append(created, createSession(t, mcpClient))
+	}
+
+	type listing struct {
+		Sessions []struct {
+			ID string `json:"id"`
+		} `json:"sessions"`
+		Total    int `json:"total"`
+		NextPage int `json:"next_page"`
+	}
+	list := func(args map[string]any) listing {
+		t.Helper()
+		res, err := mcpClient.CallTool(ctx, mcp.CallToolRequest{
+			Request: mcp.Request{Method: "tools/call"},
+			Params:  mcp.CallToolParams{Name: "list_sessions", Arguments: args},
+		})
+		if err != nil {
+			t.Fatalf("list_sessions failed: %v", err)
+		}
+		var l listing
+		if err := json.Unmarshal([]byte(res.Content[0].(mcp.TextContent).Text), &l); err != nil {
+			t.Fatal(err)
+		}
+		return l
+	}
+
+	var seen []string
+	pages := 0
+	for page := 1; page != 0; pages++ {
+		l := list(map[string]any{"page": page, "page_size": 2, "sort_by": "created"})
+		if len(l.Sessions) > 2 || l.Total != 5 {
+			t.Fatalf("expected at most 2 of 5 sessions per page, got %+v", l)
+		}
+		for _, s := range l.Sessions {
+			seen = append(seen, s.ID)
+		}
+		page = l.NextPage
+	}
+	if pages != 3 || strings.Join(seen, ",") != strings.Join(created, ",") {
+		t.Fatalf("expected 3 pages in creation order %v, got %d pages of %v", created, pages, seen)
+	}
+	if l := list(map[string]any{"page": 4, "page_size": 2}); len(l.Sessions) != 0 || l.NextPage != 0 {
+		t.Fatalf("expected a page past the end to be empty, got %+v", l)
+	}
+	if l := list(map[string]any{"page": 1 << 62, "page_size": 4}); len(l.Sessions) != 0 || l.Total != 5 {
+		t.Fatalf("expected a huge page to be empty rather than overflow, got %+v", l)
+	}
+	if l := list(map[string]any{"page": 1, "page_size": 1 << 62}); len(l.Sessions) != 5 {
+		t.Fatalf("expected a huge page size to return every session, got %+v", l)
+	}
+}
+
+func TestStructuredResults(t *testing.T) {
+	server := mcpserver.New(t.TempDir(), mcpserver.WithStructuredResults(true))
+	tx := transport.NewInProcessTransport(server)
+	mcpClient := client.NewClient(tx)
+	ctx := context.Background()
+	if _, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	session := createSession(t, mcpClient)
+	runSQL(t, ctx, mcpClient, session, "CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);", nil)
+	runSQL(t, ctx, mcpClient, session, "INSERT INTO users (name) VALUES ('alice');", nil)
+
+	// The client drops structuredContent when parsing results, so read the
+	// server's raw responses.
+	call := func(stmt string) map[string]any {
+		t.Helper()
+		req, _ := json.Marshal(map[string]any{
+			"jsonrpc": "2.0",
+			"id":      1,
+			"method":  "tools/call",
+			"params": map[string]any{
+				"name":      "run_sql",
+				"arguments": map[string]any{"session": session, "sql": stmt},
+			},
+		})
+		raw, err := json.Marshal(server.HandleMessage(ctx, req))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var resp struct {
+			Result map[string]any `json:"result"`
+		}
+		if err := json.Unmarshal(raw, &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Result
+	}
+
+	res := call("SELECT name FROM users;")
+	structured, ok := res["structuredContent"].(map[string]any)
+	if !ok {
+		t.Fatalf("expected structured content, got %v", res)
+	}
+	rows, _ := structured["results"].([]any)
+	if len(rows) != 1 || rows[0].(map[string]any)["name"] != "alice" {
+		t.Fatalf("unexpected structured results: %v", structured)
+	}
+	if content, _ := res["content"].([]any); len(content) != 1 || !strings.Contains(content[0].(map[string]any)["text"].(string), `"name":"alice"`) {
+		t.Fatalf("expected the text fallback to remain, got %v", res)
+	}
+
+	if res := call("SELECT * FROM nowhere;"); res["structuredContent"] != nil {
+		t.Fatalf("expected no structured content on errors, got %v", res)
+	}
+}
+
+func TestCloneSessionIsIndependent(t *testing.T) {
+	server := mcpserver.New(t.TempDir())
+	tx := transport.NewInProcessTransport(server)
+	mcpClient := client.NewClient(tx)
+	ctx := context.Background()
+	if _, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	original := createSession(t, mcpClient)
+	runSQL(t, ctx, mcpClient, original, "PRAGMA journal_mode=WAL;", nil)
+	runSQL(t, ctx, mcpClient, original, "CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);", nil)
+	runSQL(t, ctx, mcpClient, original, "INSERT INTO users (name) VALUES ('alice');", nil)
+
+	res, err := mcpClient.CallTool(ctx, mcp.CallToolRequest{
+		Request: mcp.Request{Method: "tools/call"},
+		Params: mcp.CallToolParams{
+			Name:      "clone_session",
+			Arguments: map[string]any{"session": original},
+		},
+	})
+	if err != nil {
+		t.Fatalf("clone_session failed: %v", err)
+	}
+	var cloned struct {
+		Session string `json:"session"`
+	}
+	if err := json.Unmarshal([]byte(res.Content[0].(mcp.TextContent).Text), &cloned); err != nil || cloned.Session == "" || cloned.Session == original {
+		t.Fatalf("expected a new session, got %+v", res)
+	}
+
+	runSQL(t, ctx, mcpClient, cloned.Session, "INSERT INTO users (name) VALUES ('bob');", nil)
+	runSQL(t, ctx, mcpClient, cloned.Session, "UPDATE users SET name = 'carol' WHERE name = 'alice';", nil)
+
+	if got := runSQL(t, ctx, mcpClient, cloned.Session, "SELECT name FROM users ORDER BY id;", nil).Content[0].(mcp.TextContent).Text; got != `{"results":[{"name":"carol"},{"name":"bob"}]}` {
+		t.Fatalf("expected the clone to hold the copied and new rows, got %s", got)
+	}
+	if got := runSQL(t, ctx, mcpClient, original, "SELECT name FROM users ORDER BY id;", nil).Content[0].(mcp.TextContent).Text; got != `{"results":[{"name":"alice"}]}` {
+		t.Fatalf("expected the original to be unchanged, got %s", got)
+	}
+}
+
+func TestSnapshotHidesConcurrentWrites(t *testing.T) {
+	server := mcpserver.New(t.TempDir())
+	tx := transport.NewInProcessTransport(server)
+	mcpClient := client.NewClient(tx)
+	ctx := context.Background()
+	if _, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	session := createSession(t, mcpClient)
+	runSQL(t, ctx, mcpClient, session, "CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);", nil)
+	runSQL(t, ctx, mcpClient, session, "INSERT INTO users (name) VALUES ('alice');", nil)
+
+	call := func(name string, args map[string]any) *mcp.CallToolResult {
+		t.Helper()
+		res, err := mcpClient.CallTool(ctx, mcp.CallToolRequest{
+			Request: mcp.Request{Method: "tools/call"},
+			Params:  mcp.CallToolParams{Name: name, Arguments: args},
+		})
+		if err != nil {
+			t.Fatalf("%s failed: %v", name, err)
+		}
+		return res
+	}
+	res := call("begin_snapshot", map[string]any{"session": session})
+	var begun struct {
+		Snapshot string `json:"snapshot"`
+	}
+	if err := json.Unmarshal([]byte(res.Content[0].(mcp.TextContent).Text), &begun); err != nil || begun.Snapshot == "" {
+		t.Fatalf("expected a snapshot ID, got %+v", res)
+	}
+	snapshotSQL := func(stmt string) *mcp.CallToolResult {
+		t.Helper()
+		return call("run_sql", map[string]any{"session": session, "sql": stmt, "snapshot": begun.Snapshot})
+	}
+
+	// A write made while the snapshot is open succeeds but isn't visible
+	// through it.
+	if res := runSQL(t, ctx, mcpClient, session, "INSERT INTO users (name) VALUES ('bob');", nil); res.IsError {
+		t.Fatalf("expected the concurrent write to succeed, got %+v", res)
+	}
+	if got := snapshotSQL("SELECT COUNT(*) AS n FROM users;").Content[0].(mcp.TextContent).Text; !strings.Contains(got, `"n":1`) {
+		t.Fatalf("expected the snapshot to miss the new row, got %s", got)
+	}
+	if got := runSQL(t, ctx, mcpClient, session, "SELECT COUNT(*) AS n FROM users;", nil).Content[0].(mcp.TextContent).Text; !strings.Contains(got, `"n":2`) {
+		t.Fatalf("expected a plain query to see the new row, got %s", got)
+	}
+
+	if res := snapshotSQL("DELETE FROM users;"); !res.IsError {
+		t.Fatalf("expected writes through the snapshot to fail, got %+v", res)
+	}
+	if res := snapshotSQL("COMMIT;"); !res.IsError {
+		t.Fatalf("expected COMMIT through the snapshot to be refused, got %+v", res)
+	}
+
+	if res := call("end_snapshot", map[string]any{"snapshot": begun.Snapshot}); res.IsError {
+		t.Fatalf("end_snapshot failed: %+v", res)
+	}
+	if res := snapshotSQL("SELECT 1;"); !res.IsError || !strings.Contains(res.Content[0].(mcp.TextContent).Text, "unknown snapshot") {
+		t.Fatalf("expected the ended snapshot to be gone, got %+v", res)
+	}
+}
+
+func TestSnapshotIsTiedToItsSession(t *testing.T) {
+	server := mcpserver.New(t.TempDir())
+	tx := transport.NewInProcessTransport(server)
+	mcpClient := client.NewClient(tx)
+	ctx := context.Background()
+	if _, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	mine, theirs := createSession(t, mcpClient), createSession(t, mcpClient)
+	runSQL(t, ctx, mcpClient, theirs, "CREATE TABLE secrets (value TEXT);", nil)
+
+	call := func(name string, args map[string]any) *mcp.CallToolResult {
+		t.Helper()
+		res, err := mcpClient.CallTool(ctx, mcp.CallToolRequest{
+			Request: mcp.Request{Method: "tools/call"},
+			Params:  mcp.CallToolParams{Name: name, Arguments: args},
+		})
+		if err != nil {
+			t.Fatalf("%s failed: %v", name, err)
+		}
+		return res
+	}
+	var begun struct {
+		Snapshot string `json:"snapshot"`
+	}
+	res := call("begin_snapshot", map[string]any{"session": theirs})
+	if err := json.Unmarshal([]byte(res.Content[0].(mcp.TextContent).Text), &begun); err != nil || begun.Snapshot == "" {
+		t.Fatalf("expected a snapshot ID, got %+v", res)
+	}
+	defer call("end_snapshot", map[string]any{"snapshot": begun.Snapshot})
+
+	for _, name := range []string{"run_sql", "query_table"} {
+		res := call(name, map[string]any{"session": mine, "sql": "SELECT * FROM secrets;", "snapshot": begun.Snapshot})
+		if got := res.Content[0].(mcp.TextContent).Text; !res.IsError || !strings.Contains(got, "belongs to another session") {
+			t.Fatalf("expected %s to refuse another session's snapshot, got %+v", name, res)
+		}
+	}
+	if res := call("run_sql", map[string]any{"session": theirs, "sql": "SELECT * FROM secrets;", "snapshot": begun.Snapshot}); res.IsError {
+		t.Fatalf("expected the snapshot to work for its own session, got %+v", res)
+	}
+}
+
+func TestMaxCellBytesTruncatesLargeValues(t *testing.T) {
+	server := mcpserver.New(t.TempDir(), mcpserver.WithMaxCellBytes(16))
+	tx := transport.NewInProcessTransport(server)
+	mcpClient := client.NewClient(tx)
+	ctx := context.Background()
+	if _, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	session := createSession(t, mcpClient)
+	runSQL(t, ctx, mcpClient, session, "CREATE TABLE files (name TEXT, data BLOB);", nil)
+	runSQL(t, ctx, mcpClient, session, "INSERT INTO files VALUES ('small', 'tiny'), ('big', zeroblob(1000000));", nil)
+
+	res := runSQL(t, ctx, mcpClient, session, "SELECT name, hex(substr(data, 1, 100)) AS head, data FROM files;", nil)
+	text := res.Content[0].(mcp.TextContent).Text
+	if len(text) > 1000 {
+		t.Fatalf("expected the blob to be truncated, got a %d byte result", len(text))
+	}
+	var out struct {
+		Results []map[string]any `json:"results"`
+	}
+	if err := json.Unmarshal([]byte(text), &out); err != nil {
+		t.Fatalf("failed to unmarshal rows: %v: %s", err, text)
+	}
+	rows := out.Results
+	if len(rows) != 2 || rows[0]["data"] != "tiny" {
+		t.Fatalf("expected the small value untouched, got %v", rows)
+	}
+	want := strings.Repeat("\x00", 16) + "...(truncated, 1000000 bytes in total)"
+	if rows[1]["data"] != want {
+		t.Fatalf("expected the blob to be cut to 16 bytes, got %q", rows[1]["data"])
+	}
+	if head, _ := rows[1]["head"].(string); !strings.HasSuffix(head, "...(truncated, 200 bytes in total)") {
+		t.Fatalf("expected long text to be truncated too, got %q", head)
+	}
+}
+
+func TestResetDataKeepsSchema(t *testing.T) {
+	server := mcpserver.New(t.TempDir())
+	tx := transport.NewInProcessTransport(server)
+	mcpClient := client.NewClient(tx)
+	ctx := context.Background()
+	if _, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	session := createSession(t, mcpClient)
+	runSQL(t, ctx, mcpClient, session, "PRAGMA foreign_keys = ON;", nil)
+	runSQL(t, ctx, mcpClient, session, "CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT);", nil)
+	runSQL(t, ctx, mcpClient, session, "CREATE TABLE posts (id INTEGER PRIMARY KEY, user_id INTEGER REFERENCES users(id), title TEXT);", nil)
+	runSQL(t, ctx, mcpClient, session, "INSERT INTO users (name) VALUES ('alice'), ('bob');", nil)
+	runSQL(t, ctx, mcpClient, session, "INSERT INTO posts (user_id, title) VALUES (1, 'hello');", nil)
+
+	res, err := mcpClient.CallTool(ctx, mcp.CallToolRequest{
+		Request: mcp.Request{Method: "tools/call"},
+		Params: mcp.CallToolParams{
+			Name:      "reset_data",
+			Arguments: map[string]any{"session": session},
+		},
+	})
+	if err != nil {
+		t.Fatalf("reset_data failed: %v", err)
+	}
+	if got := res.Content[0].(mcp.TextContent).Text; res.IsError || got != `{"deleted":{"posts":1,"users":2},"result":"ok"}` {
+		t.Fatalf("unexpected reset_data result: %s", got)
+	}
+
+	for _, table := range []string{"users", "posts"} {
+		if got := runSQL(t, ctx, mcpClient, session, "SELECT COUNT(*) AS n FROM "+table+";", nil).Content[0].(mcp.TextContent).Text; got != `{"results":[{"n":0}]}` {
+			t.Fatalf("expected %s to be empty, got %s", table, got)
+		}
+	}
+	runSQL(t, ctx, mcpClient, session, "INSERT INTO users (name) VALUES ('carol');", nil)
+	if got := runSQL(t, ctx, mcpClient, session, "SELECT id FROM users;", nil).Content[0].(mcp.TextContent).Text; got != `{"results":[{"id":1}]}` {
+		t.Fatalf("expected the AUTOINCREMENT counter to restart, got %s", got)
+	}
+}
+
+func TestRunSQLTrimsPaddingAndTrailingSemicolon(t *testing.T) {
+	server := mcpserver.New(t.TempDir())
+	tx := transport.NewInProcessTransport(server)
+	mcpClient := client.NewClient(tx)
+	ctx := context.Background()
+	if _, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	session := createSession(t, mcpClient)
+	runSQL(t, ctx, mcpClient, session, "CREATE TABLE notes (body TEXT);", nil)
+	runSQL(t, ctx, mcpClient, session, "INSERT INTO notes VALUES ('a;'), ('b');", nil)
+
+	// limit wraps the statement in a subquery, where a trailing semicolon
+	// would be a syntax error.
+	res, err := mcpClient.CallTool(ctx, mcp.CallToolRequest{
+		Request: mcp.Request{Method: "tools/call"},
+		Params: mcp.CallToolParams{
+			Name: "run_sql",
+			Arguments: map[string]any{
+				"session": "  " + session + "\n",
+				"sql":     "\n  SELECT body FROM notes WHERE body != ';' ;  \n",
+				"limit":   1,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := res.Content[0].(mcp.TextContent).Text; res.IsError || got != `{"results":[{"body":"a;"}]}` {
+		t.Fatalf("expected padded SQL to run, got %s", got)
+	}
+
+	// A semicolon closing a literal isn't a statement terminator.
+	if got := runSQL(t, ctx, mcpClient, session, "SELECT 'x;' AS v", nil).Content[0].(mcp.TextContent).Text; got != `{"results":[{"v":"x;"}]}` {
+		t.Fatalf("expected the literal to be kept, got %s", got)
+	}
+}
+
+func TestShowCreateRoundTrips(t *testing.T) {
+	server := mcpserver.New(t.TempDir())
+	tx := transport.NewInProcessTransport(server)
+	mcpClient := client.NewClient(tx)
+	ctx := context.Background()
+	if _, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	call := func(name string, args map[string]any) *mcp.CallToolResult {
+		t.Helper()
+		res, err := mcpClient.CallTool(ctx, mcp.CallToolRequest{
+			Request: mcp.Request{Method: "tools/call"},
+			Params:  mcp.CallToolParams{Name: name, Arguments: args},
+		})
+		if err != nil {
+			t.Fatalf("%s failed: %v", name, err)
+		}
+		return res
+	}
+	showCreate := func(session, table string) string {
+		t.Helper()
+		res := call("show_create", map[string]any{"session": session, "table": table})
+		var out struct {
+			SQL string `json:"sql"`
+		}
+		if err := json.Unmarshal([]byte(res.Content[0].(mcp.TextContent).Text), &out); err != nil || res.IsError {
+			t.Fatalf("show_create failed: %v %+v", err, res)
+		}
+		return out.SQL
+	}
+
+	original := createSession(t, mcpClient)
+	runSQL(t, ctx, mcpClient, original, "CREATE TABLE accounts (id INTEGER PRIMARY KEY, email TEXT UNIQUE NOT NULL, balance INTEGER CHECK (balance >= 0));", nil)
+	runSQL(t, ctx, mcpClient, original, "CREATE INDEX accounts_balance ON accounts (balance);", nil)
+
+	ddl := showCreate(original, "ACCOUNTS")
+	want := "CREATE TABLE accounts (id INTEGER PRIMARY KEY, email TEXT UNIQUE NOT NULL, balance INTEGER CHECK (balance >= 0));\nCREATE INDEX accounts_balance ON accounts (balance);"
+	if ddl != want {
+		t.Fatalf("unexpected DDL:\ngot  %q\nwant %q", ddl, want)
+	}
+
+	copied := createSession(t, mcpClient)
+	if res := call("import_sql", map[string]any{"session": copied, "script": ddl}); res.IsError {
+		t.Fatalf("failed to replay DDL: %+v", res)
+	}
+	if got := showCreate(copied, "accounts"); got != ddl {
+		t.Fatalf("expected the DDL to round-trip, got %q", got)
+	}
+	if res := runSQL(t, ctx, mcpClient, copied, "INSERT INTO accounts (email, balance) VALUES ('a@example.com', -1);", nil); !res.IsError {
+		t.Fatal("expected the CHECK constraint to be recreated")
+	}
+
+	if res := call("show_create", map[string]any{"session": original, "table": "missing"}); !res.IsError || !strings.Contains(res.Content[0].(mcp.TextContent).Text, "no such table") {
+		t.Fatalf("expected a not-found error, got %+v", res)
+	}
+}
+
+func TestUpsertUpdatesExistingRows(t *testing.T) {
+	server := mcpserver.New(t.TempDir())
+	tx := transport.NewInProcessTransport(server)
+	mcpClient := client.NewClient(tx)
+	ctx := context.Background()
+	if _, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	session := createSession(t, mcpClient)
+	runSQL(t, ctx, mcpClient, session, "CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, email TEXT);", nil)
+
+	upsert := func(conflict []any, rows []any) *mcp.CallToolResult {
+		t.Helper()
+		res, err := mcpClient.CallTool(ctx, mcp.CallToolRequest{
+			Request: mcp.Request{Method: "tools/call"},
+			Params: mcp.CallToolParams{Name: "upsert", Arguments: map[string]any{
+				"session":          session,
+				"table":            "users",
+				"conflict_columns": conflict,
+				"rows":             rows,
+			}},
+		})
+		if err != nil {
+			t.Fatalf("upsert failed: %v", err)
+		}
+		return res
+	}
+	counts := func(res *mcp.CallToolResult) map[string]int {
+		t.Helper()
+		if res.IsError {
+			t.Fatalf("upsert failed: %+v", res)
+		}
+		var out map[string]int
+		if err := json.Unmarshal([]byte(res.Content[0].(mcp.TextContent).Text), &out); err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	got := counts(upsert([]any{"id"}, []any{map[string]any{"id": 1, "name": "Ada", "email": "ada@example.com"}}))
+	if want := map[string]int{"inserted": 1, "updated": 0}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	got = counts(upsert([]any{"id"}, []any{
+		map[string]any{"id": 1, "name": "Ada Lovelace", "email": "ada@example.org"},
+		map[string]any{"id": 2, "name": "Grace", "email": "grace@example.com"},
+	}))
+	if want := map[string]int{"inserted": 1, "updated": 1}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	res := runSQL(t, ctx, mcpClient, session, "SELECT name, email FROM users WHERE id = 1;", nil)
+	var out struct {
+		Results []map[string]any `json:"results"`
+	}
+	if err := json.Unmarshal([]byte(res.Content[0].(mcp.TextContent).Text), &out); err != nil {
+		t.Fatal(err)
+	}
+	if want := []map[string]any{{"name": "Ada Lovelace", "email": "ada@example.org"}}; !reflect.DeepEqual(out.Results, want) {
+		t.Fatalf("expected the row to be updated in place, got %v", out.Results)
+	}
+
+	if res := upsert([]any{"nope"}, []any{map[string]any{"id": 3}}); !res.IsError || !strings.Contains(res.Content[0].(mcp.TextContent).Text, `no column "nope"`) {
+		t.Fatalf("expected an unknown conflict column to be rejected, got %+v", res)
+	}
+}
+
+func TestWatchTableRecordsBlobsAsHex(t *testing.T) {
+	server := mcpserver.New(t.TempDir())
+	tx := transport.NewInProcessTransport(server)
+	mcpClient := client.NewClient(tx)
+	ctx := context.Background()
+	if _, err := mcpClient.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	session := createSession(t, mcpClient)
+	runSQL(t, ctx, mcpClient, session, "CREATE TABLE files (id INTEGER PRIMARY KEY, data BLOB);", nil)
+	runSQL(t, ctx, mcpClient, session, "CREATE TABLE kv (k TEXT PRIMARY KEY, v TEXT) WITHOUT ROWID;", nil)
+	call := func(name string, args map[string]any) *mcp.CallToolResult {
+		t.Helper()
+		res, err := mcpClient.CallTool(ctx, mcp.CallToolRequest{
+			Request: mcp.Request{Method: "tools/call"},
+			Params:  mcp.CallToolParams{Name: name, Arguments: args},
+		})
+		if err != nil {
+			t.Fatalf("%s failed: %v", name, err)
+		}
+		return res
+	}
+
+	if res := call("watch_table", map[string]any{"session": session, "table": "files"}); res.IsError {
+		t.Fatalf("watch_table returned an error: %+v", res)
+	}
+	for _, stmt := range []string{
+		"INSERT INTO files (data) VALUES (X'CAFE');",
+		"UPDATE files SET data = X'BEEF';",
+		"DELETE FROM files;",
+	} {
+		if res := runSQL(t, ctx, mcpClient, session, stmt, nil); res.IsError {
+			t.Fatalf("%s failed on a watched BLOB column: %+v", stmt, res)
+		}
+	}
+	runSQL(t, ctx, mcpClient, session, "INSERT INTO files (data) VALUES (X'00');", nil)
+	if res := call("reset_data", map[string]any{"session": session}); res.IsError {
+		t.Fatalf("reset_data failed on a watched BLOB column: %+v", res)
+	}
+
+	res := call("poll_changes", map[string]any{"session": session})
+	var out struct {
+		Changes []struct {
+			Op  string         `json:"op"`
+			Row map[string]any `json:"row"`
+		} `json:"changes"`
+	}
+	if err := json.Unmarshal([]byte(res.Content[0].(mcp.TextContent).Text), &out); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range out.Changes {
+		got = append(got, fmt.Sprintf("%s:%v", c.Op, c.Row["data"]))
+	}
+	if want := "insert:CAFE update:BEEF delete:BEEF insert:00 delete:00"; strings.Join(got, " ") != want {
+		t.Fatalf("expected changes %q, got %q", want, strings.Join(got, " "))
+	}
+
+	if res := call("watch_table", map[string]any{"session": session, "table": "kv"}); !res.IsError || !strings.Contains(res.Content[0].(mcp.TextContent).Text, "WITHOUT ROWID") {
+		t.Fatalf("expected a WITHOUT ROWID table to be refused, got %+v", res)
+	}
+}
+
+func createSession(t *testing.T, mcpClient *client.Client) string {
+	t.Helper()
+	createReq := mcp.CallToolRequest{
+		Request: mcp.Request{Method: "tools/call"},
+		Params:  mcp.CallToolParams{Name: "create_db"},
+	}
+	createRes, err := mcpClient.CallTool(context.Background(), createReq)
+	if err != nil {
+		t.Fatalf("create_db failed: %v", err)
+	}
+	var created struct {
+		Session string `json:"session"`
+	}
+	if err := json.Unmarshal([]byte(createRes.Content[0].(mcp.TextContent).Text), &created); err != nil {
+		t.Fatalf("failed to unmarshal session ID: %v", err)
+	}
+	return created.Session
+}
+
+func runSQL(t *testing.T, ctx context.Context, mcpClient *client.Client, session, stmt string, meta *mcp.Meta) *mcp.CallToolResult {
+	t.Helper()
+	runReq := mcp.CallToolRequest{
+		Request: mcp.Request{Method: "tools/call"},
+		Params: mcp.CallToolParams{
+			Name: "run_sql",
+			Arguments: map[string]string{
+				"session": session,
+				"sql":     stmt,
+			},
+			Meta: meta,
+		},
+	}
+	res, err := mcpClient.CallTool(ctx, runReq)
+	if err != nil {
+		t.Fatalf("run_sql failed: %v", err)
+	}
+	return res
+}
+
+// testSession is a client session whose notifications can be read back by
+// the test.
+type testSession struct {
+	notifications chan mcp.JSONRPCNotification
+	initialized   atomic.Bool
+}
+
+func (s *testSession) Initialize()       { s.initialized.Store(true) }
+func (s *testSession) Initialized() bool { return s.initialized.Load() }
+func (s *testSession) SessionID() string { return "test-session" }
+
+func (s *testSession) NotificationChannel() chan<- mcp.JSONRPCNotification {
+	return s.notifications
+}
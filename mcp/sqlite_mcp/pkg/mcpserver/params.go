@@ -0,0 +1,95 @@
+package mcpserver
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// placeholders scans a statement for bind parameters, skipping string
+// literals, quoted identifiers and comments. It returns the names used by
+// :name, @name and $name placeholders, and the number of values the
+// positional ? and ?NNN placeholders need.
+func placeholders(sqlStmt string) (names []string, positional int) {
+	seen := map[string]bool{}
+	for i := 0; i < len(sqlStmt); i++ {
+		if end, ok := skipQuoted(sqlStmt, i); ok {
+			i = end
+			continue
+		}
+		switch c := sqlStmt[i]; c {
+		case '?':
+			j := i + 1
+			for j < len(sqlStmt) && sqlStmt[j] >= '0' && sqlStmt[j] <= '9' {
+				j++
+			}
+			if n, err := strconv.Atoi(sqlStmt[i+1 : j]); err == nil {
+				positional = max(positional, n)
+			} else {
+				positional++
+			}
+			i = j - 1
+		case ':', '@', '$':
+			j := i + 1
+			for j < len(sqlStmt) && isWordByte(sqlStmt[j]) {
+				j++
+			}
+			if j == i+1 {
+				continue
+			}
+			if name := sqlStmt[i+1 : j]; !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+			i = j - 1
+		}
+	}
+	return names, positional
+}
+
+// bindArgs checks the statement's placeholders against the supplied values
+// and returns the arguments to run it with. Positional and named parameters
+// can't be mixed, since SQLite numbers them in a way that's easy to get
+// wrong.
+func bindArgs(sqlStmt string, params []any, namedParams map[string]any) ([]any, error) {
+	names, positional := placeholders(sqlStmt)
+	if len(names) > 0 && positional > 0 {
+		return nil, fmt.Errorf("statement mixes positional and named placeholders; use one or the other")
+	}
+	if len(params) > 0 && len(namedParams) > 0 {
+		return nil, fmt.Errorf("'params' and 'named_params' can't both be set")
+	}
+
+	if positional != len(params) {
+		return nil, fmt.Errorf("statement has %d positional placeholders but %d params were given", positional, len(params))
+	}
+
+	for name := range namedParams {
+		if name == "" || !(name[0] >= 'a' && name[0] <= 'z' || name[0] >= 'A' && name[0] <= 'Z') {
+			return nil, fmt.Errorf("named parameter %q must begin with a letter", name)
+		}
+	}
+
+	var missing []string
+	for _, name := range names {
+		if _, ok := namedParams[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("no value given for named placeholders: %s", strings.Join(missing, ", "))
+	}
+
+	args := append([]any(nil), params...)
+	keys := make([]string, 0, len(namedParams))
+	for name := range namedParams {
+		keys = append(keys, name)
+	}
+	sort.Strings(keys)
+	for _, name := range keys {
+		args = append(args, sql.Named(name, namedParams[name]))
+	}
+	return args, nil
+}
@@ -0,0 +1,101 @@
+package mcpserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func (s *handlers) resetDataHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	session, err := req.RequireString("session")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if err := s.checkAllowed("DELETE"); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	db, err := s.manager.GetDB(session)
+	if err != nil {
+		return mcp.NewToolResultErrorFromErr("invalid session", err), nil
+	}
+	defer db.Close()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Shadow tables backing virtual tables are emptied through the virtual
+	// table itself. SQLite's own tables, the metadata table every session is
+	// created with and watch_table's change log aren't user data.
+	rows, err := tx.QueryContext(ctx, "SELECT name FROM pragma_table_list WHERE schema = 'main' AND type IN ('table', 'virtual') AND name NOT LIKE 'sqlite\\_%' ESCAPE '\\' AND name NOT IN ('metadata', ?) ORDER BY name;", changesTable)
+	if err != nil {
+		return nil, err
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		tables = append(tables, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Foreign keys are checked at commit, once every table is empty, so the
+	// order the tables are emptied in doesn't matter.
+	if _, err := tx.ExecContext(ctx, "PRAGMA defer_foreign_keys = ON;"); err != nil {
+		return nil, err
+	}
+	deleted := map[string]int64{}
+	for _, table := range tables {
+		res, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s;", quoteIdent(table)))
+		if err != nil {
+			return mcp.NewToolResultErrorFromErr(fmt.Sprintf("sql error emptying %s; nothing was reset", table), err), nil
+		}
+		deleted[table], _ = res.RowsAffected()
+	}
+
+	// Restart AUTOINCREMENT counters. sqlite_sequence only exists once a
+	// table uses AUTOINCREMENT.
+	var hasSequence bool
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) > 0 FROM sqlite_master WHERE name = 'sqlite_sequence';").Scan(&hasSequence); err != nil {
+		return nil, err
+	}
+	if hasSequence && len(tables) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(tables)), ", ")
+		args := make([]any, len(tables))
+		for i, table := range tables {
+			args[i] = table
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM sqlite_sequence WHERE name IN (%s);", placeholders), args...); err != nil {
+			return mcp.NewToolResultErrorFromErr("sql error", err), nil
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return mcp.NewToolResultErrorFromErr("sql error", err), nil
+	}
+
+	jsonBytes, _ := json.Marshal(map[string]any{
+		"result":  "ok",
+		"deleted": deleted,
+	})
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{
+				Type: "text",
+				Text: string(jsonBytes),
+			},
+		},
+	}, nil
+}
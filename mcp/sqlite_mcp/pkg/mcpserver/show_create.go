@@ -0,0 +1,65 @@
+package mcpserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func (s *handlers) showCreateHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	session, err := req.RequireString("session")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	table, err := req.RequireString("table")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	db, err := s.manager.GetDB(session)
+	if err != nil {
+		return mcp.NewToolResultErrorFromErr("invalid session", err), nil
+	}
+	defer db.Close()
+
+	// Table names are case-insensitive. Indexes SQLite creates itself for
+	// PRIMARY KEY and UNIQUE constraints have no SQL and come back with the
+	// table.
+	rows, err := db.QueryContext(ctx, `SELECT sql FROM sqlite_master
+		WHERE tbl_name = ? COLLATE NOCASE AND type IN ('table', 'index') AND sql IS NOT NULL
+		ORDER BY type = 'index', name;`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stmts []string
+	for rows.Next() {
+		var stmt string
+		if err := rows.Scan(&stmt); err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, stmt+";")
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(stmts) == 0 {
+		return mcp.NewToolResultError(fmt.Sprintf("no such table: %s", table)), nil
+	}
+
+	jsonBytes, _ := json.Marshal(map[string]any{
+		"sql": strings.Join(stmts, "\n"),
+	})
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{
+				Type: "text",
+				Text: string(jsonBytes),
+			},
+		},
+	}, nil
+}
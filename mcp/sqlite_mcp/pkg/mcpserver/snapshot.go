@@ -0,0 +1,199 @@
+package mcpserver
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// snapshotIdleTimeout is how long a snapshot is kept without being used
+// before it is ended.
+const snapshotIdleTimeout = 5 * time.Minute
+
+// A snapshot is a read transaction held open on a pinned connection. Every
+// query run against it sees the database as it was when the snapshot began,
+// even while other calls write to the session, so several queries can be
+// compared consistently.
+//
+// The isolation comes from SQLite's WAL mode, so begin_snapshot switches the
+// database to it. Writers carry on while the snapshot is open and their
+// changes become visible to queries that don't use it. Queries through a
+// snapshot are read-only. In-memory sessions use a shared cache, where an
+// open read transaction blocks writers, so they can't be snapshotted.
+type snapshot struct {
+	// mu serializes queries on conn.
+	mu    sync.Mutex
+	db    *sql.DB
+	conn  *sql.Conn
+	timer *time.Timer
+	// path is the database file of the session the snapshot was taken of.
+	// It identifies the session whether callers name it by ID or label.
+	path string
+}
+
+// snapshotSet holds the open snapshots by ID.
+type snapshotSet struct {
+	mu sync.Mutex
+	m  map[string]*snapshot
+}
+
+func (ss *snapshotSet) add(snap *snapshot) string {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.m == nil {
+		ss.m = map[string]*snapshot{}
+	}
+	id := newSnapshotID()
+	ss.m[id] = snap
+	snap.timer = time.AfterFunc(snapshotIdleTimeout, func() { ss.end(id) })
+	return id
+}
+
+// acquire locks the snapshot for a query against the session whose database
+// is at path and restarts its idle timer. The returned func unlocks it.
+func (ss *snapshotSet) acquire(id, path string) (*snapshot, func(), error) {
+	ss.mu.Lock()
+	snap, ok := ss.m[id]
+	ss.mu.Unlock()
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown snapshot %s; it may have ended or been idle for over %v", id, snapshotIdleTimeout)
+	}
+	if snap.path != path {
+		return nil, nil, fmt.Errorf("snapshot %s belongs to another session", id)
+	}
+	snap.mu.Lock()
+	snap.timer.Reset(snapshotIdleTimeout)
+	return snap, snap.mu.Unlock, nil
+}
+
+// end releases the snapshot, reporting whether it was open.
+func (ss *snapshotSet) end(id string) bool {
+	ss.mu.Lock()
+	snap, ok := ss.m[id]
+	delete(ss.m, id)
+	ss.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	snap.timer.Stop()
+	snap.mu.Lock()
+	defer snap.mu.Unlock()
+	snap.conn.ExecContext(context.Background(), "ROLLBACK;")
+	snap.conn.Close()
+	snap.db.Close()
+	return true
+}
+
+// checkSnapshotStatements refuses statements that would end or nest the
+// snapshot's transaction.
+func checkSnapshotStatements(stmts ...string) error {
+	for _, stmt := range stmts {
+		switch typ := statementType(stmt); typ {
+		case "BEGIN", "COMMIT", "END", "ROLLBACK", "SAVEPOINT", "RELEASE":
+			return fmt.Errorf("%s can't be run in a snapshot", typ)
+		}
+	}
+	return nil
+}
+
+// newSnapshotID returns a random ID so clients can't guess each other's
+// snapshots.
+func newSnapshotID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("failed to generate snapshot ID: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+func (s *handlers) beginSnapshotHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	session, err := req.RequireString("session")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	path, err := s.manager.GetPath(session)
+	if err != nil {
+		return mcp.NewToolResultErrorFromErr("can't snapshot session", err), nil
+	}
+
+	db, err := s.manager.GetDB(session)
+	if err != nil {
+		return mcp.NewToolResultErrorFromErr("invalid session", err), nil
+	}
+	// The connection outlives this call, so it mustn't be tied to ctx.
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	fail := func(err error) (*mcp.CallToolResult, error) {
+		conn.Close()
+		db.Close()
+		return mcp.NewToolResultErrorFromErr("failed to begin snapshot", err), nil
+	}
+
+	var mode string
+	if err := conn.QueryRowContext(ctx, "PRAGMA journal_mode;").Scan(&mode); err != nil {
+		return fail(err)
+	}
+	if mode != "wal" {
+		// Switching to WAL is a lasting change to the database, so it is
+		// held to the allowlist like a PRAGMA a client runs itself.
+		if err := s.checkAllowed("PRAGMA"); err != nil {
+			conn.Close()
+			db.Close()
+			return mcp.NewToolResultError(fmt.Sprintf("can't switch the database to WAL mode: %v", err)), nil
+		}
+		if err := conn.QueryRowContext(ctx, "PRAGMA journal_mode=WAL;").Scan(&mode); err != nil {
+			return fail(err)
+		}
+		if mode != "wal" {
+			return fail(fmt.Errorf("database is in %s journal mode and couldn't be switched to WAL", mode))
+		}
+	}
+	if _, err := conn.ExecContext(ctx, "PRAGMA query_only=ON;"); err != nil {
+		return fail(err)
+	}
+	// A deferred transaction only takes its snapshot at the first read.
+	if _, err := conn.ExecContext(ctx, "BEGIN DEFERRED;"); err != nil {
+		return fail(err)
+	}
+	var n int
+	if err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master;").Scan(&n); err != nil {
+		conn.ExecContext(ctx, "ROLLBACK;")
+		return fail(err)
+	}
+
+	id := s.snapshots.add(&snapshot{db: db, conn: conn, path: path})
+	jsonBytes, _ := json.Marshal(map[string]any{
+		"snapshot":        id,
+		"idle_timeout_ms": snapshotIdleTimeout.Milliseconds(),
+	})
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{
+				Type: "text",
+				Text: string(jsonBytes),
+			},
+		},
+	}, nil
+}
+
+func (s *handlers) endSnapshotHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	id, err := req.RequireString("snapshot")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if !s.snapshots.end(id) {
+		return mcp.NewToolResultError(fmt.Sprintf("unknown snapshot %s", id)), nil
+	}
+	return mcp.NewToolResultText(`{"result":"ok"}`), nil
+}
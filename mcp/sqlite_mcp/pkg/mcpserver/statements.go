@@ -0,0 +1,127 @@
+package mcpserver
+
+import "strings"
+
+// splitStatements splits sqlStmt into its top-level statements, ignoring
+// semicolons inside literals, comments and the body of a CREATE TRIGGER.
+// Empty statements are dropped.
+func splitStatements(sqlStmt string) []string {
+	var (
+		stmts     []string
+		start     int
+		nonEmpty  bool
+		words     int  // words seen in the current statement
+		create    bool // current statement starts with CREATE
+		trigger   bool // current statement is CREATE [TEMP] TRIGGER
+		inBody    bool // inside the trigger's BEGIN ... END
+		caseDepth int
+	)
+	flush := func(end int) {
+		if nonEmpty {
+			stmts = append(stmts, strings.TrimSpace(sqlStmt[start:end]))
+		}
+		start, nonEmpty, words, create, trigger, inBody, caseDepth = end+1, false, 0, false, false, false, 0
+	}
+
+	for i := 0; i < len(sqlStmt); i++ {
+		if end, ok := skipQuoted(sqlStmt, i); ok {
+			// Comments alone don't make a statement.
+			if c := sqlStmt[i]; c != '-' && c != '/' {
+				nonEmpty = true
+			}
+			i = end
+			continue
+		}
+		c := sqlStmt[i]
+		switch {
+		case c == ';':
+			if !inBody {
+				flush(i)
+			}
+		case c == ':' || c == '@' || c == '$':
+			// Skip parameter names so :end isn't mistaken for END.
+			nonEmpty = true
+			for i+1 < len(sqlStmt) && isWordByte(sqlStmt[i+1]) {
+				i++
+			}
+		case isWordByte(c):
+			nonEmpty = true
+			j := i
+			for j < len(sqlStmt) && isWordByte(sqlStmt[j]) {
+				j++
+			}
+			word := strings.ToUpper(sqlStmt[i:j])
+			i = j - 1
+
+			words++
+			switch {
+			case words == 1 && word == "CREATE":
+				create = true
+			case create && words <= 3 && word == "TRIGGER":
+				trigger = true
+			case trigger && !inBody && word == "BEGIN":
+				inBody = true
+			case inBody && word == "CASE":
+				caseDepth++
+			case inBody && word == "END":
+				if caseDepth > 0 {
+					caseDepth--
+				} else {
+					inBody = false
+				}
+			}
+		case c != ' ' && c != '\t' && c != '\n' && c != '\r':
+			nonEmpty = true
+		}
+	}
+	flush(len(sqlStmt))
+	return stmts
+}
+
+// normalizeSQL trims surrounding whitespace and a single trailing semicolon
+// from sqlStmt. A semicolon that ends a literal, quoted identifier or comment
+// is left alone.
+func normalizeSQL(sqlStmt string) string {
+	sqlStmt = strings.TrimSpace(sqlStmt)
+	if !strings.HasSuffix(sqlStmt, ";") {
+		return sqlStmt
+	}
+	last := len(sqlStmt) - 1
+	for i := 0; i < last; i++ {
+		if end, ok := skipQuoted(sqlStmt, i); ok {
+			if end >= last {
+				return sqlStmt
+			}
+			i = end
+		}
+	}
+	return strings.TrimSpace(sqlStmt[:last])
+}
+
+// skipQuoted reports whether a string literal, quoted identifier or comment
+// starts at i, and if so returns the index of its last byte.
+func skipQuoted(sqlStmt string, i int) (int, bool) {
+	closeAt := func(from int, closer string) int {
+		if end := strings.Index(sqlStmt[from:], closer); end >= 0 {
+			return from + end + len(closer) - 1
+		}
+		return len(sqlStmt) - 1
+	}
+	switch c := sqlStmt[i]; {
+	case c == '\'' || c == '"' || c == '`':
+		// Quotes are escaped by doubling them, which this handles by
+		// simply closing and reopening the literal.
+		return closeAt(i+1, string(c)), true
+	case c == '[':
+		return closeAt(i+1, "]"), true
+	case strings.HasPrefix(sqlStmt[i:], "--"):
+		return closeAt(i+2, "\n"), true
+	case strings.HasPrefix(sqlStmt[i:], "/*"):
+		return closeAt(i+2, "*/"), true
+	}
+	return i, false
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
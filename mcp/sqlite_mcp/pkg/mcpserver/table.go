@@ -0,0 +1,172 @@
+package mcpserver
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Defaults for query_table's max_rows and max_column_width.
+const (
+	defaultTableRows        = 50
+	defaultTableColumnWidth = 40
+)
+
+func (s *handlers) queryTableHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	session, err := req.RequireString("session")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	sqlStmt, err := req.RequireString("sql")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if stmts := splitStatements(sqlStmt); len(stmts) != 1 {
+		return mcp.NewToolResultError(fmt.Sprintf("query_table runs a single statement but got %d", len(stmts))), nil
+	}
+	if err := s.checkAllowed(sqlStmt); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	maxRows := req.GetInt("max_rows", defaultTableRows)
+	width := req.GetInt("max_column_width", defaultTableColumnWidth)
+	if maxRows <= 0 || width <= 0 {
+		return mcp.NewToolResultError("'max_rows' and 'max_column_width' must be positive"), nil
+	}
+
+	args := req.GetArguments()
+	params, ok := args["params"].([]any)
+	if !ok && args["params"] != nil {
+		return mcp.NewToolResultError("'params' must be an array"), nil
+	}
+	namedParams, ok := args["named_params"].(map[string]any)
+	if !ok && args["named_params"] != nil {
+		return mcp.NewToolResultError("'named_params' must be an object"), nil
+	}
+	bound, err := bindArgs(sqlStmt, params, namedParams)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	var q interface {
+		QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	}
+	if id := req.GetString("snapshot", ""); id != "" {
+		if err := checkSnapshotStatements(sqlStmt); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		path, err := s.manager.GetPath(session)
+		if err != nil {
+			return mcp.NewToolResultErrorFromErr("invalid session", err), nil
+		}
+		snap, release, err := s.snapshots.acquire(id, path)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		defer release()
+		q = snap.conn
+	} else {
+		db, err := s.manager.GetDB(session)
+		if err != nil {
+			return mcp.NewToolResultErrorFromErr("invalid session", err), nil
+		}
+		defer db.Close()
+		q = db
+	}
+
+	rows, err := q.QueryContext(ctx, sqlStmt, bound...)
+	if err != nil {
+		return mcp.NewToolResultErrorFromErr("sql error", err), nil
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	if len(cols) == 0 {
+		return mcp.NewToolResultError("statement doesn't return rows; use run_sql to modify the database"), nil
+	}
+
+	var (
+		cells [][]string
+		more  bool
+	)
+	for rows.Next() {
+		if len(cells) == maxRows {
+			more = true
+			break
+		}
+		values, err := s.scanValues(rows, len(cols))
+		if err != nil {
+			return nil, err
+		}
+		row := make([]string, len(values))
+		for i, v := range values {
+			row[i] = tableCell(v, width)
+		}
+		cells = append(cells, row)
+	}
+	if err := rows.Err(); err != nil {
+		return mcp.NewToolResultErrorFromErr("sql error", err), nil
+	}
+
+	header := make([]string, len(cols))
+	for i, c := range cols {
+		header[i] = tableCell(c, width)
+	}
+	text := formatTable(header, cells)
+	if more {
+		text += fmt.Sprintf("\n(only the first %d rows are shown)", maxRows)
+	}
+	return mcp.NewToolResultText(text), nil
+}
+
+// tableCell renders v for a table cell on a single line, cut to width
+// characters. Pipes are escaped so they don't end the cell.
+func tableCell(v any, width int) string {
+	var s string
+	if v == nil {
+		s = "NULL"
+	} else {
+		s = fmt.Sprint(v)
+	}
+	s = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ", "\t", " ").Replace(s)
+	if utf8.RuneCountInString(s) > width {
+		s = string([]rune(s)[:width]) + "..."
+	}
+	return strings.ReplaceAll(s, "|", `\|`)
+}
+
+// formatTable lays out header and rows as a markdown table with each column
+// padded to its widest cell.
+func formatTable(header []string, rows [][]string) string {
+	widths := make([]int, len(header))
+	for _, row := range append([][]string{header}, rows...) {
+		for i, cell := range row {
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell), 3)
+		}
+	}
+
+	var b strings.Builder
+	writeRow := func(row []string) {
+		b.WriteString("|")
+		for i, cell := range row {
+			fmt.Fprintf(&b, " %s%s |", cell, strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell)))
+		}
+		b.WriteString("\n")
+	}
+	writeRow(header)
+	b.WriteString("|")
+	for _, w := range widths {
+		fmt.Fprintf(&b, " %s |", strings.Repeat("-", w))
+	}
+	b.WriteString("\n")
+	for _, row := range rows {
+		writeRow(row)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,151 @@
+package mcpserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func (s *handlers) upsertHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	session, err := req.RequireString("session")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	table, err := req.RequireString("table")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	conflictCols, err := req.RequireStringSlice("conflict_columns")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if len(conflictCols) == 0 {
+		return mcp.NewToolResultError("'conflict_columns' must name at least one column"), nil
+	}
+	// An upsert is an INSERT statement, but it overwrites existing rows, so
+	// it is only allowed where updates are too.
+	if err := s.checkAllowed("INSERT", "UPDATE"); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	rows, cols, err := uniformRows(req.GetArguments()["rows"])
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	db, err := s.manager.GetDB(session)
+	if err != nil {
+		return mcp.NewToolResultErrorFromErr("invalid session", err), nil
+	}
+	defer db.Close()
+
+	tableCols, err := tableColumns(ctx, db, table)
+	if err != nil {
+		return nil, err
+	}
+	if len(tableCols) == 0 {
+		return mcp.NewToolResultError(fmt.Sprintf("no such table: %s", table)), nil
+	}
+	// Column names are case-insensitive in SQLite.
+	hasCol := func(cs []string, col string) bool {
+		return slices.ContainsFunc(cs, func(c string) bool { return strings.EqualFold(c, col) })
+	}
+	for _, col := range conflictCols {
+		if !hasCol(tableCols, col) {
+			return mcp.NewToolResultError(fmt.Sprintf("table %s has no column %q", table, col)), nil
+		}
+		if !hasCol(cols, col) {
+			return mcp.NewToolResultError(fmt.Sprintf("rows are missing conflict column %q", col)), nil
+		}
+	}
+
+	quoted := make([]string, len(cols))
+	placeholders := make([]string, len(cols))
+	var set []string
+	for i, col := range cols {
+		quoted[i] = quoteIdent(col)
+		placeholders[i] = "?"
+		if !hasCol(conflictCols, col) {
+			set = append(set, fmt.Sprintf("%s = excluded.%s", quoted[i], quoted[i]))
+		}
+	}
+	quotedConflict := make([]string, len(conflictCols))
+	where := make([]string, len(conflictCols))
+	for i, col := range conflictCols {
+		quotedConflict[i] = quoteIdent(col)
+		where[i] = quotedConflict[i] + " = ?"
+	}
+	// Rows made up of nothing but the conflict columns have nothing to update.
+	action := "DO NOTHING"
+	if len(set) > 0 {
+		action = "DO UPDATE SET " + strings.Join(set, ", ")
+	}
+	upsertStmt := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (%s) %s;", quoteIdent(table), strings.Join(quoted, ", "), strings.Join(placeholders, ", "), strings.Join(quotedConflict, ", "), action)
+	// Both branches of an upsert report one affected row, so whether a row
+	// will be updated is looked up first. NULLs never conflict, and never
+	// match here either.
+	existsStmt := fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE %s);", quoteIdent(table), strings.Join(where, " AND "))
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, upsertStmt)
+	if err != nil {
+		return mcp.NewToolResultErrorFromErr("sql error", err), nil
+	}
+	defer stmt.Close()
+	exists, err := tx.PrepareContext(ctx, existsStmt)
+	if err != nil {
+		return mcp.NewToolResultErrorFromErr("sql error", err), nil
+	}
+	defer exists.Close()
+
+	var inserted, updated int
+	values := make([]any, len(cols))
+	keys := make([]any, len(conflictCols))
+	for i, row := range rows {
+		for j, col := range cols {
+			values[j] = row[col]
+		}
+		for j, col := range conflictCols {
+			k := slices.IndexFunc(cols, func(c string) bool { return strings.EqualFold(c, col) })
+			keys[j] = row[cols[k]]
+		}
+		var found bool
+		if err := exists.QueryRowContext(ctx, keys...).Scan(&found); err != nil {
+			return mcp.NewToolResultErrorFromErr(fmt.Sprintf("sql error upserting row %d", i), err), nil
+		}
+		if _, err := stmt.ExecContext(ctx, values...); err != nil {
+			return mcp.NewToolResultErrorFromErr(fmt.Sprintf("sql error upserting row %d; nothing was written", i), err), nil
+		}
+		switch {
+		case !found:
+			inserted++
+		case len(set) > 0:
+			updated++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return mcp.NewToolResultErrorFromErr("sql error", err), nil
+	}
+
+	jsonBytes, _ := json.Marshal(map[string]any{
+		"inserted": inserted,
+		"updated":  updated,
+	})
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{
+				Type: "text",
+				Text: string(jsonBytes),
+			},
+		},
+	}, nil
+}
@@ -0,0 +1,81 @@
+package sessionmanager
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// ErrEncryptionUnsupported is returned by SetEncryptionKey when the linked
+// SQLite library has no codec. Stock SQLite silently ignores PRAGMA key, so
+// without this check the files would be written in plaintext.
+var ErrEncryptionUnsupported = errors.New("encryption requires SQLite built with SQLCipher (build with -tags libsqlite3 against libsqlcipher)")
+
+// EncryptionSupported reports whether the linked SQLite library is SQLCipher.
+func EncryptionSupported() bool {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		return false
+	}
+	defer db.Close()
+
+	var v string
+	if err := db.QueryRow("PRAGMA cipher_version;").Scan(&v); err != nil {
+		return false
+	}
+	return v != ""
+}
+
+// SetEncryptionKey makes every database the manager opens from now on
+// encrypted with key. Sessions created before the key was set can't be
+// opened afterwards.
+func (m *SessionManager) SetEncryptionKey(key string) error {
+	if key != "" && !EncryptionSupported() {
+		return ErrEncryptionUnsupported
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.key = key
+	return nil
+}
+
+// open opens the database at dsn, keying each new connection if an
+// encryption key is set.
+func (m *SessionManager) open(dsn string) (*sql.DB, error) {
+	m.mu.Lock()
+	key := m.key
+	m.mu.Unlock()
+	if key == "" {
+		return sql.Open("sqlite3", dsn)
+	}
+
+	d := &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			// PRAGMA doesn't take bind parameters, so quote the key as a
+			// string literal.
+			_, err := conn.Exec("PRAGMA key = '"+strings.ReplaceAll(key, "'", "''")+"';", nil)
+			return err
+		},
+	}
+	return sql.OpenDB(connector{dsn: dsn, driver: d}), nil
+}
+
+// connector opens connections to a fixed DSN with a configured driver,
+// avoiding a global sql.Register per key.
+type connector struct {
+	dsn    string
+	driver *sqlite3.SQLiteDriver
+}
+
+func (c connector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c connector) Driver() driver.Driver {
+	return c.driver
+}
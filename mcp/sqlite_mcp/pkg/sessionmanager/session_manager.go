@@ -1,30 +1,78 @@
 package sessionmanager
 
 import (
+	"context"
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"math/rand"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"time"
-
-	_ "github.com/mattn/go-sqlite3"
 )
 
 type SessionInfo struct {
 	Path       string
+	Label      string
+	InMemory   bool
+	CreatedAt  time.Time
 	ExpiresAt  time.Time
 	LastAccess time.Time
+
+	Metrics SessionMetrics
+
+	// keepAlive holds a connection open to in-memory databases, which
+	// SQLite discards once their last connection is closed.
+	keepAlive *sql.DB
 }
 
+// SessionMetrics counts the queries run against a session.
+type SessionMetrics struct {
+	Queries   int64         `json:"queries"`
+	Rows      int64         `json:"rows"`
+	Errors    int64         `json:"errors"`
+	QueryTime time.Duration `json:"-"`
+}
+
+// MarshalJSON reports QueryTime in milliseconds.
+func (sm SessionMetrics) MarshalJSON() ([]byte, error) {
+	type metrics SessionMetrics
+	return json.Marshal(struct {
+		metrics
+		QueryTimeMS float64 `json:"query_time_ms"`
+	}{metrics(sm), float64(sm.QueryTime) / float64(time.Millisecond)})
+}
+
+// ErrQuotaExceeded is returned by CreateDatabase when the database files
+// already use up the storage quota.
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+// ErrLabelInUse is returned by SetLabel when the label already names another
+// session.
+var ErrLabelInUse = errors.New("label already in use")
+
 type SessionManager struct {
-	sessions    map[string]*SessionInfo
-	mu          sync.Mutex
-	rootDir     string
-	expiration  time.Duration
-	cleanupFreq time.Duration
+	sessions      map[string]*SessionInfo
+	mu            sync.Mutex
+	rootDir       string
+	expiration    time.Duration
+	cleanupFreq   time.Duration
+	maxTotalBytes int64
+	key           string
+}
+
+// StorageStats describes the sessions and the disk space their database
+// files use.
+type StorageStats struct {
+	Sessions         int   `json:"sessions"`
+	InMemorySessions int   `json:"in_memory_sessions"`
+	TotalBytes       int64 `json:"total_bytes"`
+	MaxTotalBytes    int64 `json:"max_total_bytes,omitempty"`
 }
 
 func NewSessionManager(rootDir string, expiration time.Duration) *SessionManager {
@@ -43,12 +91,89 @@ func NewSessionManager(rootDir string, expiration time.Duration) *SessionManager
 	return mgr
 }
 
+// SetMaxTotalBytes sets the storage quota for database files. Once they use
+// this much space, CreateDatabase refuses new sessions until old ones expire.
+// A limit of zero or less disables the quota.
+func (m *SessionManager) SetMaxTotalBytes(n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.maxTotalBytes = n
+}
+
+// Stats reports the current sessions and storage usage.
+func (m *SessionManager) Stats() (StorageStats, error) {
+	total, err := m.totalBytes()
+	if err != nil {
+		return StorageStats{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := StorageStats{
+		Sessions:      len(m.sessions),
+		TotalBytes:    total,
+		MaxTotalBytes: m.maxTotalBytes,
+	}
+	for _, info := range m.sessions {
+		if info.InMemory {
+			stats.InMemorySessions++
+		}
+	}
+	return stats, nil
+}
+
+// totalBytes sums the size of the files in the root dir, including any
+// journals alongside the databases.
+func (m *SessionManager) totalBytes() (int64, error) {
+	entries, err := os.ReadDir(m.rootDir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read data dir: %w", err)
+	}
+
+	var total int64
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			// The file was removed since the directory was read.
+			continue
+		}
+		total += info.Size()
+	}
+	return total, nil
+}
+
+// checkQuota returns ErrQuotaExceeded if database files already use up the
+// storage quota.
+func (m *SessionManager) checkQuota() error {
+	m.mu.Lock()
+	limit := m.maxTotalBytes
+	m.mu.Unlock()
+	if limit <= 0 {
+		return nil
+	}
+	total, err := m.totalBytes()
+	if err != nil {
+		return err
+	}
+	if total >= limit {
+		return fmt.Errorf("%w: %d of %d bytes used", ErrQuotaExceeded, total, limit)
+	}
+	return nil
+}
+
 func (m *SessionManager) CreateDatabase() (string, error) {
+	if err := m.checkQuota(); err != nil {
+		return "", err
+	}
+
 	sessionID := generateSessionID()
 	dbPath := filepath.Join(m.rootDir, sessionID+".db")
 
 	// Touch the DB to ensure it exists
-	db, err := sql.Open("sqlite3", dbPath)
+	db, err := m.open(dbPath)
 	if err != nil {
 		return "", err
 	}
@@ -64,38 +189,293 @@ func (m *SessionManager) CreateDatabase() (string, error) {
 	defer m.mu.Unlock()
 	m.sessions[sessionID] = &SessionInfo{
 		Path:       dbPath,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(m.expiration),
+		LastAccess: now,
+	}
+
+	return sessionID, nil
+}
+
+// CreateInMemoryDatabase creates a session backed by a shared-cache
+// in-memory database. Nothing is written to disk and the data is discarded
+// when the session expires.
+func (m *SessionManager) CreateInMemoryDatabase() (string, error) {
+	sessionID := generateSessionID()
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", sessionID)
+
+	db, err := m.open(dsn)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := db.Exec("CREATE TABLE IF NOT EXISTS metadata (created_at TEXT);"); err != nil {
+		db.Close()
+		return "", err
+	}
+
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[sessionID] = &SessionInfo{
+		Path:       dsn,
+		InMemory:   true,
+		CreatedAt:  now,
 		ExpiresAt:  now.Add(m.expiration),
 		LastAccess: now,
+		keepAlive:  db,
 	}
 
 	return sessionID, nil
 }
 
+// CloneDatabase creates a new session holding an independent copy of the
+// session's database file and returns its ID. The WAL, if any, is
+// checkpointed first, and writers are locked out while the files are copied
+// so the clone is consistent. In-memory sessions can't be cloned.
+func (m *SessionManager) CloneDatabase(sessionID string) (string, error) {
+	info, err := m.touch(sessionID)
+	if err != nil {
+		return "", err
+	}
+	if info.InMemory {
+		return "", errors.New("in-memory sessions can't be cloned")
+	}
+	if err := m.checkQuota(); err != nil {
+		return "", err
+	}
+
+	db, err := m.open(info.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open sqlite db: %w", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "PRAGMA wal_checkpoint(TRUNCATE);"); err != nil {
+		return "", fmt.Errorf("failed to checkpoint: %w", err)
+	}
+	// Hold the write lock so nothing commits while the files are copied.
+	if _, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE;"); err != nil {
+		return "", err
+	}
+	defer conn.ExecContext(ctx, "ROLLBACK;")
+
+	cloneID := generateSessionID()
+	clonePath := filepath.Join(m.rootDir, cloneID+".db")
+	// A writer may have committed to the WAL after the checkpoint, so copy it
+	// too when it exists.
+	for _, suffix := range []string{"", "-wal"} {
+		if err := copyFile(info.Path+suffix, clonePath+suffix); err != nil && !(suffix != "" && errors.Is(err, os.ErrNotExist)) {
+			os.Remove(clonePath)
+			os.Remove(clonePath + "-wal")
+			return "", fmt.Errorf("failed to copy database: %w", err)
+		}
+	}
+
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[cloneID] = &SessionInfo{
+		Path:       clonePath,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(m.expiration),
+		LastAccess: now,
+	}
+
+	return cloneID, nil
+}
+
+// copyFile copies src to a new file at dst.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
 func (m *SessionManager) GetDB(sessionID string) (*sql.DB, error) {
+	info, err := m.touch(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := m.open(info.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite db: %w", err)
+	}
+
+	return db, nil
+}
+
+// GetPath returns the path of the database file backing the session. It
+// errors for in-memory sessions as they have no file.
+func (m *SessionManager) GetPath(sessionID string) (string, error) {
+	info, err := m.touch(sessionID)
+	if err != nil {
+		return "", err
+	}
+	if info.InMemory {
+		return "", errors.New("session is in-memory and has no database file")
+	}
+	return info.Path, nil
+}
+
+// SessionSummary describes a session for listings.
+type SessionSummary struct {
+	ID         string    `json:"id"`
+	Label      string    `json:"label,omitempty"`
+	InMemory   bool      `json:"in_memory"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastAccess time.Time `json:"last_access"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	// SizeBytes is the size of the database file, or 0 for in-memory
+	// sessions.
+	SizeBytes int64 `json:"size_bytes"`
+}
+
+// SetLabel gives the session a human-readable label that can be used in
+// place of its ID. An empty label removes it. Labels are unique across
+// sessions and can't collide with session IDs.
+func (m *SessionManager) SetLabel(sessionID, label string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	info, ok := m.sessions[sessionID]
+	id, info, ok := m.lookup(sessionID)
 	if !ok {
-		return nil, errors.New("invalid session")
+		return errors.New("invalid session")
+	}
+	if label != "" {
+		if _, taken := m.sessions[label]; taken {
+			return fmt.Errorf("%w: %q is a session ID", ErrLabelInUse, label)
+		}
+		for otherID, other := range m.sessions {
+			if otherID != id && other.Label == label {
+				return fmt.Errorf("%w: %q", ErrLabelInUse, label)
+			}
+		}
+	}
+	info.Label = label
+	return nil
+}
+
+// ListSessions returns the live sessions ordered by ID.
+func (m *SessionManager) ListSessions() []SessionSummary {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	sessions := make([]SessionSummary, 0, len(m.sessions))
+	for id, info := range m.sessions {
+		if now.After(info.ExpiresAt) {
+			continue
+		}
+		summary := SessionSummary{
+			ID:         id,
+			Label:      info.Label,
+			InMemory:   info.InMemory,
+			CreatedAt:  info.CreatedAt,
+			LastAccess: info.LastAccess,
+			ExpiresAt:  info.ExpiresAt,
+		}
+		if !info.InMemory {
+			if fi, err := os.Stat(info.Path); err == nil {
+				summary.SizeBytes = fi.Size()
+			}
+		}
+		sessions = append(sessions, summary)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ID < sessions[j].ID })
+	return sessions
+}
+
+// RecordQuery adds a query that returned rows and took elapsed to the
+// session's metrics. Unknown sessions are ignored.
+func (m *SessionManager) RecordQuery(sessionID string, rows int64, elapsed time.Duration, failed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, info, ok := m.lookup(sessionID)
+	if !ok {
+		return
+	}
+	info.Metrics.Queries++
+	info.Metrics.Rows += rows
+	info.Metrics.QueryTime += elapsed
+	if failed {
+		info.Metrics.Errors++
+	}
+}
+
+// Metrics returns the session's query metrics. Unlike the other lookups it
+// doesn't extend the session's expiration.
+func (m *SessionManager) Metrics(sessionID string) (SessionMetrics, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, info, ok := m.lookup(sessionID)
+	if !ok || time.Now().After(info.ExpiresAt) {
+		return SessionMetrics{}, errors.New("invalid session")
+	}
+	return info.Metrics, nil
+}
+
+// lookup finds a session by ID or label. m.mu must be held.
+func (m *SessionManager) lookup(idOrLabel string) (string, *SessionInfo, bool) {
+	if info, ok := m.sessions[idOrLabel]; ok {
+		return idOrLabel, info, true
+	}
+	if idOrLabel == "" {
+		return "", nil, false
+	}
+	for id, info := range m.sessions {
+		if info.Label == idOrLabel {
+			return id, info, true
+		}
+	}
+	return "", nil, false
+}
+
+// touch looks up the session by ID or label and extends its expiration.
+func (m *SessionManager) touch(sessionID string) (SessionInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sessionID, info, ok := m.lookup(sessionID)
+	if !ok {
+		return SessionInfo{}, errors.New("invalid session")
 	}
 
 	now := time.Now()
 	if now.After(info.ExpiresAt) {
+		removeSession(info)
 		delete(m.sessions, sessionID)
-		return nil, errors.New("session expired")
+		return SessionInfo{}, errors.New("session expired")
 	}
 
 	// Extend expiration
 	info.LastAccess = now
 	info.ExpiresAt = now.Add(m.expiration)
 
-	db, err := sql.Open("sqlite3", info.Path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open sqlite db: %w", err)
-	}
-
-	return db, nil
+	return *info, nil
 }
 
 func (m *SessionManager) cleanupLoop() {
@@ -114,12 +494,30 @@ func (m *SessionManager) cleanupExpired() {
 	now := time.Now()
 	for id, info := range m.sessions {
 		if now.After(info.ExpiresAt) {
-			os.Remove(info.Path)
+			removeSession(info)
 			delete(m.sessions, id)
 		}
 	}
 }
 
+// removeSession discards the session's data, including the WAL and other
+// files SQLite keeps beside the database, which count against the quota too.
+func removeSession(info *SessionInfo) {
+	if info.InMemory {
+		info.keepAlive.Close()
+		return
+	}
+	for _, suffix := range []string{"", "-wal", "-shm", "-journal"} {
+		os.Remove(info.Path + suffix)
+	}
+}
+
+// generateSessionID returns a random hex ID. It is unguessable, so one
+// client can't open another's session, and safe to use as a file name.
 func generateSessionID() string {
-	return fmt.Sprintf("%d%d%d", time.Now().UnixNano(), rand.Uint64(), rand.Uint64())
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("failed to generate session ID: %v", err))
+	}
+	return hex.EncodeToString(b)
 }
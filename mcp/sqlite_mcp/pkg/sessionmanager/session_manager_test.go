@@ -1,7 +1,13 @@
 package sessionmanager_test
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"os"
 	"path/filepath"
+	"regexp"
 	"testing"
 	"time"
 
@@ -40,6 +46,57 @@ func TestSessionExpiration(t *testing.T) {
 	}
 }
 
+func TestExpiredSnapshotSessionLeavesNoFiles(t *testing.T) {
+	rootDir := t.TempDir()
+
+	manager := sessionmanager.NewSessionManager(rootDir, 50*time.Millisecond)
+	sessionID, err := manager.CreateDatabase()
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	db, err := manager.GetDB(sessionID)
+	if err != nil {
+		t.Fatalf("Failed to get database: %v", err)
+	}
+	defer db.Close()
+
+	// Switch to WAL and hold a read transaction open, as begin_snapshot does,
+	// so the -wal and -shm files stay around.
+	ctx := context.Background()
+	if _, err := db.ExecContext(ctx, "PRAGMA journal_mode=WAL; CREATE TABLE t (x INTEGER); INSERT INTO t VALUES (1);"); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snapshot.Rollback()
+	var n int
+	if err := snapshot.QueryRowContext(ctx, "SELECT COUNT(*) FROM t;").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(rootDir, sessionID+".db-wal")); err != nil {
+		t.Fatalf("expected a WAL file while the snapshot is open: %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if _, err := manager.GetDB(sessionID); err == nil {
+		t.Fatal("Expected error due to session expiration, got none")
+	}
+
+	entries, err := os.ReadDir(rootDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Fatalf("expected the expired session to leave no files, got %v", names)
+	}
+}
+
 func TestSessionRenewal(t *testing.T) {
 	rootDir := t.TempDir()
 
@@ -87,3 +144,75 @@ func TestDatabaseFilePath(t *testing.T) {
 		t.Errorf("Database not created in root dir. Got %s, expected prefix %s", expectedPath, rootDir)
 	}
 }
+
+func TestSessionIDsAreUniqueAndFileSafe(t *testing.T) {
+	manager := sessionmanager.NewSessionManager(t.TempDir(), 10*time.Minute)
+
+	valid := regexp.MustCompile(`^[0-9a-f]{32}$`)
+	seen := map[string]bool{}
+	for i := 0; i < 500; i++ {
+		sessionID, err := manager.CreateDatabase()
+		if err != nil {
+			t.Fatalf("Failed to create database: %v", err)
+		}
+		if seen[sessionID] {
+			t.Fatalf("Duplicate session ID %q after %d sessions", sessionID, i)
+		}
+		if !valid.MatchString(sessionID) {
+			t.Fatalf("Session ID %q is not a 128-bit hex string", sessionID)
+		}
+		seen[sessionID] = true
+	}
+}
+
+func TestEncryptionKeyRejectedWithoutSQLCipher(t *testing.T) {
+	if sessionmanager.EncryptionSupported() {
+		t.Skip("linked SQLite supports encryption")
+	}
+
+	manager := sessionmanager.NewSessionManager(t.TempDir(), 10*time.Minute)
+	if err := manager.SetEncryptionKey("secret"); !errors.Is(err, sessionmanager.ErrEncryptionUnsupported) {
+		t.Fatalf("expected ErrEncryptionUnsupported, got %v", err)
+	}
+}
+
+func TestEncryptedDatabaseIsNotPlaintext(t *testing.T) {
+	if !sessionmanager.EncryptionSupported() {
+		t.Skip("linked SQLite is not SQLCipher")
+	}
+
+	manager := sessionmanager.NewSessionManager(t.TempDir(), 10*time.Minute)
+	if err := manager.SetEncryptionKey("secret"); err != nil {
+		t.Fatal(err)
+	}
+	sessionID, err := manager.CreateDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := manager.GetDB(sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE secrets (v TEXT); INSERT INTO secrets VALUES ('hunter2-plaintext');"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The key holder can still read the data back.
+	var v string
+	if err := db.QueryRow("SELECT v FROM secrets;").Scan(&v); err != nil || v != "hunter2-plaintext" {
+		t.Fatalf("expected to read the value back, got %q, %v", v, err)
+	}
+
+	path, err := manager.GetPath(sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("hunter2-plaintext")) || bytes.HasPrefix(data, []byte("SQLite format 3")) {
+		t.Fatal("expected the database file to be encrypted")
+	}
+}
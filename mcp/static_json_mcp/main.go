@@ -1,63 +1,183 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"math"
 	"os"
 	"reflect"
+	"strconv"
 	"strings"
 
 	"github.com/invopop/jsonschema"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
+	"github.com/poy/adk-rnd/mcp/internal/metatool"
 )
 
 func main() {
 	log.SetFlags(0)
-	filePath := flag.String("file", "", "Path to JSON file (must contain array)")
+	filePath := flag.String("file", "", "Path to JSON file (must contain array, optionally gzip-compressed)")
 	toolName := flag.String("tool", "get_data", "MCP tool name to expose")
 	serverName := flag.String("name", "MockDataTool", "Name of the MCP server")
+	maxFileMB := flag.Int64("max-file-mb", 512, "Refuse files larger than this many MB (after decompression); every record is held in memory. 0 disables the limit")
+	showVersion := flag.Bool("version", false, "print the version and exit")
 	flag.Parse()
+	if *showVersion {
+		fmt.Println(version)
+		return
+	}
 
 	if *filePath == "" {
 		log.Fatal("--file is required")
 	}
 
-	input, err := os.ReadFile(*filePath)
+	jsonArray, err := loadData(*filePath, *maxFileMB)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	srv := newServer(*serverName, *toolName, jsonArray)
+	metatool.AddServerInfo(srv, version, nil, nil)
+
+	if err := server.ServeStdio(srv); err != nil {
+		log.Fatalf("Server error: %v", err)
+	}
+}
+
+// loadData reads the JSON array at path. Gzip-compressed files are
+// decompressed first; they are detected by a .gz extension or the gzip magic
+// bytes. Files over maxMB megabytes (after decompression) are rejected; a
+// maxMB of zero or less disables the check.
+//
+// The file is decoded one element at a time, so the raw bytes are never held
+// in memory, but every parsed record is. Expect the parsed array to take
+// several times the file's size in memory.
+func loadData(path string, maxMB int64) ([]any, error) {
+	f, err := os.Open(path)
 	if err != nil {
-		log.Fatalf("failed to read file: %v", err)
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	defer f.Close()
+
+	tooLarge := fmt.Errorf("%s is larger than the -max-file-mb limit of %d MB", path, maxMB)
+	maxBytes := maxMB << 20
+	if maxMB > 0 {
+		info, err := f.Stat()
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat file: %w", err)
+		}
+		if info.Size() > maxBytes {
+			return nil, tooLarge
+		}
+	}
+
+	br := bufio.NewReader(f)
+	var r io.Reader = br
+	if magic, _ := br.Peek(2); strings.HasSuffix(path, ".gz") || bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open gzip file: %w", err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+	if maxMB > 0 {
+		r = &capReader{r: r, remaining: maxBytes, err: tooLarge}
+	}
+
+	dec := json.NewDecoder(r)
+	jsonArray := []any{}
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return nil, arrayError(err, tooLarge)
+	}
+	for dec.More() {
+		var v any
+		if err := dec.Decode(&v); err != nil {
+			return nil, arrayError(err, tooLarge)
+		}
+		jsonArray = append(jsonArray, v)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, arrayError(err, tooLarge)
+	}
+	return jsonArray, nil
+}
+
+func arrayError(err, tooLarge error) error {
+	if errors.Is(err, tooLarge) {
+		return tooLarge
 	}
+	if err == nil {
+		err = errors.New("not an array")
+	}
+	return fmt.Errorf("JSON must be an array of objects: %w", err)
+}
+
+// capReader reads from r, failing with err once more than remaining bytes
+// have been read. The read that crosses the limit returns no data so the
+// decoder can't complete a value from it and then miss the error.
+type capReader struct {
+	r         io.Reader
+	remaining int64
+	err       error
+}
 
-	var jsonArray []any
-	if err := json.Unmarshal(input, &jsonArray); err != nil {
-		log.Fatalf("JSON must be an array of objects: %v", err)
+func (c *capReader) Read(p []byte) (int, error) {
+	if c.remaining < 0 {
+		return 0, c.err
 	}
+	n, err := c.r.Read(p)
+	c.remaining -= int64(n)
+	if c.remaining < 0 {
+		return 0, c.err
+	}
+	return n, err
+}
 
+func newServer(serverName, toolName string, jsonArray []any) *server.MCPServer {
 	outputStruct := buildStructFromJSONSample(jsonArray)
 
-	srv := server.NewMCPServer(*serverName, "v0.0.1")
-	srv.AddTool(
-		mcp.NewTool(*toolName,
-			mcp.WithDescription("Returns paged JSON data with inferred raw schema"),
-			WithOutputSchema(outputStruct),
-			mcp.WithNumber("page", mcp.Description("The page to read. Defaults to 0")),
-			mcp.WithNumber("page_size", mcp.Description("The page size to read. Defaults to 10")),
+	dataTool := mcp.NewTool(toolName,
+		mcp.WithDescription("Returns paged JSON data with inferred raw schema"),
+		WithOutputSchema(outputStruct),
+		mcp.WithNumber("page", mcp.Description("The page to read. Defaults to 0")),
+		mcp.WithNumber("page_size", mcp.Description("The page size to read. Defaults to 10")),
+		mcp.WithArray("fields",
+			mcp.Description("Only include these keys in each returned record. Defaults to every key."),
+			mcp.WithStringItems(),
 		),
-		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			page := 0
-			pageSize := 10
+	)
 
-			if val := req.GetInt("page", -1); val != -1 {
-				page = val
+	srv := server.NewMCPServer(serverName, version)
+	srv.AddTool(
+		dataTool,
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			args := req.GetArguments()
+			page, err := intArg(args, "page", 0)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			pageSize, err := intArg(args, "page_size", 10)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
 			}
-			if val := req.GetInt("page_size", -1); val != -1 {
-				pageSize = val
+			if pageSize == 0 {
+				return mcp.NewToolResultError("page_size must be at least 1"), nil
 			}
 
 			paged := paginate(jsonArray, page, pageSize)
+			if fields := req.GetStringSlice("fields", nil); len(fields) > 0 {
+				paged = project(paged, fields)
+			}
 			out, err := json.Marshal(paged)
 			if err != nil {
 				return nil, fmt.Errorf("failed to marshal paged data: %w", err)
@@ -73,13 +193,151 @@ func main() {
 			}, nil
 		},
 	)
+	srv.AddTool(
+		mcp.NewTool("get_schema",
+			mcp.WithDescription(fmt.Sprintf("Returns the JSON schema of the records %s returns, inferred from the data, so you can plan which fields to fetch", toolName)),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			// The schema was inferred once when the data tool was built.
+			if dataTool.RawOutputSchema == nil {
+				return mcp.NewToolResultError("no schema could be inferred from the data"), nil
+			}
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					mcp.TextContent{
+						Type: "text",
+						Text: string(dataTool.RawOutputSchema),
+					},
+				},
+			}, nil
+		},
+	)
+	srv.AddTool(
+		mcp.NewTool("aggregate",
+			mcp.WithDescription("Groups every record by a field and returns a map from each group to its count, or the sum or average of a numeric field"),
+			mcp.WithString("group_by",
+				mcp.Required(),
+				mcp.Description("Field to group records by. Records without it are grouped under \"null\"."),
+			),
+			mcp.WithString("op",
+				mcp.Description("Aggregation to compute per group. Defaults to count."),
+				mcp.Enum("count", "sum", "avg"),
+			),
+			mcp.WithString("value_field",
+				mcp.Description("Numeric field to sum or average. Required for sum and avg. Non-numeric and missing values are skipped."),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			groupBy, err := req.RequireString("group_by")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			op := req.GetString("op", "count")
+			valueField := req.GetString("value_field", "")
+			if op != "count" && valueField == "" {
+				return mcp.NewToolResultError(fmt.Sprintf("value_field is required for %s", op)), nil
+			}
 
-	if err := server.ServeStdio(srv); err != nil {
-		log.Fatalf("Server error: %v", err)
+			result, err := aggregate(jsonArray, groupBy, op, valueField)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			out, err := json.Marshal(result)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal aggregate: %w", err)
+			}
+
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					mcp.TextContent{
+						Type: "text",
+						Text: string(out),
+					},
+				},
+			}, nil
+		},
+	)
+	return srv
+}
+
+// aggregate groups records by the groupBy field and applies op to each
+// group. Groups are keyed by the field value formatted with fmt.Sprint.
+func aggregate(records []any, groupBy, op, valueField string) (map[string]float64, error) {
+	if op != "count" && op != "sum" && op != "avg" {
+		return nil, fmt.Errorf("unknown op %q", op)
 	}
+
+	sums := map[string]float64{}
+	counts := map[string]float64{}
+	for _, r := range records {
+		m, ok := r.(map[string]any)
+		if !ok {
+			continue
+		}
+		key := "null"
+		if v, ok := m[groupBy]; ok && v != nil {
+			key = fmt.Sprint(v)
+		}
+
+		if op == "count" {
+			counts[key]++
+			continue
+		}
+		v, ok := m[valueField].(float64)
+		if !ok {
+			continue
+		}
+		sums[key] += v
+		counts[key]++
+	}
+
+	switch op {
+	case "count":
+		return counts, nil
+	case "avg":
+		for k, n := range counts {
+			sums[k] /= n
+		}
+	}
+	return sums, nil
+}
+
+// intArg reads a non-negative integer argument, accepting JSON numbers and
+// numeric strings. It returns def only when the argument is absent, so an
+// explicit zero is kept.
+func intArg(args map[string]any, name string, def int) (int, error) {
+	v, ok := args[name]
+	if !ok || v == nil {
+		return def, nil
+	}
+
+	var n int
+	switch v := v.(type) {
+	case float64:
+		if v != math.Trunc(v) || v > math.MaxInt32 || v < math.MinInt32 {
+			return 0, fmt.Errorf("%s must be an integer, got %v", name, v)
+		}
+		n = int(v)
+	case string:
+		parsed, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return 0, fmt.Errorf("%s must be an integer, got %q", name, v)
+		}
+		n = parsed
+	default:
+		return 0, fmt.Errorf("%s must be an integer, got %T", name, v)
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("%s must not be negative, got %d", name, n)
+	}
+	return n, nil
 }
 
 func paginate(array []any, page, pageSize int) []any {
+	// Check the page before multiplying so a huge page can't overflow.
+	if page > len(array)/pageSize {
+		return nil
+	}
 	start := page * pageSize
 	if start >= len(array) {
 		return nil
@@ -93,6 +351,27 @@ func paginate(array []any, page, pageSize int) []any {
 	return array[start:end]
 }
 
+// project returns copies of the records with only the given keys. Keys a
+// record doesn't have are left out.
+func project(records []any, fields []string) []any {
+	projected := make([]any, 0, len(records))
+	for _, r := range records {
+		m, ok := r.(map[string]any)
+		if !ok {
+			projected = append(projected, r)
+			continue
+		}
+		p := make(map[string]any, len(fields))
+		for _, f := range fields {
+			if v, ok := m[f]; ok {
+				p[f] = v
+			}
+		}
+		projected = append(projected, p)
+	}
+	return projected
+}
+
 func buildStructFromJSONSample(sample []any) any {
 	m := map[string]any{}
 	for _, entry := range sample {
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestGetDataFromGzipFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json.gz")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := gzip.NewWriter(f)
+	if _, err := zw.Write([]byte(`[{"id": 1, "name": "a"}, {"id": 2, "name": "b"}]`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := loadData(path, 1)
+	if err != nil {
+		t.Fatalf("failed to load gzipped data: %v", err)
+	}
+
+	mcpClient := newTestClient(t, data)
+	records := getData(t, mcpClient, map[string]any{"page_size": 1, "page": 1})
+	if len(records) != 1 || records[0]["name"] != "b" {
+		t.Fatalf("unexpected records: %v", records)
+	}
+}
+
+func TestLoadDataRejectsOversizedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+	data := []byte(`[` + strings.Repeat(`{"id": 1},`, 200000) + `{"id": 2}]`)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := loadData(path, 1)
+	if err == nil || !strings.Contains(err.Error(), "-max-file-mb") {
+		t.Fatalf("expected a -max-file-mb error, got %v", err)
+	}
+
+	records, err := loadData(path, 0)
+	if err != nil {
+		t.Fatalf("expected no limit with 0, got %v", err)
+	}
+	if len(records) != 200001 {
+		t.Fatalf("expected 200001 records, got %d", len(records))
+	}
+}
+
+func TestLoadDataRejectsOversizedGzipContents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json.gz")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := gzip.NewWriter(f)
+	if _, err := zw.Write([]byte(`[` + strings.Repeat(`{"id": 1},`, 200000) + `{"id": 2}]`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := loadData(path, 1); err == nil || !strings.Contains(err.Error(), "-max-file-mb") {
+		t.Fatalf("expected a -max-file-mb error for large decompressed contents, got %v", err)
+	}
+}
+
+func newTestClient(t *testing.T, data []any) *client.Client {
+	t.Helper()
+	srv := newServer("test", "get_data", data)
+	mcpClient := client.NewClient(transport.NewInProcessTransport(srv))
+	if _, err := mcpClient.Initialize(context.Background(), mcp.InitializeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	return mcpClient
+}
+
+func getData(t *testing.T, mcpClient *client.Client, args map[string]any) []map[string]any {
+	t.Helper()
+	req := mcp.CallToolRequest{
+		Request: mcp.Request{Method: "tools/call"},
+		Params: mcp.CallToolParams{
+			Name:      "get_data",
+			Arguments: args,
+		},
+	}
+	res, err := mcpClient.CallTool(context.Background(), req)
+	if err != nil {
+		t.Fatalf("get_data failed: %v", err)
+	}
+	var records []map[string]any
+	if err := json.Unmarshal([]byte(res.Content[0].(mcp.TextContent).Text), &records); err != nil {
+		t.Fatalf("failed to unmarshal records: %v", err)
+	}
+	return records
+}
+
+func TestGetDataProjectsFields(t *testing.T) {
+	data := []any{
+		map[string]any{"id": 1.0, "name": "a", "notes": "long"},
+		map[string]any{"id": 2.0, "name": "b", "notes": "longer"},
+		map[string]any{"id": 3.0, "name": "c", "notes": "longest"},
+	}
+	mcpClient := newTestClient(t, data)
+
+	records := getData(t, mcpClient, map[string]any{
+		"fields":    []string{"id", "missing"},
+		"page":      1,
+		"page_size": 2,
+	})
+	if len(records) != 1 {
+		t.Fatalf("expected 1 record, got %v", records)
+	}
+	if len(records[0]) != 1 || records[0]["id"] != 3.0 {
+		t.Fatalf("expected only the id key, got %v", records[0])
+	}
+
+	records = getData(t, mcpClient, map[string]any{})
+	if len(records) != 3 || len(records[0]) != 3 {
+		t.Fatalf("expected full records without fields, got %v", records)
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	data := []any{
+		map[string]any{"status": "open", "total": 10.0},
+		map[string]any{"status": "open", "total": 20.0},
+		map[string]any{"status": "closed", "total": 5.0},
+		map[string]any{"status": "closed", "total": "n/a"},
+		map[string]any{"total": 1.0},
+	}
+	mcpClient := newTestClient(t, data)
+
+	for _, tc := range []struct {
+		args map[string]any
+		want map[string]float64
+	}{
+		{
+			args: map[string]any{"group_by": "status"},
+			want: map[string]float64{"open": 2, "closed": 2, "null": 1},
+		},
+		{
+			args: map[string]any{"group_by": "status", "op": "sum", "value_field": "total"},
+			want: map[string]float64{"open": 30, "closed": 5, "null": 1},
+		},
+		{
+			args: map[string]any{"group_by": "status", "op": "avg", "value_field": "total"},
+			want: map[string]float64{"open": 15, "closed": 5, "null": 1},
+		},
+	} {
+		req := mcp.CallToolRequest{
+			Request: mcp.Request{Method: "tools/call"},
+			Params: mcp.CallToolParams{
+				Name:      "aggregate",
+				Arguments: tc.args,
+			},
+		}
+		res, err := mcpClient.CallTool(context.Background(), req)
+		if err != nil {
+			t.Fatalf("aggregate failed: %v", err)
+		}
+		var got map[string]float64
+		if err := json.Unmarshal([]byte(res.Content[0].(mcp.TextContent).Text), &got); err != nil {
+			t.Fatalf("failed to unmarshal aggregate: %v", err)
+		}
+		if len(got) != len(tc.want) {
+			t.Fatalf("%v: expected %v, got %v", tc.args, tc.want, got)
+		}
+		for k, v := range tc.want {
+			if got[k] != v {
+				t.Fatalf("%v: expected %v, got %v", tc.args, tc.want, got)
+			}
+		}
+	}
+}
+
+func TestGetDataPageArguments(t *testing.T) {
+	var data []any
+	for i := range 25 {
+		data = append(data, map[string]any{"id": float64(i)})
+	}
+	mcpClient := newTestClient(t, data)
+
+	// Numeric strings are accepted.
+	records := getData(t, mcpClient, map[string]any{"page": "2", "page_size": "5"})
+	if len(records) != 5 || records[0]["id"] != float64(10) {
+		t.Fatalf("expected ids 10-14, got %v", records)
+	}
+
+	// An explicit zero page is the first page, not "unset".
+	records = getData(t, mcpClient, map[string]any{"page": 0, "page_size": 3})
+	if len(records) != 3 || records[0]["id"] != float64(0) {
+		t.Fatalf("expected ids 0-2, got %v", records)
+	}
+
+	for _, args := range []map[string]any{
+		{"page": -1},
+		{"page_size": -1},
+		{"page_size": 0},
+		{"page": "two"},
+		{"page": 1.5},
+	} {
+		res, err := mcpClient.CallTool(context.Background(), mcp.CallToolRequest{
+			Request: mcp.Request{Method: "tools/call"},
+			Params:  mcp.CallToolParams{Name: "get_data", Arguments: args},
+		})
+		if err != nil {
+			t.Fatalf("get_data failed: %v", err)
+		}
+		if !res.IsError {
+			t.Fatalf("expected %v to be rejected, got %+v", args, res)
+		}
+	}
+}
+
+func TestGetSchemaListsSampledFields(t *testing.T) {
+	data := []any{
+		map[string]any{"id": 1.0, "name": "a"},
+		map[string]any{"id": 2.0, "score": 0.5},
+	}
+	mcpClient := newTestClient(t, data)
+
+	res, err := mcpClient.CallTool(context.Background(), mcp.CallToolRequest{
+		Request: mcp.Request{Method: "tools/call"},
+		Params:  mcp.CallToolParams{Name: "get_schema"},
+	})
+	if err != nil {
+		t.Fatalf("get_schema failed: %v", err)
+	}
+	var schema struct {
+		Properties map[string]struct {
+			Type string `json:"type"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal([]byte(res.Content[0].(mcp.TextContent).Text), &schema); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"id": "integer", "name": "string", "score": "number"}
+	for field, typ := range want {
+		if got := schema.Properties[field].Type; got != typ {
+			t.Errorf("expected %s to be %s, got %q", field, typ, got)
+		}
+	}
+	if len(schema.Properties) != len(want) {
+		t.Fatalf("expected only the sampled fields, got %v", schema.Properties)
+	}
+}
@@ -2,23 +2,35 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
-	"math/rand"
 	"sort"
+	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
+	"github.com/poy/adk-rnd/mcp/internal/metatool"
 )
 
 func main() {
 	log.SetFlags(0)
+	showVersion := flag.Bool("version", false, "print the version and exit")
+	flag.Parse()
+	if *showVersion {
+		fmt.Println(version)
+		return
+	}
 	// Create a new MCP server
 	s := server.NewMCPServer(
 		"Tasks",
-		"1.0.0",
+		version,
 		server.WithToolCapabilities(false),
 	)
 
@@ -33,6 +45,9 @@ func main() {
 			mcp.Required(),
 			mcp.Description("Description of the task"),
 		),
+		mcp.WithString("due",
+			mcp.Description("When the task is due, as an RFC 3339 timestamp such as 2025-07-01T17:00:00Z"),
+		),
 	),
 		toolSet.addTaskHandler)
 
@@ -62,11 +77,49 @@ func main() {
 	),
 		toolSet.markTaskDoneHandler)
 
+	s.AddTool(mcp.NewTool("log_time",
+		mcp.WithDescription("Log time spent working on a task. Entries add up to the task's MinutesSpent total."),
+		mcp.WithString("id",
+			mcp.Required(),
+			mcp.Description("The ID of the task"),
+		),
+		mcp.WithNumber("minutes",
+			mcp.Required(),
+			mcp.Description("Minutes spent, must be positive"),
+		),
+	),
+		toolSet.logTimeHandler)
+
 	s.AddTool(mcp.NewTool("list_tasks",
 		mcp.WithDescription("Lists all the tasks"),
+		mcp.WithString("format",
+			mcp.Description("Output format: json (default) or text for a human-readable list."),
+			mcp.Enum("json", "text"),
+		),
 	),
 		toolSet.listTasksHandler)
 
+	s.AddTool(mcp.NewTool("export_markdown",
+		mcp.WithDescription("Exports all the tasks as a Markdown checklist, oldest first, with status updates as sub-bullets. Useful for sharing status with people."),
+	),
+		toolSet.exportMarkdownHandler)
+
+	s.AddTool(mcp.NewTool("export_ical",
+		mcp.WithDescription("Exports the tasks that have due dates as an iCalendar (.ics) feed, one event per task at its due time, so they can be imported into calendar apps. Completed tasks are marked done."),
+	),
+		toolSet.exportICalHandler)
+
+	metatool.AddServerInfo(s, version, nil, nil)
+
+	s.AddTool(mcp.NewTool("get_task",
+		mcp.WithDescription("Gets a single task, including every status update in the order they were added"),
+		mcp.WithString("id",
+			mcp.Required(),
+			mcp.Description("The ID of the task"),
+		),
+	),
+		toolSet.getTaskHandler)
+
 	// Start the stdio server
 	if err := server.ServeStdio(s); err != nil {
 		log.Fatalf("Server error: %v", err)
@@ -74,6 +127,9 @@ func main() {
 }
 
 type tasksToolSet struct {
+	// mu guards tasks and the tasks in it, since calls can be handled
+	// concurrently.
+	mu    sync.RWMutex
 	tasks map[string]*Task
 }
 
@@ -83,6 +139,8 @@ type Task struct {
 	StatusUpdate []StatusUpdate
 	Created      time.Time
 	Done         bool
+	MinutesSpent float64
+	Due          *time.Time `json:",omitempty"`
 }
 
 type StatusUpdate struct {
@@ -96,17 +154,38 @@ func (s *tasksToolSet) addTaskHandler(ctx context.Context, request mcp.CallToolR
 		return mcp.NewToolResultError(err.Error()), nil
 	}
 
-	id := fmt.Sprintf("%d%d", time.Now().UnixNano(), rand.Uint64())
+	var due *time.Time
+	if v := request.GetString("due", ""); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("due must be an RFC 3339 timestamp: %v", err)), nil
+		}
+		due = &t
+	}
+
+	id := newTaskID()
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.tasks[id] = &Task{
 		ID:          id,
 		Created:     time.Now(),
 		Description: desc,
+		Due:         due,
 	}
 
 	return mcp.NewToolResultText(fmt.Sprintf("Created task, %s", id)), nil
 }
 
+// newTaskID returns a random ID so that task IDs can't collide or be guessed.
+func newTaskID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("failed to generate task ID: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
 func (s *tasksToolSet) updateTaskStatusHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	id, err := request.RequireString("id")
 	if err != nil {
@@ -117,6 +196,8 @@ func (s *tasksToolSet) updateTaskStatusHandler(ctx context.Context, request mcp.
 		return mcp.NewToolResultError(err.Error()), nil
 	}
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	task, ok := s.tasks[id]
 	if !ok {
 		return mcp.NewToolResultError(fmt.Sprintf("unknown task with ID: %s", id)), nil
@@ -139,6 +220,8 @@ func (s *tasksToolSet) markTaskDoneHandler(ctx context.Context, request mcp.Call
 		return mcp.NewToolResultError(err.Error()), nil
 	}
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	task, ok := s.tasks[id]
 	if !ok {
 		return mcp.NewToolResultError(fmt.Sprintf("unknown task with ID: %s", id)), nil
@@ -152,7 +235,86 @@ func (s *tasksToolSet) markTaskDoneHandler(ctx context.Context, request mcp.Call
 	return mcp.NewToolResultText("Updated task status"), nil
 }
 
+func (s *tasksToolSet) logTimeHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	id, err := request.RequireString("id")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	minutes, err := request.RequireFloat("minutes")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if minutes <= 0 {
+		return mcp.NewToolResultError(fmt.Sprintf("minutes must be positive, got %g", minutes)), nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	task, ok := s.tasks[id]
+	if !ok {
+		return mcp.NewToolResultError(fmt.Sprintf("unknown task with ID: %s", id)), nil
+	}
+	task.MinutesSpent += minutes
+
+	return mcp.NewToolResultText(fmt.Sprintf("Logged %g minutes, %g in total", minutes, task.MinutesSpent)), nil
+}
+
+func (s *tasksToolSet) getTaskHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	id, err := request.RequireString("id")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	task, ok := s.tasks[id]
+	if !ok {
+		return mcp.NewToolResultError(fmt.Sprintf("unknown task with ID: %s", id)), nil
+	}
+
+	data, err := json.Marshal(task)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal task: %w", err)
+	}
+
+	return mcp.NewToolResultText(string(data)), nil
+}
+
 func (s *tasksToolSet) listTasksHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	results := s.sortedTasks()
+
+	switch format := request.GetString("format", "json"); format {
+	case "json":
+	case "text":
+		return mcp.NewToolResultText(renderTasksText(results)), nil
+	default:
+		return mcp.NewToolResultError(fmt.Sprintf("unknown format: %s", format)), nil
+	}
+
+	data, err := json.Marshal(results)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal tasks: %w", err)
+	}
+
+	return mcp.NewToolResultText(string(data)), nil
+}
+
+func (s *tasksToolSet) exportMarkdownHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return mcp.NewToolResultText(renderTasksText(s.sortedTasks())), nil
+}
+
+func (s *tasksToolSet) exportICalHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return mcp.NewToolResultText(renderTasksICal(s.sortedTasks())), nil
+}
+
+// sortedTasks returns every task, oldest first. The caller must hold mu.
+func (s *tasksToolSet) sortedTasks() []*Task {
 	var results []*Task
 	for _, task := range s.tasks {
 		results = append(results, task)
@@ -160,11 +322,88 @@ func (s *tasksToolSet) listTasksHandler(ctx context.Context, request mcp.CallToo
 	sort.Slice(results, func(i, j int) bool {
 		return results[i].Created.UnixNano() < results[j].Created.UnixNano()
 	})
+	return results
+}
 
-	data, err := json.Marshal(results)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal tasks: %w", err)
+// renderTasksText renders tasks as a GitHub-style Markdown checklist with
+// their status updates as nested bullets.
+func renderTasksText(tasks []*Task) string {
+	if len(tasks) == 0 {
+		return "No tasks."
 	}
 
-	return mcp.NewToolResultText(string(data)), nil
+	var b strings.Builder
+	for _, task := range tasks {
+		check := " "
+		if task.Done {
+			check = "x"
+		}
+		spent := ""
+		if task.MinutesSpent > 0 {
+			spent = fmt.Sprintf(", %g minutes spent", task.MinutesSpent)
+		}
+		if task.Due != nil {
+			spent = fmt.Sprintf(", due %s", task.Due.Format(time.RFC3339)) + spent
+		}
+		fmt.Fprintf(&b, "- [%s] %s (ID: %s, created %s%s)\n", check, task.Description, task.ID, task.Created.Format(time.RFC3339), spent)
+		for _, update := range task.StatusUpdate {
+			fmt.Fprintf(&b, "    - %s: %s\n", update.Updated.Format(time.RFC3339), update.Description)
+		}
+	}
+	return b.String()
+}
+
+// icalTime is the UTC date-time form used in iCalendar properties.
+const icalTime = "20060102T150405Z"
+
+// renderTasksICal renders the tasks that have due dates as an iCalendar feed
+// (RFC 5545) with a zero-length VEVENT at each due time. Done tasks get a
+// "Done: " summary prefix and don't block time, since VEVENT has no status
+// for completion.
+func renderTasksICal(tasks []*Task) string {
+	var b strings.Builder
+	line := func(s string) {
+		// Lines longer than 75 octets are folded onto continuation lines
+		// that start with a space.
+		for len(s) > 75 {
+			n := 75
+			for n > 0 && !utf8.RuneStart(s[n]) {
+				n--
+			}
+			b.WriteString(s[:n] + "\r\n ")
+			s = s[n:]
+		}
+		b.WriteString(s + "\r\n")
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//adk-rnd//tasks_mcp " + version + "//EN")
+	for _, task := range tasks {
+		if task.Due == nil {
+			continue
+		}
+		summary := task.Description
+		transp := "OPAQUE"
+		if task.Done {
+			summary = "Done: " + summary
+			transp = "TRANSPARENT"
+		}
+		due := task.Due.UTC().Format(icalTime)
+		line("BEGIN:VEVENT")
+		line("UID:" + task.ID + "@tasks_mcp")
+		line("DTSTAMP:" + task.Created.UTC().Format(icalTime))
+		line("DTSTART:" + due)
+		line("DTEND:" + due)
+		line("SUMMARY:" + icalEscape(summary))
+		line("TRANSP:" + transp)
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	return b.String()
+}
+
+// icalEscape escapes a TEXT property value.
+func icalEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
 }
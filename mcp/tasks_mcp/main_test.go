@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func TestListTasksFormats(t *testing.T) {
+	toolSet := tasksToolSet{tasks: make(map[string]*Task)}
+	ctx := context.Background()
+
+	id := addTask(t, &toolSet, "write docs")
+	call(t, toolSet.markTaskDoneHandler, map[string]any{"id": id, "finalUpdate": "published"})
+	addTask(t, &toolSet, "fix bug")
+
+	var tasks []Task
+	res := call(t, toolSet.listTasksHandler, nil)
+	if err := json.Unmarshal([]byte(resultText(t, res)), &tasks); err != nil {
+		t.Fatalf("default format is not JSON: %v", err)
+	}
+	if len(tasks) != 2 || tasks[0].Description != "write docs" || !tasks[0].Done {
+		t.Fatalf("unexpected tasks: %+v", tasks)
+	}
+
+	res = call(t, toolSet.listTasksHandler, map[string]any{"format": "text"})
+	lines := strings.Split(strings.TrimSpace(resultText(t, res)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %q", lines)
+	}
+	if !strings.HasPrefix(lines[0], "- [x] write docs (ID: "+id) ||
+		!strings.HasSuffix(lines[1], ": published") ||
+		!strings.HasPrefix(lines[2], "- [ ] fix bug") {
+		t.Fatalf("unexpected text output: %q", lines)
+	}
+
+	res, err := toolSet.listTasksHandler(ctx, toolRequest(map[string]any{"format": "yaml"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.IsError {
+		t.Fatal("expected an error for an unknown format")
+	}
+}
+
+func TestGetTask(t *testing.T) {
+	toolSet := tasksToolSet{tasks: make(map[string]*Task)}
+
+	id := addTask(t, &toolSet, "ship release")
+	for _, update := range []string{"tagged", "built"} {
+		call(t, toolSet.updateTaskStatusHandler, map[string]any{"id": id, "statusUpdate": update})
+	}
+	call(t, toolSet.markTaskDoneHandler, map[string]any{"id": id, "finalUpdate": "published"})
+
+	var task Task
+	res := call(t, toolSet.getTaskHandler, map[string]any{"id": id})
+	if err := json.Unmarshal([]byte(resultText(t, res)), &task); err != nil {
+		t.Fatal(err)
+	}
+	if task.ID != id || task.Description != "ship release" || !task.Done || task.Created.IsZero() {
+		t.Fatalf("unexpected task: %+v", task)
+	}
+	var updates []string
+	for _, u := range task.StatusUpdate {
+		updates = append(updates, u.Description)
+	}
+	if strings.Join(updates, ",") != "tagged,built,published" {
+		t.Fatalf("unexpected status updates: %v", updates)
+	}
+
+	res, err := toolSet.getTaskHandler(context.Background(), toolRequest(map[string]any{"id": "nope"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.IsError || !strings.Contains(resultText(t, res), "unknown task") {
+		t.Fatalf("expected unknown task error, got %+v", res)
+	}
+}
+
+func TestExportMarkdown(t *testing.T) {
+	toolSet := tasksToolSet{tasks: make(map[string]*Task)}
+
+	id := addTask(t, &toolSet, "write docs")
+	call(t, toolSet.markTaskDoneHandler, map[string]any{"id": id, "finalUpdate": "published"})
+	addTask(t, &toolSet, "fix bug")
+
+	res := call(t, toolSet.exportMarkdownHandler, nil)
+	lines := strings.Split(strings.TrimSpace(resultText(t, res)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %q", lines)
+	}
+	if !strings.HasPrefix(lines[0], "- [x] write docs") {
+		t.Fatalf("expected the done task to be checked, got %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "    - ") || !strings.HasPrefix(lines[2], "- [ ] fix bug") {
+		t.Fatalf("unexpected checklist: %q", lines)
+	}
+}
+
+func TestExportICal(t *testing.T) {
+	toolSet := tasksToolSet{tasks: make(map[string]*Task)}
+
+	call(t, toolSet.addTaskHandler, map[string]any{"description": "file taxes, finally", "due": "2025-04-15T17:00:00-04:00"})
+	id := strings.TrimPrefix(resultText(t, call(t, toolSet.addTaskHandler, map[string]any{"description": "renew passport", "due": "2025-03-01T09:30:00Z"})), "Created task, ")
+	call(t, toolSet.markTaskDoneHandler, map[string]any{"id": id, "finalUpdate": "posted"})
+	addTask(t, &toolSet, "someday")
+
+	ics := resultText(t, call(t, toolSet.exportICalHandler, nil))
+	if !strings.HasPrefix(ics, "BEGIN:VCALENDAR\r\n") || !strings.HasSuffix(ics, "END:VCALENDAR\r\n") {
+		t.Fatalf("expected a VCALENDAR, got %q", ics)
+	}
+	if n := strings.Count(ics, "BEGIN:VEVENT"); n != 2 {
+		t.Fatalf("expected 2 events for the tasks with due dates, got %d in %q", n, ics)
+	}
+	for _, want := range []string{
+		"DTSTART:20250415T210000Z\r\n",
+		"SUMMARY:file taxes\\, finally\r\n",
+		"DTSTART:20250301T093000Z\r\n",
+		"SUMMARY:Done: renew passport\r\n",
+		"UID:" + id + "@tasks_mcp\r\n",
+	} {
+		if !strings.Contains(ics, want) {
+			t.Errorf("expected %q in %q", want, ics)
+		}
+	}
+
+	res, err := toolSet.addTaskHandler(context.Background(), toolRequest(map[string]any{"description": "x", "due": "tomorrow"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.IsError {
+		t.Fatal("expected an unparseable due date to be rejected")
+	}
+}
+
+func TestLogTimeAccumulates(t *testing.T) {
+	toolSet := tasksToolSet{tasks: make(map[string]*Task)}
+
+	id := addTask(t, &toolSet, "review PR")
+	call(t, toolSet.logTimeHandler, map[string]any{"id": id, "minutes": 25})
+	call(t, toolSet.logTimeHandler, map[string]any{"id": id, "minutes": 12.5})
+
+	var task Task
+	if err := json.Unmarshal([]byte(resultText(t, call(t, toolSet.getTaskHandler, map[string]any{"id": id}))), &task); err != nil {
+		t.Fatal(err)
+	}
+	if task.MinutesSpent != 37.5 {
+		t.Fatalf("expected 37.5 minutes, got %v", task.MinutesSpent)
+	}
+	if text := resultText(t, call(t, toolSet.listTasksHandler, map[string]any{"format": "text"})); !strings.Contains(text, "37.5 minutes spent") {
+		t.Fatalf("expected the text listing to include the total, got %q", text)
+	}
+
+	for _, minutes := range []any{0, -5} {
+		res, err := toolSet.logTimeHandler(context.Background(), toolRequest(map[string]any{"id": id, "minutes": minutes}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.IsError {
+			t.Fatalf("expected %v minutes to be rejected", minutes)
+		}
+	}
+}
+
+func TestConcurrentCallsAreSafe(t *testing.T) {
+	toolSet := tasksToolSet{tasks: make(map[string]*Task)}
+	id := addTask(t, &toolSet, "shared")
+
+	const n = 100
+	calls := []struct {
+		h    server.ToolHandlerFunc
+		args func(i int) map[string]any
+	}{
+		{toolSet.addTaskHandler, func(i int) map[string]any { return map[string]any{"description": fmt.Sprintf("task %d", i)} }},
+		{toolSet.logTimeHandler, func(i int) map[string]any { return map[string]any{"id": id, "minutes": 1} }},
+		{toolSet.listTasksHandler, func(i int) map[string]any { return map[string]any{"format": "text"} }},
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		for _, c := range calls {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				res, err := c.h(context.Background(), toolRequest(c.args(i)))
+				if err != nil || res.IsError {
+					t.Errorf("call failed: %v %+v", err, res)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	var tasks []Task
+	if err := json.Unmarshal([]byte(resultText(t, call(t, toolSet.listTasksHandler, nil))), &tasks); err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != n+1 {
+		t.Fatalf("expected %d tasks, got %d", n+1, len(tasks))
+	}
+	if tasks[0].MinutesSpent != n {
+		t.Fatalf("expected %d minutes logged, got %v", n, tasks[0].MinutesSpent)
+	}
+}
+
+func TestTaskIDsAreUnique(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 10000; i++ {
+		id := newTaskID()
+		if seen[id] {
+			t.Fatalf("duplicate task ID %q after %d IDs", id, i)
+		}
+		seen[id] = true
+	}
+}
+
+func addTask(t *testing.T, toolSet *tasksToolSet, desc string) string {
+	t.Helper()
+	res := call(t, toolSet.addTaskHandler, map[string]any{"description": desc})
+	return strings.TrimPrefix(resultText(t, res), "Created task, ")
+}
+
+func call(t *testing.T, h server.ToolHandlerFunc, args map[string]any) *mcp.CallToolResult {
+	t.Helper()
+	res, err := h(context.Background(), toolRequest(args))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.IsError {
+		t.Fatalf("tool returned error: %s", resultText(t, res))
+	}
+	return res
+}
+
+func toolRequest(args map[string]any) mcp.CallToolRequest {
+	return mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: args}}
+}
+
+func resultText(t *testing.T, res *mcp.CallToolResult) string {
+	t.Helper()
+	return res.Content[0].(mcp.TextContent).Text
+}